@@ -8,10 +8,40 @@ import (
 
 type VirtulMachinePhase string
 
+// These are the valid phases of a VirtulMachine.
+const (
+	// VirtulMachinePending means the machine has been accepted but no provider id is assigned yet.
+	VirtulMachinePending VirtulMachinePhase = "Pending"
+	// VirtulMachineProvisioning means the provider is creating the machine and no node has registered for it.
+	VirtulMachineProvisioning VirtulMachinePhase = "Provisioning"
+	// VirtulMachineJoining means a node has registered for the machine but it is not Ready yet.
+	VirtulMachineJoining VirtulMachinePhase = "Joining"
+	// VirtulMachineRunning means the node of the machine has become Ready.
+	VirtulMachineRunning VirtulMachinePhase = "Running"
+	// VirtulMachineDraining means the node is cordoned and its pods are being evicted.
+	VirtulMachineDraining VirtulMachinePhase = "Draining"
+	// VirtulMachineTerminating means the machine is being removed from the cluster.
+	VirtulMachineTerminating VirtulMachinePhase = "Terminating"
+	// VirtulMachineTerminated means the machine has been removed from the cluster.
+	VirtulMachineTerminated VirtulMachinePhase = "Terminated"
+	// VirtulMachineFailed means the machine could not reach or keep the expected phase.
+	// It moves to Joining or Running once its node is back, except after a timed out drain.
+	VirtulMachineFailed VirtulMachinePhase = "Failed"
+)
+
 type VirtulMachineConditionType string
 
 type ConditionStatus string
 
+// These are valid condition statuses. "ConditionTrue" means a resource is in the condition.
+// "ConditionFalse" means a resource is not in the condition. "ConditionUnknown" means kubernetes
+// can't decide if a resource is in the condition or not.
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
 // ResourceList is a set of (resource name, quantity) pairs.
 type ResourceList map[ResourceName]resource.Quantity
 
@@ -85,12 +115,16 @@ type VirtulMachineSpec struct {
 	// +optional
 	ProviderID string `json:"providerID,omitempty" protobuf:"bytes,3,opt,name=providerID"`
 	// Unschedulable controls node schedulability of new pods. By default, node is schedulable.
+	// It is applied to the node when it changes, a node cordoned otherwise stays cordoned.
 	// More info: https://kubernetes.io/docs/concepts/nodes/node/#manual-node-administration
 	// +optional
 	Unschedulable bool `json:"unschedulable,omitempty" protobuf:"varint,4,opt,name=unschedulable"`
 	// If specified, the node's taints.
 	// +optional
 	Taints []Taint `json:"taints,omitempty" protobuf:"bytes,5,opt,name=taints"`
+	// If specified, the labels applied to the node.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty" protobuf:"bytes,7,rep,name=labels"`
 	// If specified, the source to get node configuration from
 	// The DynamicKubeletConfig feature gate must be enabled for the Kubelet to use this field
 	// +optional
@@ -154,9 +188,8 @@ type VirtulMachineStatus struct {
 	// Defaults to Capacity.
 	// +optional
 	Allocatable ResourceList `json:"allocatable,omitempty" protobuf:"bytes,2,rep,name=allocatable,casttype=ResourceList,castkey=ResourceName"`
-	// VirtulMachinePhase is the recently observed lifecycle phase of the node.
-	// More info: https://kubernetes.io/docs/concepts/nodes/node/#phase
-	// The field is never populated, and now is deprecated.
+	// VirtulMachinePhase is the recently observed lifecycle phase of the machine.
+	// Every transition is also recorded in Conditions, with one condition per phase.
 	// +optional
 	Phase VirtulMachinePhase `json:"phase,omitempty" protobuf:"bytes,3,opt,name=phase,casttype=VirtulMachinePhase"`
 	// Conditions is an array of current observed node conditions.
@@ -191,6 +224,10 @@ type VirtulMachineStatus struct {
 	// Status of the config assigned to the node via the dynamic Kubelet config feature.
 	// +optional
 	Config *VirtulMachineConfigStatus `json:"config,omitempty" protobuf:"bytes,11,opt,name=config"`
+	// NodeName is the name of the core/v1 Node bound to this machine.
+	// Capacity, Allocatable, VirtulMachineInfo, Addresses and the node conditions are mirrored from it.
+	// +optional
+	NodeName string `json:"nodeName,omitempty" protobuf:"bytes,12,opt,name=nodeName"`
 }
 
 // VirtulMachineConfigStatus describes the status of the config assigned by VirtulMachine.Spec.ConfigSource.
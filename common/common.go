@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -18,10 +19,51 @@ const (
 )
 
 type Ready2Send struct {
-	Title  string
-	Start  string
-	User   string
-	Alerts string
+	Id       int64
+	HostName string
+	Title    string
+	Start    string
+	User     string
+	Alerts   string
+	Type     string
+	Severity string
+	Labels   map[string]string
+	// Ids are the records sent in the message, Id alone when empty
+	Ids []int64
+}
+
+var (
+	recoverLock  sync.Mutex
+	recover2Send = make([]Ready2Send, 0)
+)
+
+// AddRecover queues a recovery message, the timer sends it with the next round of alerts
+func AddRecover(msg Ready2Send) {
+	recoverLock.Lock()
+	defer recoverLock.Unlock()
+	recover2Send = append(recover2Send, msg)
+}
+
+// TakeRecovers returns the queued recovery messages and empties the queue
+func TakeRecovers() []Ready2Send {
+	recoverLock.Lock()
+	defer recoverLock.Unlock()
+	msgs := recover2Send
+	recover2Send = make([]Ready2Send, 0)
+	return msgs
+}
+
+// RequeueRecovers puts back the recovery messages taken but not sent, ahead of those
+// queued since
+func RequeueRecovers(msgs []Ready2Send) {
+	if len(msgs) == 0 {
+		return
+	}
+	recoverLock.Lock()
+	defer recoverLock.Unlock()
+	queued := make([]Ready2Send, 0, len(msgs)+len(recover2Send))
+	queued = append(queued, msgs...)
+	recover2Send = append(queued, recover2Send...)
 }
 
 func HttpPost(url string, params map[string]string, headers map[string]string, body []byte) (*http.Response, error) {
@@ -47,6 +89,9 @@ func HttpPost(url string, params map[string]string, headers map[string]string, b
 	//http client
 	client := &http.Client{Timeout: 5 * time.Second} //Add the timeout,the reason is that the default client has no timeout set; if the remote server is unresponsive, you're going to have a bad day.
 	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
 
 	defer resp.Body.Close()
 	return resp, err
@@ -76,6 +121,9 @@ func HttpGet(url string, params map[string]string, headers map[string]string) (*
 	//http client
 	client := &http.Client{Timeout: 5 * time.Second} //Add the timeout,the reason is that the default client has no timeout set; if the remote server is unresponsive, you're going to have a bad day.
 	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
 
 	defer resp.Body.Close()
 	return resp, err
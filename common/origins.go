@@ -0,0 +1,33 @@
+package common
+
+import (
+	"regexp"
+	"strings"
+)
+
+// AllowOrigins are the origins allowed to call the api from a browser, * matches anything
+var AllowOrigins = []string{"http://10.*.*.*:*", "http://localhost:*", "http://127.0.0.1:*", "http://172.*.*.*:*", "http://192.*.*.*:*"}
+
+var allowOriginPatterns = originPatterns(AllowOrigins)
+
+// originPatterns compiles the origins the same way as the cors filter of beego
+func originPatterns(origins []string) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, 0, len(origins))
+	for _, origin := range origins {
+		pattern := regexp.QuoteMeta(origin)
+		pattern = strings.Replace(pattern, "\\*", ".*", -1)
+		pattern = strings.Replace(pattern, "\\?", ".", -1)
+		patterns = append(patterns, regexp.MustCompile("^"+pattern+"$"))
+	}
+	return patterns
+}
+
+// IsOriginAllowed tells if origin matches one of AllowOrigins
+func IsOriginAllowed(origin string) bool {
+	for _, pattern := range allowOriginPatterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
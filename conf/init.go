@@ -5,6 +5,7 @@ import (
 	"github.com/tidwall/gjson"
 	"io/ioutil"
 	"k8s.io/client-go/informers"
+	coordinationinformers "k8s.io/client-go/informers/coordination/v1"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
@@ -23,6 +24,7 @@ var (
 	CoreSharedInformerFactory informers.SharedInformerFactory
 	PodInformer               coreinformers.PodInformer
 	WorkerInformer            coreinformers.NodeInformer
+	LeaseInformer             coordinationinformers.LeaseInformer
 )
 
 const LOCAL = "local"
@@ -49,9 +51,6 @@ func init() {
 		k8sAuthConf := configuration.Get("conf.k8sAuth")
 		K8sAuth.file = k8sAuthConf.Get("file").String()
 	}
-
-	// init informer
-	InitInformer()
 }
 
 func setEnvironment() {
@@ -108,6 +107,8 @@ func InitInformer() {
 	// 创建 informers
 	PodInformer = CoreSharedInformerFactory.Core().V1().Pods()
 	WorkerInformer = CoreSharedInformerFactory.Core().V1().Nodes()
+	// kubelet heartbeats, one Lease per node in kube-node-lease
+	LeaseInformer = CoreSharedInformerFactory.Coordination().V1().Leases()
 }
 
 func InitKubeClient() kubernetes.Interface {
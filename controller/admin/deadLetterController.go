@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"node-controller/controller"
+	"node-controller/reconciler"
+	"strconv"
+)
+
+type DeadLetterController struct {
+	controller.ResultHandlerController
+}
+
+func (c *DeadLetterController) URLMapping() {
+	c.Mapping("List", c.List)
+	c.Mapping("Retry", c.Retry)
+	c.Mapping("Delete", c.Delete)
+}
+
+func (c *DeadLetterController) Prepare() {
+
+}
+
+// @Title List
+// @Description find the keys dropped after exhausting their retries, newest first
+// @Param	queue	query	string	false	"k8sworkerlistener, podlistener or VirtulMachineListener"
+// @Success 200 {object} []reconciler.DeadLetter success
+// @router / [get]
+func (c *DeadLetterController) List() {
+	c.Success(reconciler.DeadLetters.List(c.GetString("queue")))
+}
+
+// @Title Retry
+// @Description queue the key of a dead letter again with its retries reset
+// @Param	id	path	int	true	"the dead letter id"
+// @Success 200 {object} reconciler.DeadLetter success
+// @router /:id/retry [post]
+func (c *DeadLetterController) Retry() {
+	letter, err := reconciler.DeadLetters.Retry(c.deadLetterId())
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(letter)
+}
+
+// @Title Delete
+// @Description drop a dead letter
+// @Param	id	path	int	true	"the dead letter id"
+// @Success 200 {object} reconciler.DeadLetter success
+// @router /:id [delete]
+func (c *DeadLetterController) Delete() {
+	letter, err := reconciler.DeadLetters.Delete(c.deadLetterId())
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(letter)
+}
+
+func (c *DeadLetterController) deadLetterId() int64 {
+	id, err := strconv.ParseInt(c.Ctx.Input.Param(":id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.AbortBadRequestFormat("id")
+	}
+	return id
+}
@@ -0,0 +1,152 @@
+package alert
+
+import (
+	"encoding/json"
+	"node-controller/controller"
+	"node-controller/models"
+	"strconv"
+	"strings"
+)
+
+type AlertController struct {
+	controller.ResultHandlerController
+}
+
+// AckRequest is the body of the acknowledge and resolve requests
+type AckRequest struct {
+	User    string `json:"user"`
+	Comment string `json:"comment"`
+}
+
+type AlertListResult struct {
+	Total   int64           `json:"total"`
+	Records []models.Record `json:"records"`
+}
+
+func (c *AlertController) URLMapping() {
+	c.Mapping("List", c.List)
+	c.Mapping("Get", c.Get)
+	c.Mapping("Ack", c.Ack)
+	c.Mapping("Resolve", c.Resolve)
+}
+
+func (c *AlertController) Prepare() {
+
+}
+
+// @Title List
+// @Description find alert records, newest first
+// @Param	hostName	query	string	false	"the host name"
+// @Param	type	query	string	false	"the alert type"
+// @Param	status	query	string	false	"comma separated status, 0 to alert, 1 alerted, 2 resolved, 3 acknowledged"
+// @Param	offset	query	int	false	"offset of the first record"
+// @Param	limit	query	int	false	"max records returned, default 100"
+// @Success 200 {object} AlertListResult success
+// @router / [get]
+func (c *AlertController) List() {
+	query := models.RecordQuery{
+		HostName: c.Input().Get("hostName"),
+		Type:     c.Input().Get("type"),
+		Limit:    100,
+	}
+	if status := c.Input().Get("status"); status != "" {
+		for _, s := range strings.Split(status, ",") {
+			v, err := strconv.Atoi(s)
+			if err != nil {
+				c.AbortBadRequestFormat("status")
+			}
+			query.Status = append(query.Status, models.RecordStatus(v))
+		}
+	}
+	var err error
+	if offset := c.Input().Get("offset"); offset != "" {
+		if query.Offset, err = strconv.ParseInt(offset, 10, 64); err != nil || query.Offset < 0 {
+			c.AbortBadRequestFormat("offset")
+		}
+	}
+	if limit := c.Input().Get("limit"); limit != "" {
+		if query.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil || query.Limit <= 0 {
+			c.AbortBadRequestFormat("limit")
+		}
+	}
+
+	records, total, err := models.RecordMode.Query(query)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(AlertListResult{Total: total, Records: records})
+}
+
+// @Title Get
+// @Description find alert record by id
+// @Param	id	path	int	true	"the record id"
+// @Success 200 {object} models.Record success
+// @router /:id [get]
+func (c *AlertController) Get() {
+	record, err := models.RecordMode.GetById(c.recordId())
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(record)
+}
+
+// @Title Ack
+// @Description acknowledge an alert record, it is not sent any more
+// @Param	id	path	int	true	"the record id"
+// @Param	body	body	AckRequest	true	"the acking user and comment"
+// @Success 200 {object} models.Record success
+// @router /:id/ack [post]
+func (c *AlertController) Ack() {
+	id := c.recordId()
+	request := c.ackRequest()
+
+	record, err := models.RecordMode.Acknowledge(id, request.User, request.Comment)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(record)
+}
+
+// @Title Resolve
+// @Description resolve an alert record by hand
+// @Param	id	path	int	true	"the record id"
+// @Param	body	body	AckRequest	true	"the resolving user and comment"
+// @Success 200 {object} models.Record success
+// @router /:id/resolve [post]
+func (c *AlertController) Resolve() {
+	id := c.recordId()
+	request := c.ackRequest()
+
+	record, err := models.RecordMode.ResolveById(id, request.User, request.Comment)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(record)
+}
+
+func (c *AlertController) recordId() int64 {
+	id, err := strconv.ParseInt(c.Ctx.Input.Param(":id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.AbortBadRequestFormat("id")
+	}
+	return id
+}
+
+func (c *AlertController) ackRequest() *AckRequest {
+	request := &AckRequest{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, request); err != nil {
+		c.AbortBadRequestFormat("body")
+	}
+	if request.User == "" {
+		c.AbortBadRequestFormat("user")
+	}
+	return request
+}
@@ -0,0 +1,170 @@
+package alert
+
+import (
+	"encoding/json"
+	"node-controller/controller"
+	"node-controller/models"
+	"strconv"
+	"time"
+)
+
+type SilenceController struct {
+	controller.ResultHandlerController
+}
+
+// SilenceRequest is the body of the create and update requests.
+// At least one of hostName and labels is required, startTime defaults to now.
+type SilenceRequest struct {
+	HostName  string            `json:"hostName"`
+	Labels    map[string]string `json:"labels"`
+	StartTime *time.Time        `json:"startTime"`
+	EndTime   *time.Time        `json:"endTime"`
+	CreatedBy string            `json:"createdBy"`
+	Comment   string            `json:"comment"`
+}
+
+func (c *SilenceController) URLMapping() {
+	c.Mapping("List", c.List)
+	c.Mapping("Get", c.Get)
+	c.Mapping("Create", c.Create)
+	c.Mapping("Update", c.Update)
+	c.Mapping("Delete", c.Delete)
+}
+
+func (c *SilenceController) Prepare() {
+
+}
+
+// @Title List
+// @Description find silences, newest first
+// @Param	active	query	bool	false	"only the silences applying now"
+// @Success 200 {object} []models.Silence success
+// @router / [get]
+func (c *SilenceController) List() {
+	active, _ := c.GetBool("active", false)
+	silences, err := models.SilenceMode.List(active, time.Now())
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(silences)
+}
+
+// @Title Get
+// @Description find silence by id
+// @Param	id	path	int	true	"the silence id"
+// @Success 200 {object} models.Silence success
+// @router /:id [get]
+func (c *SilenceController) Get() {
+	silence, err := models.SilenceMode.GetById(c.silenceId())
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(silence)
+}
+
+// @Title Create
+// @Description create a silence, the alerts of the matching nodes are not sent until it ends
+// @Param	body	body	SilenceRequest	true	"the silence"
+// @Success 200 {object} models.Silence success
+// @router / [post]
+func (c *SilenceController) Create() {
+	request := c.silenceRequest()
+	if request.CreatedBy == "" {
+		c.AbortBadRequestFormat("createdBy")
+	}
+
+	silence := &models.Silence{
+		HostName:  request.HostName,
+		StartTime: request.StartTime,
+		EndTime:   request.EndTime,
+		CreatedBy: request.CreatedBy,
+		Comment:   request.Comment,
+	}
+	silence.SetLabels(request.Labels)
+	id, err := models.SilenceMode.Add(silence)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+	silence.Id = id
+
+	c.Success(silence)
+}
+
+// @Title Update
+// @Description update the matchers, time range or comment of a silence
+// @Param	id	path	int	true	"the silence id"
+// @Param	body	body	SilenceRequest	true	"the silence"
+// @Success 200 {object} models.Silence success
+// @router /:id [put]
+func (c *SilenceController) Update() {
+	id := c.silenceId()
+	request := c.silenceRequest()
+
+	silence, err := models.SilenceMode.GetById(id)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+	silence.HostName = request.HostName
+	silence.SetLabels(request.Labels)
+	silence.StartTime = request.StartTime
+	silence.EndTime = request.EndTime
+	silence.Comment = request.Comment
+	if err := models.SilenceMode.Update(silence); err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(silence)
+}
+
+// @Title Delete
+// @Description delete a silence, the alerts it muted are sent again
+// @Param	id	path	int	true	"the silence id"
+// @Success 200 {object} models.Silence success
+// @router /:id [delete]
+func (c *SilenceController) Delete() {
+	id := c.silenceId()
+	silence, err := models.SilenceMode.GetById(id)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+	if err := models.SilenceMode.Delete(id); err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(silence)
+}
+
+func (c *SilenceController) silenceId() int64 {
+	id, err := strconv.ParseInt(c.Ctx.Input.Param(":id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.AbortBadRequestFormat("id")
+	}
+	return id
+}
+
+func (c *SilenceController) silenceRequest() *SilenceRequest {
+	request := &SilenceRequest{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, request); err != nil {
+		c.AbortBadRequestFormat("body")
+	}
+	if request.HostName == "" && len(request.Labels) == 0 {
+		c.AbortBadRequest("Silence needs a hostName or labels to match !")
+	}
+	if request.StartTime == nil {
+		now := time.Now()
+		request.StartTime = &now
+	}
+	if request.EndTime == nil || !request.EndTime.After(*request.StartTime) {
+		c.AbortBadRequestFormat("endTime")
+	}
+	return request
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"github.com/astaxie/beego"
+	"node-controller/events"
+	"node-controller/models"
+	"node-controller/util/logs"
+	"time"
+)
+
+// alertEventsOverlap is how far back each poll of the records starts before the previous
+// one, the update times are stored in seconds and written with the clock of each replica
+const alertEventsOverlap = 30 * time.Second
+
+func alertEventsPollInterval() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("AlertEventsPollInterval", 5)) * time.Second
+}
+
+// alertEvents publishes the alerts created, acknowledged and resolved. The records are
+// written by the leader and by the api of any replica, so every replica polls them from
+// the database and its event streams get every change.
+type alertEvents struct {
+	// since is when the last poll started
+	since time.Time
+	// published are the events published for the records updated in the overlap
+	published map[int64]publishedAlert
+}
+
+type publishedAlert struct {
+	event      string
+	updateTime time.Time
+}
+
+func newAlertEvents(now time.Time) *alertEvents {
+	return &alertEvents{since: now, published: map[int64]publishedAlert{}}
+}
+
+// alertEvent is the event telling the last change of record
+func alertEvent(record *models.Record) string {
+	switch record.Status {
+	case models.RecordResolved:
+		return events.AlertResolved
+	case models.RecordAcked:
+		return events.AlertAcknowledged
+	default:
+		return events.AlertCreated
+	}
+}
+
+// poll publishes the changes of the records since the last poll
+func (a *alertEvents) poll() {
+	defer recoverException()
+	now := time.Now()
+	records, err := models.RecordMode.ListUpdatedSince(a.since.Add(-alertEventsOverlap))
+	if err != nil {
+		logs.Error("failed to list the records updated since %s: %s", a.since.Format("2006-01-02 15:04:05"), err.Error())
+		return
+	}
+	for i := range records {
+		record := &records[i]
+		event := alertEvent(record)
+		if a.published[record.Id].event == event {
+			continue
+		}
+		events.Events.Publish(event, *record)
+		updateTime := now
+		if record.UpdateTime != nil {
+			updateTime = *record.UpdateTime
+		}
+		a.published[record.Id] = publishedAlert{event: event, updateTime: updateTime}
+	}
+	a.since = now
+	for id, published := range a.published {
+		if published.updateTime.Before(now.Add(-2 * alertEventsOverlap)) {
+			delete(a.published, id)
+		}
+	}
+}
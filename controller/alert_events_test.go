@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"node-controller/events"
+	"node-controller/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// received returns the types of the events sent to s so far
+func received(s *events.Subscription) []string {
+	types := make([]string, 0)
+	for {
+		select {
+		case event := <-s.C:
+			types = append(types, event.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestAlertEventsPoll(t *testing.T) {
+	useTestDB(t)
+	before := time.Now().Add(-time.Hour)
+	alerts := newAlertEvents(time.Now())
+	s := events.Events.Subscribe(0)
+	defer s.Close()
+
+	record := &models.Record{HostName: "node", Type: models.RecordTypeNodeNotReady, StartTime: &before}
+	steps := []struct {
+		name   string
+		change func() error
+		want   []string
+	}{
+		{"created", func() error { return models.RecordMode.Add(record) }, []string{events.AlertCreated}},
+		{"unchanged", func() error { return nil }, []string{}},
+		{"notified", func() error { return models.RecordMode.MarkNotified([]int64{record.Id}, time.Now()) }, []string{}},
+		{
+			"acknowledged",
+			func() error {
+				_, err := models.RecordMode.Acknowledge(record.Id, "user", "")
+				return err
+			},
+			[]string{events.AlertAcknowledged},
+		},
+		{"resolved", func() error { return models.RecordMode.Resolve(record, time.Now()) }, []string{events.AlertResolved}},
+		{"resolved before", func() error { return nil }, []string{}},
+	}
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		alerts.poll()
+		if got := received(s); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: events = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
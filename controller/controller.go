@@ -1,10 +1,17 @@
 package controller
 
 import (
+	"context"
+	"fmt"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	clientSet "node-controller/generated/clientset/versioned"
 	"node-controller/generated/informers/externalversions"
+	"node-controller/util/logs"
+	"sync"
+	"time"
 )
 
 type VirtulMachineController struct {
@@ -13,23 +20,91 @@ type VirtulMachineController struct {
 	SharedInformerFactory     externalversions.SharedInformerFactory
 	CoreSharedInformerFactory informers.SharedInformerFactory
 	Stop                      chan struct{}
+
+	// informers of the listeners, ready once they have synced
+	synced    []cache.InformerSynced
+	listeners []listener
+}
+
+// listener reconciles the objects of its informers with workers, see reconciler.Controller
+type listener interface {
+	Run(stop <-chan struct{}) error
+	// ShutDown returns once the keys queued are reconciled
+	ShutDown()
 }
 
 func (c *VirtulMachineController) VirtulMachineListener() {
 	nlc := BuildVirtulMachineListenerController(
+		c.KubeClientSet,
 		c.VirtulMachineClientSet,
-		c.SharedInformerFactory.Nodecontroller().V1alpha1().VirtulMachines())
-	nlc.Run(c.Stop)
+		c.SharedInformerFactory.Nodecontroller().V1alpha1().VirtulMachines(),
+		c.CoreSharedInformerFactory.Core().V1().Nodes())
+	c.synced = append(c.synced, nlc.nodeSynced, nlc.workerSynced)
+	c.listeners = append(c.listeners, nlc.reconciler)
 }
 
 func (c *VirtulMachineController) PodListener() {
-	plc := BuildPodListenerController(c.KubeClientSet)
-	plc.Run(c.Stop)
+	plc := BuildPodListenerController(
+		c.KubeClientSet,
+		c.CoreSharedInformerFactory.Core().V1().Pods(),
+		c.CoreSharedInformerFactory.Core().V1().Nodes())
+	c.synced = append(c.synced, plc.podSynced)
+	c.listeners = append(c.listeners, plc.reconciler)
 }
 
 func (c *VirtulMachineController) WorkerListener() {
-	wlc := BuildK8sWorkerController(c.KubeClientSet)
-	wlc.Run(c.Stop)
+	wlc := BuildK8sWorkerController(
+		c.KubeClientSet,
+		c.CoreSharedInformerFactory.Core().V1().Nodes(),
+		c.CoreSharedInformerFactory.Core().V1().Pods(),
+		c.CoreSharedInformerFactory.Coordination().V1().Leases())
+	c.synced = append(c.synced, wlc.workerSynced, wlc.podSynced, wlc.leaseSynced)
+	c.listeners = append(c.listeners, wlc.reconciler)
+	workers = wlc
+
+	go wait.Until(wlc.checkHeartbeats, nodeHeartbeatCheckInterval(), c.Stop)
+}
+
+// Run starts the informers and the workers of the listeners once their caches have synced
+func (c *VirtulMachineController) Run() {
+	c.CoreSharedInformerFactory.Start(c.Stop)
+	c.SharedInformerFactory.Start(c.Stop)
+	for _, l := range c.listeners {
+		go l.Run(c.Stop)
+	}
+	// every replica streams the changes of the alerts, whoever wrote them
+	go wait.Until(newAlertEvents(time.Now()).poll, alertEventsPollInterval(), c.Stop)
+}
+
+// Synced returns an error until the informers of the listeners have synced
+func (c *VirtulMachineController) Synced() error {
+	for _, synced := range c.synced {
+		if !synced() {
+			return fmt.Errorf("informer caches are not synced")
+		}
+	}
+	return nil
+}
 
-	go wlc.cacheNodeList()
+// ShutDown drains the workqueues of the listeners, the items left when ctx is done are dropped
+func (c *VirtulMachineController) ShutDown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for _, l := range c.listeners {
+			wg.Add(1)
+			go func(l listener) {
+				defer wg.Done()
+				l.ShutDown()
+			}(l)
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logs.Info("workqueues drained")
+	case <-ctx.Done():
+		logs.Warning("workqueues not drained: %s", ctx.Err().Error())
+	}
 }
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"github.com/astaxie/beego/orm"
+	_ "github.com/mattn/go-sqlite3"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"node-controller/common"
+	"node-controller/leader"
+	"node-controller/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testDB sync.Once
+
+// useTestDB points the models to an in-memory sqlite database, emptied for each test,
+// and drops the recoveries queued by the tests before
+func useTestDB(t *testing.T) {
+	testDB.Do(func() {
+		if err := orm.RegisterDriver("sqlite3", orm.DRSqlite); err != nil {
+			panic(err)
+		}
+		// a single connection keeps the in-memory database alive and shared
+		if err := orm.RegisterDataBase("default", "sqlite3", "file::memory:?cache=shared", 1, 1); err != nil {
+			panic(err)
+		}
+		if err := orm.RunSyncdb("default", false, false); err != nil {
+			panic(err)
+		}
+	})
+	for _, table := range []string{models.TableNameRecord, models.TableNameSilence, models.TableNameAudit} {
+		if _, err := models.Ormer().Raw("DELETE FROM " + table).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	common.TakeRecovers()
+}
+
+// newTestWorkerController is a K8sWorkerController leading, with synced informers over
+// a fake clientset holding objects. Closing stop stops the informers.
+func newTestWorkerController(t *testing.T, stop chan struct{}, objects ...runtime.Object) (*K8sWorkerController, kubernetes.Interface) {
+	client := fake.NewSimpleClientset(objects...)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	c := BuildK8sWorkerController(
+		client,
+		factory.Core().V1().Nodes(),
+		factory.Core().V1().Pods(),
+		factory.Coordination().V1().Leases())
+	factory.Start(stop)
+	for informerType, synced := range factory.WaitForCacheSync(stop) {
+		if !synced {
+			t.Fatalf("%s not synced", informerType)
+		}
+	}
+	if err := leader.Run(client, stop); err != nil {
+		t.Fatal(err)
+	}
+	return c, client
+}
+
+// eventually waits for condition, which is checked against the informer caches
+func eventually(t *testing.T, condition func() bool) {
+	err := wait.Poll(time.Millisecond, time.Second, func() (bool, error) {
+		return condition(), nil
+	})
+	if err != nil {
+		t.Fatal("condition not met in time")
+	}
+}
+
+// openRecords returns the types of the open records of nodeName
+func openRecords(t *testing.T, nodeName string) []string {
+	var records []models.Record
+	_, err := models.Ormer().QueryTable(new(models.Record)).
+		Filter("HostName", nodeName).
+		Filter("Status__in", models.RecordTobeAltert, models.RecordAlerted, models.RecordAcked).
+		OrderBy("Id").
+		All(&records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make([]string, 0, len(records))
+	for _, record := range records {
+		types = append(types, record.Type)
+	}
+	return types
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"node-controller/util/logs"
+)
+
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// DrainOptions controls which pods are evicted from a node
+type DrainOptions struct {
+	// GracePeriodSeconds overrides the termination grace period of the evicted pods, negative uses the pod's own
+	GracePeriodSeconds int64 `json:"gracePeriodSeconds"`
+	// IgnoreDaemonSets skips pods managed by a DaemonSet instead of failing the drain
+	IgnoreDaemonSets bool `json:"ignoreDaemonSets"`
+	// DeleteEmptyDirData evicts pods using emptyDir volumes, whose data is lost
+	DeleteEmptyDirData bool `json:"deleteEmptyDirData"`
+}
+
+// Cordon marks node unschedulable, or schedulable again when unschedulable is false.
+// A node cordoned by the spec of its VirtulMachine is not made schedulable again.
+func Cordon(kubeClient kubernetes.Interface, nodeName string, unschedulable bool) error {
+	if !unschedulable {
+		node, err := kubeClient.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if node.Annotations[AnnotationManagedUnschedulable] == "true" {
+			return managedByVirtulMachine("cordon of node", nodeName)
+		}
+	}
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := kubeClient.CoreV1().Nodes().Patch(nodeName, types.StrategicMergePatchType, []byte(patch))
+	return err
+}
+
+// DeletePods deletes pods without going through the Eviction API, PodDisruptionBudgets are
+// not checked. A negative gracePeriodSeconds uses the pod's own.
+func DeletePods(kubeClient kubernetes.Interface, pods []v1.Pod, gracePeriodSeconds int64) error {
+	options := &metav1.DeleteOptions{}
+	if gracePeriodSeconds >= 0 {
+		options.GracePeriodSeconds = &gracePeriodSeconds
+	}
+	for _, pod := range pods {
+		err := kubeClient.CoreV1().Pods(pod.Namespace).Delete(pod.Name, options)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete pod %s/%s: %s", pod.Namespace, pod.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// EvictPods makes one eviction pass over the pods of node through the Eviction API.
+// Evictions refused by a PodDisruptionBudget are left for the next pass.
+// It returns the pods still running on node, an empty result means the node is drained.
+func EvictPods(kubeClient kubernetes.Interface, nodeName string, options DrainOptions) ([]v1.Pod, error) {
+	pods, err := drainablePods(kubeClient, nodeName, options)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := make([]v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		remaining = append(remaining, pod)
+		if pod.DeletionTimestamp != nil {
+			// already evicted, waiting for the pod to terminate
+			continue
+		}
+		eviction := &policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+		}
+		if options.GracePeriodSeconds >= 0 {
+			gracePeriod := options.GracePeriodSeconds
+			eviction.DeleteOptions = &metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod}
+		}
+		err := kubeClient.PolicyV1beta1().Evictions(pod.Namespace).Evict(eviction)
+		switch {
+		case err == nil:
+			logs.Info("pod %s/%s evicted from node %s", pod.Namespace, pod.Name, nodeName)
+		case errors.IsNotFound(err):
+			remaining = remaining[:len(remaining)-1]
+		case errors.IsTooManyRequests(err):
+			logs.Info("eviction of pod %s/%s blocked by disruption budget: %s", pod.Namespace, pod.Name, err.Error())
+		default:
+			return nil, fmt.Errorf("failed to evict pod %s/%s: %s", pod.Namespace, pod.Name, err.Error())
+		}
+	}
+	return remaining, nil
+}
+
+// drainablePods lists the pods of node that have to be evicted before it can be removed.
+func drainablePods(kubeClient kubernetes.Interface, nodeName string, options DrainOptions) ([]v1.Pod, error) {
+	podList, err := kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]v1.Pod, 0, len(podList.Items))
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+			// static pods can't be evicted through the api server
+			continue
+		}
+		if controllerRef := metav1.GetControllerOf(&pod); controllerRef != nil && controllerRef.Kind == "DaemonSet" {
+			if !options.IgnoreDaemonSets {
+				return nil, fmt.Errorf("pod %s/%s is managed by DaemonSet %s", pod.Namespace, pod.Name, controllerRef.Name)
+			}
+			continue
+		}
+		if !options.DeleteEmptyDirData && hasEmptyDir(&pod) {
+			return nil, fmt.Errorf("pod %s/%s uses emptyDir volumes", pod.Namespace, pod.Name)
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+func hasEmptyDir(pod *v1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
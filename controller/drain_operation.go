@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+	"net/http"
+	erroresult "node-controller/models/response/errors"
+	"node-controller/util/logs"
+	"sync"
+	"time"
+)
+
+// drain operation states
+const (
+	OperationRunning   = "Running"
+	OperationSucceeded = "Succeeded"
+	OperationFailed    = "Failed"
+)
+
+// finished operations are kept for polling this long
+const operationRetention = time.Hour
+
+// DrainOperation is the progress of an asynchronous drain
+type DrainOperation struct {
+	Id      string       `json:"id"`
+	Node    string       `json:"node"`
+	Options DrainOptions `json:"options"`
+	Timeout string       `json:"timeout"`
+	DryRun  bool         `json:"dryRun"`
+	Status  string       `json:"status"`
+	Message string       `json:"message,omitempty"`
+	// Total is the number of pods to evict when the drain started
+	Total int `json:"total"`
+	// Pods are the pods still on the node, or those that would be evicted by a dry run
+	Pods      []string   `json:"pods"`
+	StartTime time.Time  `json:"startTime"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+}
+
+// operations are kept in memory, each replica only knows the drains it started
+var (
+	operationLock sync.Mutex
+	operations    = map[string]*DrainOperation{}
+)
+
+// GetDrainOperation returns a copy of the drain operation id
+func GetDrainOperation(id string) (*DrainOperation, bool) {
+	operationLock.Lock()
+	defer operationLock.Unlock()
+	operation, ok := operations[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *operation
+	copied.Pods = append([]string{}, operation.Pods...)
+	return &copied, true
+}
+
+// StartDrain cordons nodeName and evicts its pods in the background until none is left
+// or timeout is reached. A dry run only lists the pods that would be evicted.
+func StartDrain(kubeClient kubernetes.Interface, nodeName string, options DrainOptions, timeout time.Duration, dryRun bool) (*DrainOperation, error) {
+	operationLock.Lock()
+	now := time.Now()
+	for id, operation := range operations {
+		if operation.EndTime != nil && now.Sub(*operation.EndTime) > operationRetention {
+			delete(operations, id)
+			continue
+		}
+		if operation.Node == nodeName && operation.Status == OperationRunning && !dryRun {
+			operationLock.Unlock()
+			return nil, &erroresult.ErrorResult{
+				Code:    http.StatusConflict,
+				SubCode: http.StatusConflict,
+				Msg:     fmt.Sprintf("node %s is being drained by operation %s", nodeName, id),
+			}
+		}
+	}
+	operation := &DrainOperation{
+		Id:        "drain-" + rand.String(10),
+		Node:      nodeName,
+		Options:   options,
+		Timeout:   timeout.String(),
+		DryRun:    dryRun,
+		Status:    OperationRunning,
+		Pods:      []string{},
+		StartTime: now,
+	}
+	operations[operation.Id] = operation
+	started := *operation
+	operationLock.Unlock()
+
+	go runDrain(kubeClient, operation.Id, nodeName, options, timeout, dryRun)
+	return &started, nil
+}
+
+func updateOperation(id string, update func(operation *DrainOperation)) {
+	operationLock.Lock()
+	defer operationLock.Unlock()
+	if operation, ok := operations[id]; ok {
+		update(operation)
+	}
+}
+
+func finishOperation(id string, status string, message string) {
+	updateOperation(id, func(operation *DrainOperation) {
+		now := time.Now()
+		operation.Status = status
+		operation.Message = message
+		operation.EndTime = &now
+	})
+	logs.Info("drain operation %s %s: %s", id, status, message)
+}
+
+func podNames(pods []v1.Pod) []string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Namespace+"/"+pod.Name)
+	}
+	return names
+}
+
+func runDrain(kubeClient kubernetes.Interface, id string, nodeName string, options DrainOptions, timeout time.Duration, dryRun bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			logs.Error(err)
+			finishOperation(id, OperationFailed, fmt.Sprintf("%v", err))
+		}
+	}()
+
+	if dryRun {
+		pods, err := drainablePods(kubeClient, nodeName, options)
+		if err != nil {
+			finishOperation(id, OperationFailed, err.Error())
+			return
+		}
+		updateOperation(id, func(operation *DrainOperation) {
+			operation.Total = len(pods)
+			operation.Pods = podNames(pods)
+		})
+		finishOperation(id, OperationSucceeded, fmt.Sprintf("%d pods would be evicted", len(pods)))
+		return
+	}
+
+	if err := Cordon(kubeClient, nodeName, true); err != nil {
+		finishOperation(id, OperationFailed, fmt.Sprintf("failed to cordon node %s: %s", nodeName, err.Error()))
+		return
+	}
+	logs.Info("node %s cordoned by drain operation %s", nodeName, id)
+
+	deadline := time.Now().Add(timeout)
+	first := true
+	for {
+		remaining, err := EvictPods(kubeClient, nodeName, options)
+		if err != nil {
+			finishOperation(id, OperationFailed, err.Error())
+			return
+		}
+		updateOperation(id, func(operation *DrainOperation) {
+			if first {
+				operation.Total = len(remaining)
+			}
+			operation.Pods = podNames(remaining)
+		})
+		first = false
+		if len(remaining) == 0 {
+			finishOperation(id, OperationSucceeded, fmt.Sprintf("node %s drained", nodeName))
+			return
+		}
+		if timeout > 0 && time.Now().After(deadline) {
+			finishOperation(id, OperationFailed, fmt.Sprintf("%d pods still on node %s after %s", len(remaining), nodeName, timeout))
+			return
+		}
+		time.Sleep(drainPollInterval)
+	}
+}
@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newDrainPod(name string, mutate func(pod *v1.Pod)) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       v1.PodSpec{NodeName: "node"},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	}
+	if mutate != nil {
+		mutate(pod)
+	}
+	return pod
+}
+
+// newEvictionClient is a fake clientset holding objects whose evictions delete the pod, but
+// for the pods in refused whose evictions fail with their error. evicted returns the pods
+// evicted so far.
+func newEvictionClient(refused map[string]error, objects ...runtime.Object) (client *fake.Clientset, evicted func() []string) {
+	client = fake.NewSimpleClientset(objects...)
+	var lock sync.Mutex
+	names := make([]string, 0)
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1beta1.Eviction)
+		if err, ok := refused[eviction.Name]; ok {
+			return true, nil, err
+		}
+		if err := client.Tracker().Delete(v1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name); err != nil {
+			return true, nil, err
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		names = append(names, eviction.Name)
+		return true, nil, nil
+	})
+	return client, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		evicted := append([]string{}, names...)
+		sort.Strings(evicted)
+		return evicted
+	}
+}
+
+func TestEvictPods(t *testing.T) {
+	daemonSetPod := newDrainPod("daemon", func(pod *v1.Pod) {
+		isController := true
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "ds", Controller: &isController}}
+	})
+	mirrorPod := newDrainPod("static", func(pod *v1.Pod) {
+		pod.Annotations = map[string]string{mirrorPodAnnotation: "hash"}
+	})
+	completedPod := newDrainPod("completed", func(pod *v1.Pod) {
+		pod.Status.Phase = v1.PodSucceeded
+	})
+	emptyDirPod := newDrainPod("cache", func(pod *v1.Pod) {
+		pod.Spec.Volumes = []v1.Volume{{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+	})
+	terminatingPod := newDrainPod("terminating", func(pod *v1.Pod) {
+		now := metav1.Now()
+		pod.DeletionTimestamp = &now
+	})
+
+	pdbBlocked := errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)
+	gone := errors.NewNotFound(v1.Resource("pods"), "b")
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		options DrainOptions
+		refused map[string]error
+		// wantRemaining are the pods left on the node by the first pass, the evicted pods stay
+		// until they are gone, wantLeft those left by the next pass
+		wantRemaining []string
+		wantLeft      []string
+		wantEvicted   []string
+		wantErr       bool
+	}{
+		{"no pods", nil, DrainOptions{}, nil, []string{}, []string{}, []string{}, false},
+		{"evicted", []runtime.Object{newDrainPod("a", nil), newDrainPod("b", nil)}, DrainOptions{}, nil, []string{"a", "b"}, []string{}, []string{"a", "b"}, false},
+		{
+			"blocked by a disruption budget",
+			[]runtime.Object{newDrainPod("a", nil), newDrainPod("b", nil)},
+			DrainOptions{},
+			map[string]error{"b": pdbBlocked},
+			[]string{"a", "b"},
+			[]string{"b"},
+			[]string{"a"},
+			false,
+		},
+		{
+			"already gone",
+			[]runtime.Object{newDrainPod("a", nil), newDrainPod("b", nil)},
+			DrainOptions{},
+			map[string]error{"b": gone},
+			[]string{"a"},
+			[]string{},
+			[]string{"a"},
+			false,
+		},
+		{
+			"eviction failed",
+			[]runtime.Object{newDrainPod("b", nil)},
+			DrainOptions{},
+			map[string]error{"b": errors.NewInternalError(fmt.Errorf("etcd unavailable"))},
+			nil,
+			nil,
+			[]string{},
+			true,
+		},
+		{"terminating", []runtime.Object{terminatingPod}, DrainOptions{}, nil, []string{"terminating"}, []string{"terminating"}, []string{}, false},
+		{"static and completed pods left", []runtime.Object{mirrorPod, completedPod}, DrainOptions{}, nil, []string{}, []string{}, []string{}, false},
+		{"daemon set pod", []runtime.Object{daemonSetPod, newDrainPod("a", nil)}, DrainOptions{}, nil, nil, nil, []string{}, true},
+		{"daemon set pod ignored", []runtime.Object{daemonSetPod}, DrainOptions{IgnoreDaemonSets: true}, nil, []string{}, []string{}, []string{}, false},
+		{"emptyDir data", []runtime.Object{emptyDirPod}, DrainOptions{}, nil, nil, nil, []string{}, true},
+		{"emptyDir data deleted", []runtime.Object{emptyDirPod}, DrainOptions{DeleteEmptyDirData: true}, nil, []string{"cache"}, []string{}, []string{"cache"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, evicted := newEvictionClient(test.refused, test.objects...)
+			remaining, err := EvictPods(client, "node", test.options)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("EvictPods() error = %v, want error %v", err, test.wantErr)
+			}
+			if err == nil {
+				if got := podNames(remaining); !reflect.DeepEqual(got, prefixed(test.wantRemaining)) {
+					t.Errorf("remaining = %v, want %v", got, prefixed(test.wantRemaining))
+				}
+				if remaining, err = EvictPods(client, "node", test.options); err != nil {
+					t.Fatalf("EvictPods() again = %v", err)
+				}
+				if got := podNames(remaining); !reflect.DeepEqual(got, prefixed(test.wantLeft)) {
+					t.Errorf("left = %v, want %v", got, prefixed(test.wantLeft))
+				}
+			}
+			if got := evicted(); !reflect.DeepEqual(got, test.wantEvicted) {
+				t.Errorf("evicted = %v, want %v", got, test.wantEvicted)
+			}
+		})
+	}
+}
+
+// prefixed are the names of the pods of the default namespace as podNames returns them
+func prefixed(names []string) []string {
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		result = append(result, "default/"+name)
+	}
+	return result
+}
+
+// waitOperation waits for the drain operation id to finish, a drain checks the node again
+// after drainPollInterval for the evicted pods to be gone
+func waitOperation(t *testing.T, id string) *DrainOperation {
+	var operation *DrainOperation
+	err := wait.Poll(10*time.Millisecond, drainPollInterval+time.Second, func() (bool, error) {
+		operation, _ = GetDrainOperation(id)
+		return operation != nil && operation.Status != OperationRunning, nil
+	})
+	if err != nil {
+		t.Fatalf("drain operation %s not finished: %v", id, err)
+	}
+	return operation
+}
+
+func TestStartDrain(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	tests := []struct {
+		name    string
+		refused map[string]error
+		timeout time.Duration
+		dryRun  bool
+		// want are the status and pods of the operation once finished
+		wantStatus   string
+		wantPods     []string
+		wantEvicted  []string
+		wantCordoned bool
+		wantTotal    int
+	}{
+		{"drained", nil, time.Minute, false, OperationSucceeded, []string{}, []string{"a", "b"}, true, 2},
+		{"dry run", nil, time.Minute, true, OperationSucceeded, prefixed([]string{"a", "b"}), []string{}, false, 2},
+		{"timed out", map[string]error{"b": errors.NewTooManyRequests("disruption budget", 10)}, time.Nanosecond, false, OperationFailed, prefixed([]string{"a", "b"}), []string{"a"}, true, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, evicted := newEvictionClient(test.refused, node.DeepCopy(), newDrainPod("a", nil), newDrainPod("b", nil))
+			started, err := StartDrain(client, "node", DrainOptions{GracePeriodSeconds: -1}, test.timeout, test.dryRun)
+			if err != nil {
+				t.Fatalf("StartDrain() = %v", err)
+			}
+			if started.Status != OperationRunning {
+				t.Errorf("started operation status = %s, want %s", started.Status, OperationRunning)
+			}
+
+			operation := waitOperation(t, started.Id)
+			if operation.Status != test.wantStatus {
+				t.Errorf("status = %s (%s), want %s", operation.Status, operation.Message, test.wantStatus)
+			}
+			if operation.Total != test.wantTotal {
+				t.Errorf("total = %d, want %d", operation.Total, test.wantTotal)
+			}
+			if !reflect.DeepEqual(operation.Pods, test.wantPods) {
+				t.Errorf("pods = %v, want %v", operation.Pods, test.wantPods)
+			}
+			if got := evicted(); !reflect.DeepEqual(got, test.wantEvicted) {
+				t.Errorf("evicted = %v, want %v", got, test.wantEvicted)
+			}
+			drained, err := client.CoreV1().Nodes().Get("node", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if drained.Spec.Unschedulable != test.wantCordoned {
+				t.Errorf("unschedulable = %v, want %v", drained.Spec.Unschedulable, test.wantCordoned)
+			}
+		})
+	}
+}
+
+func TestStartDrainRunning(t *testing.T) {
+	operationLock.Lock()
+	operations["drain-running"] = &DrainOperation{Id: "drain-running", Node: "busy", Status: OperationRunning}
+	operationLock.Unlock()
+	defer func() {
+		operationLock.Lock()
+		delete(operations, "drain-running")
+		operationLock.Unlock()
+	}()
+
+	client, _ := newEvictionClient(nil)
+	if _, err := StartDrain(client, "busy", DrainOptions{}, time.Minute, false); err == nil {
+		t.Errorf("second drain of a node started, want a conflict")
+	}
+	// a dry run changes nothing, it may run along
+	operation, err := StartDrain(client, "busy", DrainOptions{}, time.Minute, true)
+	if err != nil {
+		t.Fatalf("dry run refused: %v", err)
+	}
+	waitOperation(t, operation.Id)
+}
@@ -1,34 +1,43 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
+	coordinationinformers "k8s.io/client-go/informers/coordination/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	coordinationlisters "k8s.io/client-go/listers/coordination/v1"
 	CoreListerV1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
 	"node-controller/common"
-	"node-controller/conf"
+	"node-controller/events"
 	"node-controller/models"
+	"node-controller/reconciler"
 	"node-controller/util/logs"
 	"sort"
 	"strconv"
 	"time"
 )
 
-var NodeList *NodeListResult
-
 type K8sWorkerController struct {
 	kubeClientset kubernetes.Interface
 	podList       CoreListerV1.PodLister
 	workerList    CoreListerV1.NodeLister
 	workerSynced  cache.InformerSynced
-	workqueue     workqueue.RateLimitingInterface
+	podSynced     cache.InformerSynced
+	reconciler    *reconciler.Controller
+	outages       *outages
+	problems      *nodeProblems
+	leaseList     coordinationlisters.LeaseLister
+	leaseSynced   cache.InformerSynced
+	// nodes whose open heartbeat records were looked up, only used by checkHeartbeats
+	heartbeatsChecked map[string]bool
+	nodes             *nodeStore
 }
 
 type ResourceSummary struct {
@@ -50,6 +59,12 @@ type NodeListResult struct {
 	CpuSummary    ResourceSummary `json:"cpuSummary"`
 	MemorySummary ResourceSummary `json:"memorySummary"`
 	Nodes         []Node          `json:"nodes"`
+	// GeneratedAt is when the list was built
+	GeneratedAt time.Time `json:"generatedAt"`
+	// Total is the number of nodes matching the query, Nodes is the page of them
+	Total    int `json:"total"`
+	Page     int `json:"page,omitempty"`
+	PageSize int `json:"pageSize,omitempty"`
 }
 
 type Node struct {
@@ -73,233 +88,192 @@ type NodeSpec struct {
 type NodeStatus struct {
 	Capacity map[v1.ResourceName]string `json:"capacity,omitempty"`
 	NodeInfo v1.NodeSystemInfo          `json:"nodeInfo,omitempty"`
+	// why the node is unhealthy, most severe first
+	Problems []NodeProblem `json:"problems,omitempty"`
+	Usage    NodeUsage     `json:"usage"`
+}
+
+// NodeUsage is what the active pods of a node request out of its allocatable resources
+type NodeUsage struct {
+	// unit m
+	Cpu ResourceUsage `json:"cpu"`
+	// unit Byte
+	Memory ResourceUsage `json:"memory"`
+	// count of pods
+	Pods ResourceUsage `json:"pods"`
 }
 
-type K8sWorkerQueueObj struct {
-	Key    string   `json:"key"`
-	OldObj *v1.Node `json:"old_obj"`
-	Ope    string   `json:"ope"` // add / update / delete
+type ResourceUsage struct {
+	Allocatable int64 `json:"allocatable"`
+	Requested   int64 `json:"requested"`
+	// Percent is 0 when nothing is allocatable
+	Percent int64 `json:"percent"`
 }
 
-func BuildK8sWorkerController(kubeclientset kubernetes.Interface) *K8sWorkerController {
+func BuildK8sWorkerController(
+	kubeclientset kubernetes.Interface,
+	workerInformer coreinformers.NodeInformer,
+	podInformer coreinformers.PodInformer,
+	leaseInformer coordinationinformers.LeaseInformer) *K8sWorkerController {
 	controller := &K8sWorkerController{
 		kubeClientset: kubeclientset,
-		podList:       conf.PodInformer.Lister(),
-		workerList:    conf.WorkerInformer.Lister(),
-		workerSynced:  conf.WorkerInformer.Informer().HasSynced,
-		workqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "k8sworkerlistener"),
+		podList:       podInformer.Lister(),
+		workerList:    workerInformer.Lister(),
+		workerSynced:  workerInformer.Informer().HasSynced,
+		podSynced:     podInformer.Informer().HasSynced,
+		outages:       &outages{recorded: map[string]time.Time{}},
+		problems:      &nodeProblems{recorded: map[string]map[string]time.Time{}, seen: map[string]map[string]time.Time{}},
+		leaseList:     leaseInformer.Lister(),
+		leaseSynced:   leaseInformer.Informer().HasSynced,
+
+		heartbeatsChecked: map[string]bool{},
+		nodes:             newNodeStore(),
 	}
+	controller.reconciler = reconciler.New(reconciler.Config{
+		Name:         "k8sworkerlistener",
+		ConfigPrefix: "WorkerListener",
+		Informer:     workerInformer.Informer(),
+		Reconciler:   reconciler.ReconcilerFunc(controller.sync),
+		Hooks: reconciler.Hooks{
+			OnAdd:    controller.onAdd,
+			OnUpdate: controller.onUpdate,
+			OnDelete: controller.onDelete,
+		},
+		WaitFor: []cache.InformerSynced{controller.podSynced, controller.leaseSynced},
+		// the node last reconciled tells the transitions apart, and routes the alert once deleted
+		KeepLast: true,
+	})
 
-	conf.WorkerInformer.Informer().AddEventHandler(
+	podInformer.Informer().AddEventHandler(
 		cache.ResourceEventHandlerFuncs{
-			AddFunc:    controller.addFunc,
-			UpdateFunc: controller.updateFunc,
-			DeleteFunc: controller.deleteFunc,
+			AddFunc:    controller.nodes.addPod,
+			UpdateFunc: controller.nodes.updatePod,
+			DeleteFunc: controller.nodes.deletePod,
 		})
 
 	return controller
 }
 
-func (c *K8sWorkerController) addFunc(obj interface{}) {
-	var key string
-	var err error
-	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
-		runtime.HandleError(err)
-		return
-	}
-
-	rqo := &K8sWorkerQueueObj{
-		Key:    key,
-		OldObj: nil,
-		Ope:    common.ADD,
-	}
-
-	c.workqueue.AddRateLimited(rqo)
+func (c *K8sWorkerController) onAdd(obj interface{}) {
+	worker := obj.(*v1.Node)
+	c.nodes.setNode(worker)
+	c.publishWorker(nil, worker)
 }
 
-func (c *K8sWorkerController) updateFunc(oldObj, newObj interface{}) {
+func (c *K8sWorkerController) onUpdate(oldObj, newObj interface{}) {
 	oldWorker := oldObj.(*v1.Node)
 	newWorker := newObj.(*v1.Node)
-	if oldWorker.ResourceVersion == newWorker.ResourceVersion {
-		return
-	}
-
-	var key string
-	var err error
-	if key, err = cache.MetaNamespaceKeyFunc(newWorker); err != nil {
-		runtime.HandleError(err)
-		return
-	}
-	rqo := &K8sWorkerQueueObj{
-		Key:    key,
-		OldObj: oldWorker,
-		Ope:    common.UPDATE,
-	}
-	c.workqueue.AddRateLimited(rqo)
-}
-
-func (c *K8sWorkerController) deleteFunc(obj interface{}) {
-	var key string
-	var err error
-	if key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
-		runtime.HandleError(err)
-		return
-	}
-
-	rqo := &K8sWorkerQueueObj{
-		Key:    key,
-		OldObj: nil,
-		Ope:    common.DELETE,
-	}
-
-	c.workqueue.AddRateLimited(rqo)
-}
-
-func (c *K8sWorkerController) Run(stop <-chan struct{}) error {
-	//同步缓存
-	if ok := cache.WaitForCacheSync(stop); !ok {
-		logs.Error("同步缓存失败")
-		return fmt.Errorf("failed to wait for caches to sync")
-	}
-
-	go wait.Until(c.runworker, time.Second*10, stop)
-	return nil
-}
-
-func (c *K8sWorkerController) runworker() {
-	for c.processNextWorkItem() {
-	}
+	c.nodes.setNode(newWorker)
+	c.publishWorker(oldWorker, newWorker)
 }
 
-func (c *K8sWorkerController) processNextWorkItem() bool {
-	defer recoverException()
-	obj, shutdown := c.workqueue.Get()
-	if shutdown {
-		return false
-	}
-	err := func(obj interface{}) error {
-		defer c.workqueue.Done(obj)
-		var key string
-		var ok bool
-		var rqo *K8sWorkerQueueObj
-		if rqo, ok = obj.(*K8sWorkerQueueObj); !ok {
-			c.workqueue.Forget(obj)
-			return fmt.Errorf("expected K8sWorkerQueueObj in workqueue but got %#v", obj)
-		}
-		if err := c.syncHandler(rqo); err != nil {
-			return fmt.Errorf("error syncing '%s': %s", key, err.Error())
-		}
-		c.workqueue.Forget(obj)
-		return nil
-	}(obj)
-
-	if err != nil {
-		runtime.HandleError(err)
+func (c *K8sWorkerController) onDelete(obj interface{}) {
+	if worker, ok := obj.(*v1.Node); ok {
+		c.nodes.deleteNode(worker.Name)
 	}
-	return true
+	publishRemoved(events.WorkerRemoved, obj)
 }
 
-func (c *K8sWorkerController) syncHandler(rqo *K8sWorkerQueueObj) error {
-	key := rqo.Key
-	switch rqo.Ope {
-	case common.ADD:
-		return c.add(key)
-	case common.UPDATE:
-		return c.sync(rqo)
-	case common.DELETE:
-		return c.sync(rqo)
-	default:
-		// log error
-		return fmt.Errorf("K8sWorkerQueueObj is not expected")
-	}
-}
-
-func (c *K8sWorkerController) add(key string) error {
+// sync records the outages and problems of the node of key lasting longer than their
+// grace periods and resolves those gone, and the loss of the node once it is deleted
+func (c *K8sWorkerController) sync(ctx context.Context, key string) error {
 	_, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		logs.Error("invalid resource key: %s", key)
 		return fmt.Errorf("invalid resource key: %s", key)
 	}
 
+	old, _ := c.reconciler.Last(key).(*v1.Node)
 	worker, err := c.workerList.Get(name)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			logs.Info("vm %s is removed", key)
-			return nil
+			return c.lost(name, old)
 		}
-		runtime.HandleError(fmt.Errorf("failed to list vm  %s/%s", key, err.Error()))
+		runtime.HandleError(fmt.Errorf("failed to list worker %s/%s", key, err.Error()))
 		return err
 	}
-	fmt.Println(worker.Name, worker.Status.Phase)
 
-	return err
+	if err := c.checkReady(key, worker, old); err != nil {
+		return err
+	}
+	return c.checkProblems(key, worker, old)
 }
 
-// sync
-// 1.diff routes between old and new objects
-// 2.delete routes not exist
-func (c *K8sWorkerController) sync(rqo *K8sWorkerQueueObj) error {
-	key := rqo.Key
-	_, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		logs.Error("invalid resource key: %s", key)
-		return fmt.Errorf("invalid resource key: %s", key)
-	}
+// nodeOutageTypes are the record types of the outages and problems of a node, they
+// end with the node
+func nodeOutageTypes() []string {
+	return append([]string{models.RecordTypeNodeNotReady, models.RecordTypeNodeHeartbeatStale}, nodeProblemTypes...)
+}
 
-	switch {
-	case rqo.Ope == common.UPDATE:
-		worker, err := c.workerList.Get(name)
-		if err != nil {
-			if errors.IsNotFound(err) {
-				logs.Info("vm %s is removed", key)
-				return nil
-			}
-			runtime.HandleError(fmt.Errorf("failed to list vm %s/%s", key, err.Error()))
-			return err
-		}
-		fmt.Println(worker.Name, worker.Status.Conditions[0].Type, worker.Status.Conditions[0].Status, worker.Status.Conditions[1].Type, worker.Status.Conditions[1].Status)
+// lost records the loss of the deleted node name, old is its last state. Nodes unknown to
+// this replica are skipped, their loss is recorded once. A node decommissioned with its
+// VirtulMachine is not lost, all its records are resolved. Otherwise its open outages and
+// problems are.
+func (c *K8sWorkerController) lost(name string, old *v1.Node) error {
+	if old == nil {
 		return nil
-	case rqo.Ope == common.DELETE:
-		//TODO worker节点宕机的告警通知
-		record := &models.Record{
-			User:        "",
-			HostName:    name,
-			Description: "worker节点从k8s集群失联",
-			Status:      0,
-			CreateTime:  nil,
-			UpdateTime:  nil,
-		}
-		err := models.RecordMode.Add(record)
-		if err != nil {
-			logs.Error("记录告警记录失败, ", err)
+	}
+	if vm := old.Annotations[AnnotationDecommissioned]; vm != "" {
+		if err := resolveDecommissioned(name, time.Now()); err != nil {
+			return err
 		}
-		fmt.Println("delete")
+		c.outages.forget(name)
+		c.problems.forget(name)
+		logs.Info("node %s of vm %s decommissioned", name, vm)
 		return nil
-	default:
-		return fmt.Errorf("not expected in (WorkerController) sync")
 	}
-}
-
-func (c *K8sWorkerController) cacheNodeList() {
-	defer func() {
-		if err := recover(); err != nil {
-			logs.Error(err)
-		}
-	}()
-
-	for range time.Tick(time.Second * 60) {
-		current := time.Now()
-		time.Sleep(time.Duration(60-current.Second()) * time.Second)
-		NodeList, _ = c.ListNode()
+	if err := resolveRecords(name, time.Now(), nodeOutageTypes()...); err != nil {
+		return err
+	}
+	c.outages.forget(name)
+	c.problems.forget(name)
+
+	record := &models.Record{
+		HostName:    name,
+		Type:        models.RecordTypeNodeLost,
+		Severity:    models.SeverityCritical,
+		Description: "worker节点从k8s集群失联",
+	}
+	record.SetLabels(old.Labels)
+	if err := models.RecordMode.Add(record); err != nil {
+		logs.Error("记录告警记录失败, ", err)
 	}
+	return nil
 }
 
+// ListNode returns the node list, from the node store once the informers are synced and
+// computed from the listers before.
 func (c *K8sWorkerController) ListNode() (*NodeListResult, error) {
+	if c.workerSynced() && c.podSynced() {
+		return c.nodes.snapshot(c.buildNodeList), nil
+	}
+
 	nodeList, err := c.workerList.List(labels.Everything())
 	if err != nil {
 		return nil, err
 	}
+	cachePods, err := c.podList.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make(map[string]*nodePods)
+	for _, pod := range cachePods {
+		usage, ok := podUsageOf(pod)
+		if !ok {
+			continue
+		}
+		p, ok := pods[usage.nodeName]
+		if !ok {
+			p = &nodePods{requested: v1.ResourceList{}}
+			pods[usage.nodeName] = p
+		}
+		p.add(usage)
+	}
+	return c.buildNodeList(nodeList, pods, time.Now()), nil
+}
 
+func (c *K8sWorkerController) buildNodeList(nodeList []*v1.Node, pods map[string]*nodePods, now time.Time) *NodeListResult {
 	nodes := make([]Node, 0)
 	ready := 0
 	schedulable := 0
@@ -308,8 +282,7 @@ func (c *K8sWorkerController) ListNode() (*NodeListResult, error) {
 	var avaliableCpu int64 = 0
 	// unit Byte
 	var avaliableMemory int64 = 0
-
-	avaliableNodeMap := make(map[string]*v1.Node)
+	used := common.ResourceList{}
 
 	for _, node := range nodeList {
 		isReady := false
@@ -326,29 +299,31 @@ func (c *K8sWorkerController) ListNode() (*NodeListResult, error) {
 			isSchedulable = true
 		}
 
+		onNode, ok := pods[node.Name]
+		if !ok {
+			onNode = &nodePods{requested: v1.ResourceList{}}
+		}
 		if isReady && isSchedulable {
-			avaliableNodeMap[node.Name] = node
-
 			cpuQuantity := node.Status.Allocatable[v1.ResourceCPU]
 			memoryQuantity := node.Status.Allocatable[v1.ResourceMemory]
 			// unit m
 			avaliableCpu += cpuQuantity.MilliValue()
 			// unit Byte
 			avaliableMemory += memoryQuantity.Value()
+			// Exclude Pod on Unavailable Node
+			used.Cpu += onNode.used.Cpu
+			used.Memory += onNode.used.Memory
 		}
 
-		nodes = append(nodes, toNode(node))
+		n := c.toNode(node)
+		n.Status.Usage = nodeUsage(node, onNode.requested)
+		nodes = append(nodes, n)
 	}
 
 	sort.Slice(nodes, func(i, j int) bool {
 		return nodes[i].Name < nodes[j].Name
 	})
 
-	resourceList, err := c.podUsedResourcesOnAvaliableNode(avaliableNodeMap)
-	if err != nil {
-		return nil, err
-	}
-
 	return &NodeListResult{
 		NodeSummary: NodeListSummary{
 			Total:       int64(len(nodes)),
@@ -357,40 +332,39 @@ func (c *K8sWorkerController) ListNode() (*NodeListResult, error) {
 		},
 		CpuSummary: ResourceSummary{
 			Total: avaliableCpu / 1000,
-			Used:  resourceList.Cpu / 1000,
+			Used:  used.Cpu / 1000,
 		},
 		MemorySummary: ResourceSummary{
 			Total: avaliableMemory / (1024 * 1024 * 1024),
-			Used:  resourceList.Memory / (1024 * 1024 * 1024),
+			Used:  used.Memory / (1024 * 1024 * 1024),
 		},
-		Nodes: nodes,
-	}, nil
-}
-
-func (c *K8sWorkerController) podUsedResourcesOnAvaliableNode(avaliableNodeMap map[string]*v1.Node) (*common.ResourceList, error) {
-	result := &common.ResourceList{}
-	cachePods, err := c.podList.List(labels.Everything())
-	if err != nil {
-		return nil, err
+		Nodes:       nodes,
+		GeneratedAt: now,
 	}
+}
 
-	for _, pod := range cachePods {
-		// Exclude Pod on Unavailable Node
-		_, ok := avaliableNodeMap[pod.Spec.NodeName]
-		if pod.Status.Phase == v1.PodFailed || pod.Status.Phase == v1.PodSucceeded || pod.DeletionTimestamp != nil || !ok {
-			continue
+func nodeUsage(node *v1.Node, requested v1.ResourceList) NodeUsage {
+	usage := func(name v1.ResourceName) ResourceUsage {
+		allocatable := node.Status.Allocatable[name]
+		request := requested[name]
+		u := ResourceUsage{Allocatable: allocatable.Value(), Requested: request.Value()}
+		if name == v1.ResourceCPU {
+			u = ResourceUsage{Allocatable: allocatable.MilliValue(), Requested: request.MilliValue()}
 		}
-
-		resourceList := common.ContainersRequestResourceList(pod.Spec.Containers)
-
-		result.Cpu += resourceList.Cpu
-		result.Memory += resourceList.Memory
+		if u.Allocatable > 0 {
+			u.Percent = u.Requested * 100 / u.Allocatable
+		}
+		return u
+	}
+	return NodeUsage{
+		Cpu:    usage(v1.ResourceCPU),
+		Memory: usage(v1.ResourceMemory),
+		Pods:   usage(v1.ResourcePods),
 	}
-
-	return result, nil
 }
 
-func toNode(knode *v1.Node) Node {
+// toNodeSummary is the summary of knode in the list, out of the node alone
+func toNodeSummary(knode *v1.Node) Node {
 
 	node := Node{
 		Name:              knode.Name,
@@ -402,6 +376,7 @@ func toNode(knode *v1.Node) Node {
 		},
 		Status: NodeStatus{
 			NodeInfo: knode.Status.NodeInfo,
+			Problems: GetNodeProblems(knode),
 		},
 	}
 
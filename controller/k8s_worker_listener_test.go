@@ -0,0 +1,97 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"node-controller/common"
+	"node-controller/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// addOpenRecord stores an open record of type recordType about nodeName
+func addOpenRecord(t *testing.T, nodeName string, recordType string) {
+	start := time.Now().Add(-time.Hour)
+	record := &models.Record{HostName: nodeName, Type: recordType, StartTime: &start, Status: models.RecordAlerted}
+	if err := models.RecordMode.Add(record); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLost(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	decommissioned := node.DeepCopy()
+	decommissioned.Annotations = map[string]string{AnnotationDecommissioned: "default/vm"}
+
+	tests := []struct {
+		name string
+		old  *v1.Node
+		open []string
+		// wantOpen are the types of the records left open, wantRecovers the types of the recoveries queued
+		wantOpen     []string
+		wantRecovers []string
+	}{
+		{"unknown node", nil, []string{models.RecordTypeNodeNotReady}, []string{models.RecordTypeNodeNotReady}, []string{}},
+		{"lost", node, nil, []string{models.RecordTypeNodeLost}, []string{}},
+		{
+			"lost with outages",
+			node,
+			[]string{models.RecordTypeNodeNotReady, models.RecordTypeNodeMemoryPressure, models.RecordTypeNodeHeartbeatStale},
+			[]string{models.RecordTypeNodeLost},
+			[]string{models.RecordTypeNodeNotReady, models.RecordTypeNodeMemoryPressure, models.RecordTypeNodeHeartbeatStale},
+		},
+		{"decommissioned", decommissioned, nil, []string{}, []string{}},
+		{
+			"decommissioned with outages",
+			decommissioned,
+			[]string{models.RecordTypeNodeUnreachable, models.RecordTypeNodeNotReady},
+			[]string{},
+			[]string{models.RecordTypeNodeUnreachable, models.RecordTypeNodeNotReady},
+		},
+		{
+			"decommissioned after a drain timeout",
+			decommissioned,
+			[]string{models.RecordTypeVMDrainTimeout, models.RecordTypeNodeLost, models.RecordTypeNodePIDPressure},
+			[]string{},
+			[]string{models.RecordTypeVMDrainTimeout, models.RecordTypeNodeLost, models.RecordTypeNodePIDPressure},
+		},
+		{
+			"lost after a drain timeout",
+			node,
+			[]string{models.RecordTypeVMDrainTimeout},
+			[]string{models.RecordTypeVMDrainTimeout, models.RecordTypeNodeLost},
+			[]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestDB(t)
+			stop := make(chan struct{})
+			defer close(stop)
+			c, _ := newTestWorkerController(t, stop)
+			for _, recordType := range test.open {
+				addOpenRecord(t, "node", recordType)
+			}
+			c.outages.record("node", time.Now())
+			c.problems.record("node", models.RecordTypeNodeMemoryPressure, time.Now())
+
+			if err := c.lost("node", test.old); err != nil {
+				t.Fatalf("lost() = %v", err)
+			}
+			if got := openRecords(t, "node"); !reflect.DeepEqual(got, test.wantOpen) {
+				t.Errorf("open records = %v, want %v", got, test.wantOpen)
+			}
+			recovers := []string{}
+			for _, recover := range common.TakeRecovers() {
+				recovers = append(recovers, recover.Type)
+			}
+			if !reflect.DeepEqual(recovers, test.wantRecovers) {
+				t.Errorf("recoveries = %v, want %v", recovers, test.wantRecovers)
+			}
+			if test.old != nil && c.problems.has("node", models.RecordTypeNodeMemoryPressure) {
+				t.Errorf("problems of the node not forgotten")
+			}
+		})
+	}
+}
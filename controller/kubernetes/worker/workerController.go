@@ -1,15 +1,75 @@
 package worker
 
 import (
+	"encoding/json"
+	v1 "k8s.io/api/core/v1"
+	"node-controller/conf"
 	"node-controller/controller"
+	"node-controller/models"
+	"node-controller/util/logs"
+	"time"
 )
 
+// defaultDrainTimeout bounds a drain requested without timeoutSeconds
+const defaultDrainTimeout = 600 * time.Second
+
 type WorkerController struct {
 	controller.ResultHandlerController
 }
 
+// CordonRequest is the body of the cordon and uncordon requests
+type CordonRequest struct {
+	User string `json:"user"`
+}
+
+// DrainRequest is the body of the drain request, all fields but user are optional
+type DrainRequest struct {
+	User string `json:"user"`
+	// GracePeriodSeconds overrides the termination grace period of the pods, the pod's own when not set
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds"`
+	IgnoreDaemonSets   bool   `json:"ignoreDaemonSets"`
+	DeleteEmptyDirData bool   `json:"deleteEmptyDirData"`
+	// TimeoutSeconds gives up the drain, 600 when not set
+	TimeoutSeconds int64 `json:"timeoutSeconds"`
+	DryRun         bool  `json:"dryRun"`
+}
+
+type CordonResult struct {
+	Name          string `json:"name"`
+	Unschedulable bool   `json:"unschedulable"`
+}
+
+// LabelsRequest is the body of the labels request. resourceVersion, when set, must be the
+// current one of the node, the change fails with 409 otherwise.
+type LabelsRequest struct {
+	User            string `json:"user"`
+	ResourceVersion string `json:"resourceVersion"`
+	controller.LabelChange
+}
+
+// TaintsRequest is the body of the taints request, see LabelsRequest
+type TaintsRequest struct {
+	User            string `json:"user"`
+	ResourceVersion string `json:"resourceVersion"`
+	controller.TaintChange
+}
+
+type NodeMetaResult struct {
+	Name            string            `json:"name"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Taints          []v1.Taint        `json:"taints,omitempty"`
+}
+
 func (c *WorkerController) URLMapping() {
 	c.Mapping("List", c.List)
+	c.Mapping("Get", c.Get)
+	c.Mapping("Cordon", c.Cordon)
+	c.Mapping("Uncordon", c.Uncordon)
+	c.Mapping("Drain", c.Drain)
+	c.Mapping("Operation", c.Operation)
+	c.Mapping("Labels", c.Labels)
+	c.Mapping("Taints", c.Taints)
 }
 
 func (c *WorkerController) Prepare() {
@@ -17,12 +77,231 @@ func (c *WorkerController) Prepare() {
 }
 
 // @Title List
-// @Description find All Node Status
+// @Description find the nodes matching the query with the cluster summary
+// @Param	labelSelector	query	string	false	"label selector, e.g. env=prod,tier!=db"
+// @Param	name	query	string	false	"substring of the node name"
+// @Param	ready	query	string	false	"true, false or unknown, comma separated"
+// @Param	schedulable	query	bool	false	"whether the node is schedulable"
+// @Param	role	query	string	false	"node roles, comma separated"
+// @Param	zone	query	string	false	"zones, comma separated"
+// @Param	kubeletVersion	query	string	false	"kubelet versions, comma separated"
+// @Param	os	query	string	false	"operating systems, comma separated"
+// @Param	arch	query	string	false	"architectures, comma separated"
+// @Param	sortBy	query	string	false	"column to sort by, name by default"
+// @Param	order	query	string	false	"asc or desc"
+// @Param	page	query	int	false	"page number starting at 1"
+// @Param	pageSize	query	int	false	"nodes per page, all when 0"
 // @Success 200 {object} NodeListResult success
 // @router /list [get]
 func (c *WorkerController) List() {
+	query, err := controller.ParseNodeQuery(c.Ctx.Request.URL.Query())
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
 
-	nodeListResult := controller.NodeList
+	nodeListResult, err := controller.ListWorkers(query)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
 
 	c.Success(nodeListResult)
 }
+
+// @Title Get
+// @Description find the node with its conditions, addresses, resources and pods
+// @Param	name	path	string	true	"the node name"
+// @Success 200 {object} controller.NodeDetail success
+// @router /:name [get]
+func (c *WorkerController) Get() {
+	detail, err := controller.GetNodeDetail(c.Ctx.Input.Param(":name"))
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(detail)
+}
+
+// @Title Cordon
+// @Description mark the node unschedulable
+// @Param	name	path	string	true	"the node name"
+// @Param	body	body	CordonRequest	true	"the acting user"
+// @Success 200 {object} CordonResult success
+// @router /:name/cordon [post]
+func (c *WorkerController) Cordon() {
+	c.cordon(true)
+}
+
+// @Title Uncordon
+// @Description mark the node schedulable again, refused with 409 when the VirtulMachine of the node cordons it
+// @Param	name	path	string	true	"the node name"
+// @Param	body	body	CordonRequest	true	"the acting user"
+// @Success 200 {object} CordonResult success
+// @router /:name/uncordon [post]
+func (c *WorkerController) Uncordon() {
+	c.cordon(false)
+}
+
+func (c *WorkerController) cordon(unschedulable bool) {
+	name := c.Ctx.Input.Param(":name")
+	request := &CordonRequest{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, request); err != nil {
+		c.AbortBadRequestFormat("body")
+	}
+	if request.User == "" {
+		c.AbortBadRequestFormat("user")
+	}
+	if _, err := conf.WorkerInformer.Lister().Get(name); err != nil {
+		c.HandleError(err)
+		return
+	}
+	action := "Cordon"
+	if !unschedulable {
+		action = "Uncordon"
+	}
+	err := controller.Cordon(conf.GetKubeClient(), name, unschedulable)
+	audit(request.User, action, name, nil, err)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(CordonResult{Name: name, Unschedulable: unschedulable})
+}
+
+// @Title Drain
+// @Description cordon the node and evict its pods through the Eviction API, respecting PodDisruptionBudgets.
+// The drain runs in the background, poll the returned operation for its progress. Operations are kept in
+// the memory of the replica that started them: their ids are only known to that replica and lost when it restarts.
+// @Param	name	path	string	true	"the node name"
+// @Param	body	body	DrainRequest	true	"the acting user and the drain options"
+// @Success 200 {object} controller.DrainOperation success
+// @router /:name/drain [post]
+func (c *WorkerController) Drain() {
+	name := c.Ctx.Input.Param(":name")
+	request := &DrainRequest{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, request); err != nil {
+		c.AbortBadRequestFormat("body")
+	}
+	if request.User == "" {
+		c.AbortBadRequestFormat("user")
+	}
+	if request.TimeoutSeconds < 0 {
+		c.AbortBadRequestFormat("timeoutSeconds")
+	}
+	if _, err := conf.WorkerInformer.Lister().Get(name); err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	options := controller.DrainOptions{
+		GracePeriodSeconds: -1,
+		IgnoreDaemonSets:   request.IgnoreDaemonSets,
+		DeleteEmptyDirData: request.DeleteEmptyDirData,
+	}
+	if request.GracePeriodSeconds != nil {
+		if *request.GracePeriodSeconds < 0 {
+			c.AbortBadRequestFormat("gracePeriodSeconds")
+		}
+		options.GracePeriodSeconds = *request.GracePeriodSeconds
+	}
+	timeout := defaultDrainTimeout
+	if request.TimeoutSeconds > 0 {
+		timeout = time.Duration(request.TimeoutSeconds) * time.Second
+	}
+
+	operation, err := controller.StartDrain(conf.GetKubeClient(), name, options, timeout, request.DryRun)
+	// a dry run changes nothing
+	if !request.DryRun {
+		audit(request.User, "Drain", name, request, err)
+	}
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(operation)
+}
+
+// @Title Operation
+// @Description find a drain operation by id. Operations are per replica, ask the replica that started the drain.
+// @Param	id	path	string	true	"the operation id"
+// @Success 200 {object} controller.DrainOperation success
+// @router /operations/:id [get]
+func (c *WorkerController) Operation() {
+	operation, ok := controller.GetDrainOperation(c.Ctx.Input.Param(":id"))
+	if !ok {
+		c.AbortNotFound("operation " + c.Ctx.Input.Param(":id") + " not found")
+	}
+
+	c.Success(operation)
+}
+
+// @Title Labels
+// @Description set and remove labels of the node
+// @Param	name	path	string	true	"the node name"
+// @Param	body	body	LabelsRequest	true	"the acting user and the labels to set and remove"
+// @Success 200 {object} NodeMetaResult success
+// @router /:name/labels [post]
+func (c *WorkerController) Labels() {
+	name := c.Ctx.Input.Param(":name")
+	request := &LabelsRequest{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, request); err != nil {
+		c.AbortBadRequestFormat("body")
+	}
+	if request.User == "" {
+		c.AbortBadRequestFormat("user")
+	}
+	if err := request.Validate(); err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	node, err := controller.UpdateNodeLabels(conf.GetKubeClient(), name, request.ResourceVersion, &request.LabelChange)
+	audit(request.User, "UpdateLabels", name, request, err)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(NodeMetaResult{Name: node.Name, ResourceVersion: node.ResourceVersion, Labels: node.Labels, Taints: node.Spec.Taints})
+}
+
+// @Title Taints
+// @Description add, update and remove taints of the node
+// @Param	name	path	string	true	"the node name"
+// @Param	body	body	TaintsRequest	true	"the acting user and the taints to set and remove"
+// @Success 200 {object} NodeMetaResult success
+// @router /:name/taints [post]
+func (c *WorkerController) Taints() {
+	name := c.Ctx.Input.Param(":name")
+	request := &TaintsRequest{}
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, request); err != nil {
+		c.AbortBadRequestFormat("body")
+	}
+	if request.User == "" {
+		c.AbortBadRequestFormat("user")
+	}
+	if err := request.Validate(); err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	node, err := controller.UpdateNodeTaints(conf.GetKubeClient(), name, request.ResourceVersion, &request.TaintChange)
+	audit(request.User, "UpdateTaints", name, request, err)
+	if err != nil {
+		c.HandleError(err)
+		return
+	}
+
+	c.Success(NodeMetaResult{Name: node.Name, ResourceVersion: node.ResourceVersion, Labels: node.Labels, Taints: node.Spec.Taints})
+}
+
+// audit writes the change of the node by user, failed changes included
+func audit(user string, action string, nodeName string, detail interface{}, err error) {
+	if auditErr := models.AuditMode.Add(user, action, "node/"+nodeName, detail, err); auditErr != nil {
+		logs.Error("记录审计日志失败, ", auditErr)
+	}
+}
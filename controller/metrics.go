@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	"node-controller/models"
+	"node-controller/util/logs"
+)
+
+var (
+	nodeReadyDesc = prometheus.NewDesc("node_controller_node_ready",
+		"Whether the node is Ready.", []string{"node"}, nil)
+	nodeSchedulableDesc = prometheus.NewDesc("node_controller_node_schedulable",
+		"Whether the node is schedulable.", []string{"node"}, nil)
+	nodeAllocatableDesc = prometheus.NewDesc("node_controller_node_allocatable",
+		"Allocatable resources of the node.", []string{"node", "resource"}, nil)
+	nodeRequestedDesc = prometheus.NewDesc("node_controller_node_requested",
+		"Resources requested by the active pods of the node.", []string{"node", "resource"}, nil)
+	alertsDesc = prometheus.NewDesc("node_controller_alerts",
+		"Alert records by type and status.", []string{"type", "status"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(nodeCollector{}, alertCollector{})
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// nodeCollector exports the readiness, schedulability and resources of each node,
+// cpu in cores and memory in bytes
+type nodeCollector struct{}
+
+func (nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nodeReadyDesc
+	ch <- nodeSchedulableDesc
+	ch <- nodeAllocatableDesc
+	ch <- nodeRequestedDesc
+}
+
+func (nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	if workers == nil {
+		return
+	}
+	nodeList, err := workers.ListNode()
+	if err != nil {
+		logs.Error("failed to collect the node metrics: %s", err.Error())
+		return
+	}
+
+	for _, node := range nodeList.Nodes {
+		ch <- prometheus.MustNewConstMetric(nodeReadyDesc, prometheus.GaugeValue, boolValue(node.Spec.Ready == v1.ConditionTrue), node.Name)
+		ch <- prometheus.MustNewConstMetric(nodeSchedulableDesc, prometheus.GaugeValue, boolValue(!node.Spec.Unschedulable), node.Name)
+		for _, usage := range []struct {
+			resource v1.ResourceName
+			usage    ResourceUsage
+			unit     float64
+		}{
+			{v1.ResourceCPU, node.Status.Usage.Cpu, 1000},
+			{v1.ResourceMemory, node.Status.Usage.Memory, 1},
+			{v1.ResourcePods, node.Status.Usage.Pods, 1},
+		} {
+			ch <- prometheus.MustNewConstMetric(nodeAllocatableDesc, prometheus.GaugeValue,
+				float64(usage.usage.Allocatable)/usage.unit, node.Name, string(usage.resource))
+			ch <- prometheus.MustNewConstMetric(nodeRequestedDesc, prometheus.GaugeValue,
+				float64(usage.usage.Requested)/usage.unit, node.Name, string(usage.resource))
+		}
+	}
+}
+
+// alertCollector exports the number of alert records by type and status: open, acked or resolved
+type alertCollector struct{}
+
+func (alertCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- alertsDesc
+}
+
+func (alertCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := models.RecordMode.CountByTypeStatus()
+	if err != nil {
+		logs.Error("failed to collect the alert metrics: %s", err.Error())
+		return
+	}
+
+	values := make(map[[2]string]float64)
+	for _, count := range counts {
+		status := "open"
+		switch count.Status {
+		case models.RecordAcked:
+			status = "acked"
+		case models.RecordResolved:
+			status = "resolved"
+		}
+		values[[2]string{count.Type, status}] += float64(count.Count)
+	}
+	for k, value := range values {
+		ch <- prometheus.MustNewConstMetric(alertsDesc, prometheus.GaugeValue, value, k[0], k[1])
+	}
+}
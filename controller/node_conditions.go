@@ -0,0 +1,281 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/astaxie/beego"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"node-controller/models"
+	"node-controller/util/logs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// taints added by the node lifecycle controller
+const (
+	TaintNodeUnreachable = "node.kubernetes.io/unreachable"
+	TaintNodeNotReady    = "node.kubernetes.io/not-ready"
+)
+
+// NodeProblem is a reason for a node to be unhealthy
+type NodeProblem struct {
+	Type     string      `json:"type"`
+	Severity string      `json:"severity"`
+	Reason   string      `json:"reason,omitempty"`
+	Message  string      `json:"message,omitempty"`
+	Since    metaV1.Time `json:"since"`
+}
+
+// nodeConditionAlerts are the conditions alerting when True
+var nodeConditionAlerts = []struct {
+	condition v1.NodeConditionType
+	t         string
+	severity  string
+}{
+	{v1.NodeMemoryPressure, models.RecordTypeNodeMemoryPressure, models.SeverityWarning},
+	{v1.NodeDiskPressure, models.RecordTypeNodeDiskPressure, models.SeverityWarning},
+	{v1.NodePIDPressure, models.RecordTypeNodePIDPressure, models.SeverityWarning},
+	{v1.NodeNetworkUnavailable, models.RecordTypeNodeNetworkUnavailable, models.SeverityCritical},
+}
+
+// nodeTaintAlerts are the taints alerting while present
+var nodeTaintAlerts = []struct {
+	key      string
+	t        string
+	severity string
+}{
+	{TaintNodeUnreachable, models.RecordTypeNodeUnreachable, models.SeverityCritical},
+	{TaintNodeNotReady, models.RecordTypeNodeNotReadyTaint, models.SeverityWarning},
+}
+
+// nodeProblemTypes are the record types handled by checkProblems
+var nodeProblemTypes = []string{
+	models.RecordTypeNodeMemoryPressure,
+	models.RecordTypeNodeDiskPressure,
+	models.RecordTypeNodePIDPressure,
+	models.RecordTypeNodeNetworkUnavailable,
+	models.RecordTypeNodeUnreachable,
+	models.RecordTypeNodeNotReadyTaint,
+}
+
+func nodeConditionGracePeriod() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("NodeConditionGracePeriod", 60)) * time.Second
+}
+
+// nodeProblems remembers the start of the problems recorded per node and type, and
+// when the problems without a start time were first seen
+type nodeProblems struct {
+	sync.Mutex
+	recorded map[string]map[string]time.Time
+	seen     map[string]map[string]time.Time
+}
+
+func (p *nodeProblems) isRecorded(nodeName string, t string, start time.Time) bool {
+	p.Lock()
+	defer p.Unlock()
+	recorded, ok := p.recorded[nodeName][t]
+	return ok && recorded.Equal(start)
+}
+
+func (p *nodeProblems) has(nodeName string, t string) bool {
+	p.Lock()
+	defer p.Unlock()
+	_, ok := p.recorded[nodeName][t]
+	return ok
+}
+
+func (p *nodeProblems) record(nodeName string, t string, start time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	if p.recorded[nodeName] == nil {
+		p.recorded[nodeName] = map[string]time.Time{}
+	}
+	p.recorded[nodeName][t] = start
+}
+
+// firstSeen returns when the problem t of nodeName was first seen, now for a new one
+func (p *nodeProblems) firstSeen(nodeName string, t string, now time.Time) time.Time {
+	p.Lock()
+	defer p.Unlock()
+	if p.seen[nodeName] == nil {
+		p.seen[nodeName] = map[string]time.Time{}
+	}
+	if seen, ok := p.seen[nodeName][t]; ok {
+		return seen
+	}
+	p.seen[nodeName][t] = now
+	return now
+}
+
+func (p *nodeProblems) forget(nodeName string, types ...string) {
+	p.Lock()
+	defer p.Unlock()
+	if len(types) == 0 {
+		delete(p.recorded, nodeName)
+		delete(p.seen, nodeName)
+		return
+	}
+	for _, t := range types {
+		delete(p.recorded[nodeName], t)
+		delete(p.seen[nodeName], t)
+	}
+}
+
+// GetNodeProblems returns the problems of node: NotReady, pressure conditions,
+// unavailable network and the taints of the node lifecycle controller
+func GetNodeProblems(node *v1.Node) []NodeProblem {
+	problems := make([]NodeProblem, 0)
+	if node == nil {
+		return problems
+	}
+	if ready := getNodeCondition(node, v1.NodeReady); ready != nil && ready.Status != v1.ConditionTrue {
+		problems = append(problems, NodeProblem{
+			Type:     models.RecordTypeNodeNotReady,
+			Severity: models.SeverityCritical,
+			Reason:   ready.Reason,
+			Message:  ready.Message,
+			Since:    ready.LastTransitionTime,
+		})
+	}
+	for _, alert := range nodeConditionAlerts {
+		condition := getNodeCondition(node, alert.condition)
+		if condition == nil || condition.Status != v1.ConditionTrue {
+			continue
+		}
+		problems = append(problems, NodeProblem{
+			Type:     alert.t,
+			Severity: alert.severity,
+			Reason:   condition.Reason,
+			Message:  condition.Message,
+			Since:    condition.LastTransitionTime,
+		})
+	}
+	for _, alert := range nodeTaintAlerts {
+		for _, taint := range node.Spec.Taints {
+			if taint.Key != alert.key {
+				continue
+			}
+			problem := NodeProblem{
+				Type:     alert.t,
+				Severity: alert.severity,
+				Reason:   string(taint.Effect),
+				Message:  fmt.Sprintf("node is tainted %s:%s", taint.Key, taint.Effect),
+			}
+			if taint.TimeAdded != nil {
+				problem.Since = *taint.TimeAdded
+			}
+			// NoSchedule and NoExecute taints of the same key are one problem
+			if len(problems) > 0 && problems[len(problems)-1].Type == alert.t {
+				if !problem.Since.IsZero() && (problems[len(problems)-1].Since.IsZero() || problem.Since.Before(&problems[len(problems)-1].Since)) {
+					problems[len(problems)-1].Since = problem.Since
+				}
+				continue
+			}
+			problems = append(problems, problem)
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return severityOrder(problems[i].Severity) > severityOrder(problems[j].Severity)
+	})
+	return problems
+}
+
+func severityOrder(severity string) int {
+	switch severity {
+	case models.SeverityCritical:
+		return 3
+	case models.SeverityWarning:
+		return 2
+	case models.SeverityInfo:
+		return 1
+	}
+	return 0
+}
+
+// checkProblems records the pressure conditions and lifecycle taints of worker lasting
+// longer than the grace period and resolves those gone. old is the previous version of
+// worker, nil when unknown.
+func (c *K8sWorkerController) checkProblems(key string, worker *v1.Node, old *v1.Node) error {
+	now := time.Now()
+	grace := nodeConditionGracePeriod()
+	current := make(map[string]bool)
+	for _, problem := range GetNodeProblems(worker) {
+		if problem.Type == models.RecordTypeNodeNotReady {
+			// handled by checkReady
+			continue
+		}
+		current[problem.Type] = true
+		start := problem.Since.Time
+		if start.IsZero() {
+			// a taint without time starts when it is first seen
+			start = c.problems.firstSeen(worker.Name, problem.Type, now)
+		}
+		if c.problems.isRecorded(worker.Name, problem.Type, start) {
+			continue
+		}
+		if elapsed := now.Sub(start); elapsed < grace {
+			c.reconciler.EnqueueAfter(key, grace-elapsed)
+			continue
+		}
+		exists, err := models.RecordMode.ExistType(worker.Name, problem.Type, start)
+		if err != nil {
+			logs.Error("查询告警记录失败, ", err)
+			return err
+		}
+		if !exists && problem.Since.IsZero() {
+			// the first seen time is lost on restart, an open record is the same problem
+			open, err := models.RecordMode.ListOpen(worker.Name, problem.Type)
+			if err != nil {
+				logs.Error("查询未恢复告警记录失败, ", err)
+				return err
+			}
+			exists = len(open) > 0
+		}
+		if !exists {
+			record := &models.Record{
+				User:        "",
+				HostName:    worker.Name,
+				Type:        problem.Type,
+				Severity:    problem.Severity,
+				Description: fmt.Sprintf("worker节点%s(%s): %s", problem.Type, problem.Reason, problem.Message),
+				Reason:      problem.Reason,
+				Message:     problem.Message,
+				StartTime:   &start,
+				Status:      models.RecordTobeAltert,
+			}
+			record.SetLabels(worker.Labels)
+			if err := models.RecordMode.Add(record); err != nil {
+				logs.Error("记录告警记录失败, ", err)
+				return err
+			}
+			logs.Warning("node %s %s since %s, recorded", worker.Name, problem.Type, start.Format("2006-01-02 15:04:05"))
+		}
+		c.problems.record(worker.Name, problem.Type, start)
+	}
+
+	// open records are looked up for the problems gone and for nodes not seen yet
+	oldProblems := make(map[string]bool)
+	for _, problem := range GetNodeProblems(old) {
+		oldProblems[problem.Type] = true
+	}
+	resolved := make([]string, 0)
+	for _, t := range nodeProblemTypes {
+		if current[t] {
+			continue
+		}
+		if old == nil || oldProblems[t] || c.problems.has(worker.Name, t) {
+			resolved = append(resolved, t)
+		} else {
+			c.problems.forget(worker.Name, t)
+		}
+	}
+	if len(resolved) == 0 {
+		return nil
+	}
+	if err := resolveRecords(worker.Name, now, resolved...); err != nil {
+		return err
+	}
+	c.problems.forget(worker.Name, resolved...)
+	return nil
+}
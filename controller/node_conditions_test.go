@@ -0,0 +1,229 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"node-controller/common"
+	"node-controller/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newConditionNode is the node "node" with conditions and taints
+func newConditionNode(conditions []v1.NodeCondition, taints ...v1.Taint) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Spec:       v1.NodeSpec{Taints: taints},
+		Status:     v1.NodeStatus{Conditions: conditions},
+	}
+}
+
+func nodeCondition(conditionType v1.NodeConditionType, status v1.ConditionStatus, since time.Time) v1.NodeCondition {
+	return v1.NodeCondition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             string(conditionType),
+		LastTransitionTime: metav1.NewTime(since),
+	}
+}
+
+func nodeTaint(key string, effect v1.TaintEffect, added *time.Time) v1.Taint {
+	taint := v1.Taint{Key: key, Effect: effect}
+	if added != nil {
+		timeAdded := metav1.NewTime(*added)
+		taint.TimeAdded = &timeAdded
+	}
+	return taint
+}
+
+func TestGetNodeProblems(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	earlier := now.Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		node *v1.Node
+		// want are the type, severity and start of the problems
+		want [][3]string
+	}{
+		{"no node", nil, [][3]string{}},
+		{
+			"healthy",
+			newConditionNode([]v1.NodeCondition{
+				nodeCondition(v1.NodeReady, v1.ConditionTrue, earlier),
+				nodeCondition(v1.NodeMemoryPressure, v1.ConditionFalse, earlier),
+				nodeCondition(v1.NodeDiskPressure, v1.ConditionFalse, earlier),
+			}),
+			[][3]string{},
+		},
+		{
+			"not ready",
+			newConditionNode([]v1.NodeCondition{nodeCondition(v1.NodeReady, v1.ConditionUnknown, now)}),
+			[][3]string{{models.RecordTypeNodeNotReady, models.SeverityCritical, now.String()}},
+		},
+		{
+			"pressure",
+			newConditionNode([]v1.NodeCondition{
+				nodeCondition(v1.NodeReady, v1.ConditionTrue, earlier),
+				nodeCondition(v1.NodeMemoryPressure, v1.ConditionTrue, now),
+				nodeCondition(v1.NodeDiskPressure, v1.ConditionTrue, earlier),
+				nodeCondition(v1.NodePIDPressure, v1.ConditionTrue, now),
+			}),
+			[][3]string{
+				{models.RecordTypeNodeMemoryPressure, models.SeverityWarning, now.String()},
+				{models.RecordTypeNodeDiskPressure, models.SeverityWarning, earlier.String()},
+				{models.RecordTypeNodePIDPressure, models.SeverityWarning, now.String()},
+			},
+		},
+		{
+			"critical first",
+			newConditionNode([]v1.NodeCondition{
+				nodeCondition(v1.NodeMemoryPressure, v1.ConditionTrue, now),
+				nodeCondition(v1.NodeNetworkUnavailable, v1.ConditionTrue, earlier),
+			}),
+			[][3]string{
+				{models.RecordTypeNodeNetworkUnavailable, models.SeverityCritical, earlier.String()},
+				{models.RecordTypeNodeMemoryPressure, models.SeverityWarning, now.String()},
+			},
+		},
+		{
+			"unreachable taints",
+			newConditionNode(nil,
+				nodeTaint(TaintNodeUnreachable, v1.TaintEffectNoSchedule, &now),
+				nodeTaint(TaintNodeUnreachable, v1.TaintEffectNoExecute, &earlier)),
+			[][3]string{{models.RecordTypeNodeUnreachable, models.SeverityCritical, earlier.String()}},
+		},
+		{
+			"not ready taint without time",
+			newConditionNode(nil,
+				nodeTaint(TaintNodeNotReady, v1.TaintEffectNoSchedule, nil),
+				nodeTaint(TaintNodeNotReady, v1.TaintEffectNoExecute, &now)),
+			[][3]string{{models.RecordTypeNodeNotReadyTaint, models.SeverityWarning, now.String()}},
+		},
+		{
+			"other taints",
+			newConditionNode(nil, nodeTaint("dedicated", v1.TaintEffectNoSchedule, &now)),
+			[][3]string{},
+		},
+	}
+	for _, test := range tests {
+		got := make([][3]string, 0)
+		for _, problem := range GetNodeProblems(test.node) {
+			got = append(got, [3]string{problem.Type, problem.Severity, problem.Since.Time.String()})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: GetNodeProblems() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckProblems(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	healthy := newConditionNode([]v1.NodeCondition{
+		nodeCondition(v1.NodeReady, v1.ConditionTrue, earlier),
+		nodeCondition(v1.NodeMemoryPressure, v1.ConditionFalse, earlier),
+	})
+	memoryPressure := newConditionNode([]v1.NodeCondition{
+		nodeCondition(v1.NodeReady, v1.ConditionTrue, earlier),
+		nodeCondition(v1.NodeMemoryPressure, v1.ConditionTrue, earlier),
+	})
+
+	tests := []struct {
+		name   string
+		worker *v1.Node
+		old    *v1.Node
+		open   []string
+		// wantOpen are the types of the records left open, wantRecovers the types of the recoveries queued
+		wantOpen     []string
+		wantRecovers []string
+	}{
+		{"healthy", healthy, nil, nil, []string{}, []string{}},
+		{"pressure", memoryPressure, nil, nil, []string{models.RecordTypeNodeMemoryPressure}, []string{}},
+		{
+			"pressure within the grace period",
+			newConditionNode([]v1.NodeCondition{nodeCondition(v1.NodeMemoryPressure, v1.ConditionTrue, now)}),
+			nil,
+			nil,
+			[]string{},
+			[]string{},
+		},
+		{
+			"unreachable",
+			newConditionNode(nil,
+				nodeTaint(TaintNodeUnreachable, v1.TaintEffectNoSchedule, &earlier),
+				nodeTaint(TaintNodeUnreachable, v1.TaintEffectNoExecute, &earlier)),
+			nil,
+			nil,
+			[]string{models.RecordTypeNodeUnreachable},
+			[]string{},
+		},
+		{
+			"taint just seen",
+			newConditionNode(nil, nodeTaint(TaintNodeNotReady, v1.TaintEffectNoSchedule, nil)),
+			nil,
+			nil,
+			[]string{},
+			[]string{},
+		},
+		{
+			"pressure gone",
+			healthy,
+			memoryPressure,
+			[]string{models.RecordTypeNodeMemoryPressure},
+			[]string{},
+			[]string{models.RecordTypeNodeMemoryPressure},
+		},
+		{
+			"problems gone while not seen",
+			healthy,
+			nil,
+			[]string{models.RecordTypeNodeDiskPressure, models.RecordTypeNodeUnreachable},
+			[]string{},
+			[]string{models.RecordTypeNodeDiskPressure, models.RecordTypeNodeUnreachable},
+		},
+		{
+			"not ready left to checkReady",
+			newConditionNode([]v1.NodeCondition{nodeCondition(v1.NodeReady, v1.ConditionFalse, earlier)}),
+			nil,
+			[]string{models.RecordTypeNodeNotReady},
+			[]string{models.RecordTypeNodeNotReady},
+			[]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestDB(t)
+			stop := make(chan struct{})
+			defer close(stop)
+			c, _ := newTestWorkerController(t, stop)
+			for _, recordType := range test.open {
+				addOpenRecord(t, "node", recordType)
+			}
+
+			if err := c.checkProblems("node", test.worker, test.old); err != nil {
+				t.Fatalf("checkProblems() = %v", err)
+			}
+			// the problems are recorded once
+			if err := c.checkProblems("node", test.worker, test.worker); err != nil {
+				t.Fatalf("checkProblems() again = %v", err)
+			}
+			if got := openRecords(t, "node"); !reflect.DeepEqual(got, test.wantOpen) {
+				t.Errorf("open records = %v, want %v", got, test.wantOpen)
+			}
+			recovers := []string{}
+			for _, recover := range common.TakeRecovers() {
+				recovers = append(recovers, recover.Type)
+			}
+			if !reflect.DeepEqual(recovers, test.wantRecovers) {
+				t.Errorf("recoveries = %v, want %v", recovers, test.wantRecovers)
+			}
+			for _, recordType := range test.wantRecovers {
+				if c.problems.has("node", recordType) {
+					t.Errorf("resolved %s still remembered", recordType)
+				}
+			}
+		})
+	}
+}
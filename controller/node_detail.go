@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"net/http"
+	erroresult "node-controller/models/response/errors"
+	"sort"
+	"time"
+)
+
+// workers serves the node details, set by WorkerListener
+var workers *K8sWorkerController
+
+// detailResources are the resources compared in NodeDetail
+var detailResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage, v1.ResourcePods}
+
+type NodeDetail struct {
+	Node
+	Annotations map[string]string  `json:"annotations,omitempty"`
+	Conditions  []v1.NodeCondition `json:"conditions"`
+	Addresses   []v1.NodeAddress   `json:"addresses"`
+	Resources   []NodeResource     `json:"resources"`
+	Pods        []NodePod          `json:"pods"`
+}
+
+// NodeResource compares what the pods of a node request and are limited to with what it
+// can allocate. For pods, Requested and Limits are the number of pods.
+type NodeResource struct {
+	Name               v1.ResourceName   `json:"name"`
+	Allocatable        resource.Quantity `json:"allocatable"`
+	Requested          resource.Quantity `json:"requested"`
+	Limits             resource.Quantity `json:"limits"`
+	RequestedPercent   int64             `json:"requestedPercent"`
+	LimitsPercent      int64             `json:"limitsPercent"`
+	LimitsOvercommited bool              `json:"limitsOvercommited"`
+}
+
+type NodePod struct {
+	Namespace         string          `json:"namespace"`
+	Name              string          `json:"name"`
+	Owner             string          `json:"owner,omitempty"`
+	Phase             v1.PodPhase     `json:"phase"`
+	Ready             string          `json:"ready"`
+	Restarts          int32           `json:"restarts"`
+	PodIP             string          `json:"podIP,omitempty"`
+	Requests          v1.ResourceList `json:"requests,omitempty"`
+	Limits            v1.ResourceList `json:"limits,omitempty"`
+	CreationTimestamp metaV1.Time     `json:"creationTimestamp"`
+}
+
+// GetNodeDetail returns the detail of the node name
+func GetNodeDetail(name string) (*NodeDetail, error) {
+	if workers == nil {
+		return nil, &erroresult.ErrorResult{
+			Code:    http.StatusServiceUnavailable,
+			SubCode: http.StatusServiceUnavailable,
+			Msg:     "worker listener is not running",
+		}
+	}
+	return workers.NodeDetail(name)
+}
+
+// NodeDetail builds the detail of the node name from the listers
+func (c *K8sWorkerController) NodeDetail(name string) (*NodeDetail, error) {
+	node, err := c.workerList.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	cachePods, err := c.podList.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &NodeDetail{
+		Node:        c.toNode(node),
+		Annotations: node.Annotations,
+		Conditions:  node.Status.Conditions,
+		Addresses:   node.Status.Addresses,
+		Pods:        make([]NodePod, 0),
+	}
+
+	requested := v1.ResourceList{}
+	limits := v1.ResourceList{}
+	active := int64(0)
+	for _, pod := range cachePods {
+		if pod.Spec.NodeName != name {
+			continue
+		}
+		podRequests, podLimits := podRequestsAndLimits(pod)
+		detail.Pods = append(detail.Pods, toNodePod(pod, podRequests, podLimits))
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		active++
+		addResourceList(requested, podRequests)
+		addResourceList(limits, podLimits)
+	}
+	requested[v1.ResourcePods] = *resource.NewQuantity(active, resource.DecimalSI)
+	limits[v1.ResourcePods] = *resource.NewQuantity(active, resource.DecimalSI)
+	sort.Slice(detail.Pods, func(i, j int) bool {
+		if detail.Pods[i].Namespace != detail.Pods[j].Namespace {
+			return detail.Pods[i].Namespace < detail.Pods[j].Namespace
+		}
+		return detail.Pods[i].Name < detail.Pods[j].Name
+	})
+
+	for _, name := range detailResources {
+		allocatable := node.Status.Allocatable[name]
+		r := NodeResource{
+			Name:        name,
+			Allocatable: allocatable.DeepCopy(),
+			Requested:   requested[name].DeepCopy(),
+			Limits:      limits[name].DeepCopy(),
+		}
+		if allocatable.MilliValue() > 0 {
+			r.RequestedPercent = r.Requested.MilliValue() * 100 / allocatable.MilliValue()
+			r.LimitsPercent = r.Limits.MilliValue() * 100 / allocatable.MilliValue()
+		}
+		r.LimitsOvercommited = r.LimitsPercent > 100
+		detail.Resources = append(detail.Resources, r)
+	}
+	return detail, nil
+}
+
+// podRequestsAndLimits returns the requests and limits of pod like the scheduler sees them:
+// the sum of its containers or the largest init container when bigger
+func podRequestsAndLimits(pod *v1.Pod) (v1.ResourceList, v1.ResourceList) {
+	requests, limits := v1.ResourceList{}, v1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResourceList(requests, container.Resources.Requests)
+		addResourceList(limits, container.Resources.Limits)
+	}
+	for _, container := range pod.Spec.InitContainers {
+		maxResourceList(requests, container.Resources.Requests)
+		maxResourceList(limits, container.Resources.Limits)
+	}
+	return requests, limits
+}
+
+func addResourceList(list v1.ResourceList, add v1.ResourceList) {
+	for name, quantity := range add {
+		value, ok := list[name]
+		if !ok {
+			list[name] = quantity.DeepCopy()
+			continue
+		}
+		value.Add(quantity)
+		list[name] = value
+	}
+}
+
+func maxResourceList(list v1.ResourceList, other v1.ResourceList) {
+	for name, quantity := range other {
+		if value, ok := list[name]; !ok || quantity.Cmp(value) > 0 {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+func toNodePod(pod *v1.Pod, requests v1.ResourceList, limits v1.ResourceList) NodePod {
+	nodePod := NodePod{
+		Namespace:         pod.Namespace,
+		Name:              pod.Name,
+		Phase:             pod.Status.Phase,
+		PodIP:             pod.Status.PodIP,
+		Requests:          requests,
+		Limits:            limits,
+		CreationTimestamp: pod.CreationTimestamp,
+	}
+	if owner := metaV1.GetControllerOf(pod); owner != nil {
+		nodePod.Owner = owner.Kind + "/" + owner.Name
+	}
+	ready := 0
+	for _, status := range pod.Status.ContainerStatuses {
+		nodePod.Restarts += status.RestartCount
+		if status.Ready {
+			ready++
+		}
+	}
+	nodePod.Ready = fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers))
+	return nodePod
+}
+
+// toNode is toNodeSummary with the heartbeat problem of node
+func (c *K8sWorkerController) toNode(node *v1.Node) Node {
+	n := toNodeSummary(node)
+	if problem := c.heartbeatProblem(node.Name, time.Now()); problem != nil {
+		n.Status.Problems = append(n.Status.Problems, *problem)
+	}
+	return n
+}
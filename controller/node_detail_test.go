@@ -0,0 +1,148 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+)
+
+// newDetailPod is the pod namespace/name on nodeName with a container of requests and limits
+func newDetailPod(namespace string, name string, nodeName string, phase v1.PodPhase, requests v1.ResourceList, limits v1.ResourceList) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: v1.PodSpec{
+			NodeName: nodeName,
+			Containers: []v1.Container{{
+				Name:      "app",
+				Resources: v1.ResourceRequirements{Requests: requests, Limits: limits},
+			}},
+		},
+		Status: v1.PodStatus{Phase: phase},
+	}
+}
+
+func resources(cpu string, memory string) v1.ResourceList {
+	return v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu), v1.ResourceMemory: resource.MustParse(memory)}
+}
+
+func TestNodeDetail(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node", Annotations: map[string]string{"zone": "a"}},
+		Status: v1.NodeStatus{
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("4"),
+				v1.ResourceMemory: resource.MustParse("8Gi"),
+				v1.ResourcePods:   resource.MustParse("110"),
+			},
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+			Addresses:  []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "10.0.0.1"}},
+		},
+	}
+	web := newDetailPod("web", "web-1", "node", v1.PodRunning, resources("1", "1Gi"), resources("2", "2Gi"))
+	web.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "app", Ready: true, RestartCount: 2}}
+	isController := true
+	web.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d8", Controller: &isController}}
+	// the init container asks more cpu than the containers, the largest counts
+	batch := newDetailPod("batch", "job-1", "node", v1.PodPending, resources("500m", "1Gi"), resources("6", "8Gi"))
+	batch.Spec.InitContainers = []v1.Container{{Name: "init", Resources: v1.ResourceRequirements{Requests: resources("2", "512Mi")}}}
+	completed := newDetailPod("batch", "job-0", "node", v1.PodSucceeded, resources("3", "3Gi"), nil)
+	elsewhere := newDetailPod("web", "web-2", "other", v1.PodRunning, resources("1", "1Gi"), nil)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	c, _ := newTestWorkerController(t, stop, node, web, batch, completed, elsewhere)
+
+	detail, err := c.NodeDetail("node")
+	if err != nil {
+		t.Fatalf("NodeDetail() = %v", err)
+	}
+	if detail.Name != "node" || !reflect.DeepEqual(detail.Annotations, node.Annotations) ||
+		!reflect.DeepEqual(detail.Conditions, node.Status.Conditions) || !reflect.DeepEqual(detail.Addresses, node.Status.Addresses) {
+		t.Errorf("node of the detail = %+v, want node %+v", detail, node)
+	}
+
+	// the pods of the node, sorted by namespace and name
+	pods := make([][3]string, 0)
+	for _, pod := range detail.Pods {
+		pods = append(pods, [3]string{pod.Namespace + "/" + pod.Name, pod.Owner, pod.Ready})
+	}
+	wantPods := [][3]string{{"batch/job-0", "", "0/1"}, {"batch/job-1", "", "0/1"}, {"web/web-1", "ReplicaSet/web-5d8", "1/1"}}
+	if !reflect.DeepEqual(pods, wantPods) {
+		t.Errorf("pods = %v, want %v", pods, wantPods)
+	}
+	if restarts := detail.Pods[2].Restarts; restarts != 2 {
+		t.Errorf("restarts of web/web-1 = %d, want 2", restarts)
+	}
+
+	// the completed pod is not counted
+	tests := []struct {
+		name             v1.ResourceName
+		requested        string
+		limits           string
+		requestedPercent int64
+		limitsPercent    int64
+		overcommited     bool
+	}{
+		{v1.ResourceCPU, "3", "8", 75, 200, true},
+		{v1.ResourceMemory, "2Gi", "10Gi", 25, 125, true},
+		{v1.ResourceEphemeralStorage, "0", "0", 0, 0, false},
+		{v1.ResourcePods, "2", "2", 1, 1, false},
+	}
+	if len(detail.Resources) != len(tests) {
+		t.Fatalf("resources = %+v, want %d", detail.Resources, len(tests))
+	}
+	for i, test := range tests {
+		r := detail.Resources[i]
+		if r.Name != test.name {
+			t.Errorf("resource %d = %s, want %s", i, r.Name, test.name)
+			continue
+		}
+		if r.Requested.Cmp(resource.MustParse(test.requested)) != 0 || r.Limits.Cmp(resource.MustParse(test.limits)) != 0 {
+			t.Errorf("%s: requested %s limits %s, want %s and %s", test.name, r.Requested.String(), r.Limits.String(), test.requested, test.limits)
+		}
+		if r.RequestedPercent != test.requestedPercent || r.LimitsPercent != test.limitsPercent || r.LimitsOvercommited != test.overcommited {
+			t.Errorf("%s: requested %d%% limits %d%% overcommited %v, want %d%% %d%% %v",
+				test.name, r.RequestedPercent, r.LimitsPercent, r.LimitsOvercommited, test.requestedPercent, test.limitsPercent, test.overcommited)
+		}
+	}
+
+	if _, err := c.NodeDetail("missing"); !errors.IsNotFound(err) {
+		t.Errorf("NodeDetail() of a missing node = %v, want not found", err)
+	}
+}
+
+func TestNodeDetailWhileUpdated(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	stop := make(chan struct{})
+	defer close(stop)
+	c, client := newTestWorkerController(t, stop, node)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			pod := newDetailPod("default", name, "node", v1.PodRunning, resources("100m", "128Mi"), nil)
+			if _, err := client.CoreV1().Pods("default").Create(pod); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		detail, err := c.NodeDetail("node")
+		if err != nil {
+			t.Fatalf("NodeDetail() = %v", err)
+		}
+		// the detail is built from one listing, every pod listed is counted
+		if pods := detail.Resources[3].Requested.Value(); pods != int64(len(detail.Pods)) {
+			t.Fatalf("pods requested = %d, want the %d pods listed", pods, len(detail.Pods))
+		}
+	}
+	<-done
+	eventually(t, func() bool {
+		detail, err := c.NodeDetail("node")
+		return err == nil && len(detail.Pods) == 5
+	})
+}
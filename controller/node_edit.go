@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"net/http"
+	erroresult "node-controller/models/response/errors"
+	"strings"
+)
+
+// LabelChange sets and removes labels of a node
+type LabelChange struct {
+	Set    map[string]string `json:"set"`
+	Remove []string          `json:"remove"`
+}
+
+// TaintChange adds or updates and removes taints of a node. A taint to remove without
+// effect removes the taints of its key with any effect.
+type TaintChange struct {
+	Set    []v1.Taint `json:"set"`
+	Remove []v1.Taint `json:"remove"`
+}
+
+var taintEffects = map[v1.TaintEffect]bool{
+	v1.TaintEffectNoSchedule:       true,
+	v1.TaintEffectPreferNoSchedule: true,
+	v1.TaintEffectNoExecute:        true,
+}
+
+func invalid(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &erroresult.ErrorResult{
+		Code:    http.StatusBadRequest,
+		SubCode: http.StatusBadRequest,
+		Msg:     strings.Join(errs, "; "),
+	}
+}
+
+// Validate checks the label keys and values against the Kubernetes rules
+func (c *LabelChange) Validate() error {
+	errs := make([]string, 0)
+	if len(c.Set) == 0 && len(c.Remove) == 0 {
+		errs = append(errs, "no label to set or remove")
+	}
+	for key, value := range c.Set {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs = append(errs, fmt.Sprintf("label key %q: %s", key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(value) {
+			errs = append(errs, fmt.Sprintf("label %s value %q: %s", key, value, msg))
+		}
+	}
+	for _, key := range c.Remove {
+		if _, ok := c.Set[key]; ok {
+			errs = append(errs, fmt.Sprintf("label %s is both set and removed", key))
+		}
+	}
+	return invalid(errs)
+}
+
+// Validate checks the taint keys, values and effects against the Kubernetes rules
+func (c *TaintChange) Validate() error {
+	errs := make([]string, 0)
+	if len(c.Set) == 0 && len(c.Remove) == 0 {
+		errs = append(errs, "no taint to set or remove")
+	}
+	set := make(map[string]bool, len(c.Set))
+	for _, taint := range c.Set {
+		for _, msg := range validation.IsQualifiedName(taint.Key) {
+			errs = append(errs, fmt.Sprintf("taint key %q: %s", taint.Key, msg))
+		}
+		for _, msg := range validation.IsValidLabelValue(taint.Value) {
+			errs = append(errs, fmt.Sprintf("taint %s value %q: %s", taint.Key, taint.Value, msg))
+		}
+		if !taintEffects[taint.Effect] {
+			errs = append(errs, fmt.Sprintf("taint %s effect %q: must be NoSchedule, PreferNoSchedule or NoExecute", taint.Key, taint.Effect))
+		}
+		if set[taintKey(taint)] {
+			errs = append(errs, fmt.Sprintf("taint %s is set twice", taintKey(taint)))
+		}
+		set[taintKey(taint)] = true
+	}
+	for _, taint := range c.Remove {
+		if taint.Effect != "" && !taintEffects[taint.Effect] {
+			errs = append(errs, fmt.Sprintf("taint %s effect %q: must be NoSchedule, PreferNoSchedule or NoExecute", taint.Key, taint.Effect))
+		}
+		for _, t := range c.Set {
+			if t.Key == taint.Key && (taint.Effect == "" || t.Effect == taint.Effect) {
+				errs = append(errs, fmt.Sprintf("taint %s is both set and removed", taintKey(t)))
+			}
+		}
+	}
+	return invalid(errs)
+}
+
+// UpdateNodeLabels applies change to the labels of nodeName
+func UpdateNodeLabels(kubeClient kubernetes.Interface, nodeName string, resourceVersion string, change *LabelChange) (*v1.Node, error) {
+	return patchNode(kubeClient, nodeName, resourceVersion, func(node *v1.Node) error {
+		managed := splitAnnotation(node.Annotations[AnnotationManagedLabels])
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+		for key, value := range change.Set {
+			if managed[key] {
+				return managedByVirtulMachine("label", key)
+			}
+			node.Labels[key] = value
+		}
+		for _, key := range change.Remove {
+			if managed[key] {
+				return managedByVirtulMachine("label", key)
+			}
+			delete(node.Labels, key)
+		}
+		return nil
+	})
+}
+
+// UpdateNodeTaints applies change to the taints of nodeName
+func UpdateNodeTaints(kubeClient kubernetes.Interface, nodeName string, resourceVersion string, change *TaintChange) (*v1.Node, error) {
+	return patchNode(kubeClient, nodeName, resourceVersion, func(node *v1.Node) error {
+		managed := splitAnnotation(node.Annotations[AnnotationManagedTaints])
+		taints := make([]v1.Taint, 0, len(node.Spec.Taints)+len(change.Set))
+		for _, taint := range node.Spec.Taints {
+			removed := false
+			for _, t := range change.Remove {
+				if t.Key == taint.Key && (t.Effect == "" || t.Effect == taint.Effect) {
+					removed = true
+				}
+			}
+			for _, t := range change.Set {
+				if taintKey(t) == taintKey(taint) {
+					removed = true
+				}
+			}
+			if !removed {
+				taints = append(taints, taint)
+			} else if managed[taintKey(taint)] {
+				return managedByVirtulMachine("taint", taintKey(taint))
+			}
+		}
+		for _, taint := range change.Set {
+			if managed[taintKey(taint)] {
+				return managedByVirtulMachine("taint", taintKey(taint))
+			}
+			if taint.Effect == v1.TaintEffectNoExecute && taint.TimeAdded == nil {
+				now := metav1.Now()
+				taint.TimeAdded = &now
+			}
+			taints = append(taints, taint)
+		}
+		if len(taints) == 0 {
+			taints = nil
+		}
+		node.Spec.Taints = taints
+		return nil
+	})
+}
+
+func managedByVirtulMachine(kind string, key string) error {
+	return &erroresult.ErrorResult{
+		Code:    http.StatusConflict,
+		SubCode: http.StatusConflict,
+		Msg:     fmt.Sprintf("%s %s is managed by the VirtulMachine of the node", kind, key),
+	}
+}
+
+// patchNode patches nodeName with the changes made by mutate on a copy of it. The patch
+// carries resourceVersion, the current one when empty, so that a concurrent edit fails
+// with a conflict.
+func patchNode(kubeClient kubernetes.Interface, nodeName string, resourceVersion string, mutate func(node *v1.Node) error) (*v1.Node, error) {
+	node, err := kubeClient.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if resourceVersion == "" {
+		resourceVersion = node.ResourceVersion
+	}
+	desired := node.DeepCopy()
+	if err := mutate(desired); err != nil {
+		return nil, err
+	}
+
+	oldData, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	newData, err := json.Marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := strategicpatch.CreateTwoWayMergePatch(oldData, newData, v1.Node{})
+	if err != nil {
+		return nil, err
+	}
+	if string(patch) == "{}" && resourceVersion == node.ResourceVersion {
+		return node, nil
+	}
+	patch, err = withResourceVersion(patch, resourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return kubeClient.CoreV1().Nodes().Patch(nodeName, types.StrategicMergePatchType, patch)
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"net/http"
+	erroresult "node-controller/models/response/errors"
+	"strings"
+	"testing"
+)
+
+// checkInvalid checks that err is nil when wantErr is empty, or a bad request mentioning wantErr
+func checkInvalid(t *testing.T, name string, err error, wantErr string) {
+	t.Helper()
+	if wantErr == "" {
+		if err != nil {
+			t.Errorf("%s: Validate() = %v, want nil", name, err)
+		}
+		return
+	}
+	result, ok := err.(*erroresult.ErrorResult)
+	if !ok || result.Code != http.StatusBadRequest {
+		t.Errorf("%s: Validate() = %#v, want a bad request", name, err)
+		return
+	}
+	if !strings.Contains(result.Msg, wantErr) {
+		t.Errorf("%s: Validate() = %q, want it to mention %q", name, result.Msg, wantErr)
+	}
+}
+
+func TestLabelChangeValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  LabelChange
+		wantErr string
+	}{
+		{"empty", LabelChange{}, "no label to set or remove"},
+		{"set", LabelChange{Set: map[string]string{"node-role.kubernetes.io/gpu": "true", "zone": ""}}, ""},
+		{"remove", LabelChange{Remove: []string{"zone"}}, ""},
+		{"invalid key", LabelChange{Set: map[string]string{"bad key": "a"}}, `label key "bad key"`},
+		{"invalid prefix", LabelChange{Set: map[string]string{"Bad_Prefix/zone": "a"}}, `label key "Bad_Prefix/zone"`},
+		{"invalid value", LabelChange{Set: map[string]string{"zone": "a b"}}, `label zone value "a b"`},
+		{"value too long", LabelChange{Set: map[string]string{"zone": strings.Repeat("a", 64)}}, "label zone value"},
+		{"set and removed", LabelChange{Set: map[string]string{"zone": "a"}, Remove: []string{"zone"}}, "label zone is both set and removed"},
+	}
+	for _, test := range tests {
+		checkInvalid(t, test.name, test.change.Validate(), test.wantErr)
+	}
+}
+
+func TestTaintChangeValidate(t *testing.T) {
+	noSchedule := v1.Taint{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}
+	tests := []struct {
+		name    string
+		change  TaintChange
+		wantErr string
+	}{
+		{"empty", TaintChange{}, "no taint to set or remove"},
+		{"set", TaintChange{Set: []v1.Taint{noSchedule, {Key: "dedicated", Effect: v1.TaintEffectNoExecute}}}, ""},
+		{"remove any effect", TaintChange{Remove: []v1.Taint{{Key: "dedicated"}}}, ""},
+		{"invalid key", TaintChange{Set: []v1.Taint{{Key: "bad key", Effect: v1.TaintEffectNoSchedule}}}, `taint key "bad key"`},
+		{"invalid value", TaintChange{Set: []v1.Taint{{Key: "dedicated", Value: "a b", Effect: v1.TaintEffectNoSchedule}}}, `taint dedicated value "a b"`},
+		{"missing effect", TaintChange{Set: []v1.Taint{{Key: "dedicated"}}}, `taint dedicated effect ""`},
+		{"invalid effect", TaintChange{Set: []v1.Taint{{Key: "dedicated", Effect: "NoRun"}}}, `taint dedicated effect "NoRun"`},
+		{"invalid effect removed", TaintChange{Remove: []v1.Taint{{Key: "dedicated", Effect: "NoRun"}}}, `taint dedicated effect "NoRun"`},
+		{"set twice", TaintChange{Set: []v1.Taint{noSchedule, noSchedule}}, "taint dedicated:NoSchedule is set twice"},
+		{"set and removed", TaintChange{Set: []v1.Taint{noSchedule}, Remove: []v1.Taint{noSchedule}}, "taint dedicated:NoSchedule is both set and removed"},
+		{"set and removed with any effect", TaintChange{Set: []v1.Taint{noSchedule}, Remove: []v1.Taint{{Key: "dedicated"}}}, "taint dedicated:NoSchedule is both set and removed"},
+		{"other effect removed", TaintChange{Set: []v1.Taint{noSchedule}, Remove: []v1.Taint{{Key: "dedicated", Effect: v1.TaintEffectNoExecute}}}, ""},
+	}
+	for _, test := range tests {
+		checkInvalid(t, test.name, test.change.Validate(), test.wantErr)
+	}
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	apiv1alpha1 "node-controller/api/virtulmachinecontroller/v1alpha1"
+	"node-controller/events"
+)
+
+// ConditionChange is the object of the WorkerConditionChanged events, OldStatus is empty
+// when the condition is new
+type ConditionChange struct {
+	Node               string               `json:"node"`
+	Type               v1.NodeConditionType `json:"type"`
+	OldStatus          v1.ConditionStatus   `json:"oldStatus,omitempty"`
+	Status             v1.ConditionStatus   `json:"status"`
+	Reason             string               `json:"reason,omitempty"`
+	Message            string               `json:"message,omitempty"`
+	LastTransitionTime metaV1.Time          `json:"lastTransitionTime"`
+}
+
+// Removed is the object of the removal events
+type Removed struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// publishWorker sends the events of the change of a node from oldWorker to newWorker,
+// oldWorker is nil when the node is added
+func (c *K8sWorkerController) publishWorker(oldWorker *v1.Node, newWorker *v1.Node) {
+	if oldWorker == nil {
+		events.Events.Publish(events.WorkerAdded, c.toNode(newWorker))
+		return
+	}
+
+	for _, condition := range newWorker.Status.Conditions {
+		change := ConditionChange{
+			Node:               newWorker.Name,
+			Type:               condition.Type,
+			Status:             condition.Status,
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+			LastTransitionTime: condition.LastTransitionTime,
+		}
+		for _, old := range oldWorker.Status.Conditions {
+			if old.Type == condition.Type {
+				change.OldStatus = old.Status
+			}
+		}
+		if change.OldStatus != change.Status {
+			events.Events.Publish(events.WorkerConditionChanged, change)
+		}
+	}
+	// the status of a node is updated on every heartbeat, only changes of the summary are sent
+	if !equality.Semantic.DeepEqual(toNodeSummary(oldWorker), toNodeSummary(newWorker)) {
+		events.Events.Publish(events.WorkerUpdated, c.toNode(newWorker))
+	}
+}
+
+// publishRemoved sends the event t for the deleted object obj
+func publishRemoved(t string, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	switch o := obj.(type) {
+	case *v1.Node:
+		events.Events.Publish(t, Removed{Name: o.Name})
+	case *apiv1alpha1.VirtulMachine:
+		events.Events.Publish(t, Removed{Namespace: o.Namespace, Name: o.Name})
+	}
+}
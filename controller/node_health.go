@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/astaxie/beego"
+	v1 "k8s.io/api/core/v1"
+	"node-controller/common"
+	"node-controller/models"
+	"node-controller/util/logs"
+	"sync"
+	"time"
+)
+
+// outages remembers the start of the outages recorded per node, so that the
+// database is only asked once per outage.
+type outages struct {
+	sync.Mutex
+	recorded map[string]time.Time
+}
+
+func (o *outages) isRecorded(nodeName string, start time.Time) bool {
+	o.Lock()
+	defer o.Unlock()
+	recorded, ok := o.recorded[nodeName]
+	return ok && recorded.Equal(start)
+}
+
+func (o *outages) record(nodeName string, start time.Time) {
+	o.Lock()
+	defer o.Unlock()
+	o.recorded[nodeName] = start
+}
+
+func (o *outages) forget(nodeName string) {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.recorded, nodeName)
+}
+
+func nodeNotReadyGracePeriod() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("NodeNotReadyGracePeriod", 120)) * time.Second
+}
+
+func getNodeCondition(node *v1.Node, conditionType v1.NodeConditionType) *v1.NodeCondition {
+	if node == nil {
+		return nil
+	}
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == conditionType {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// checkReady follows the NodeReady condition of worker. An outage is recorded once
+// the condition has not been True for longer than the grace period, until then the
+// node is checked again when the grace period ends. old is the previous version of
+// worker, nil when unknown.
+func (c *K8sWorkerController) checkReady(key string, worker *v1.Node, old *v1.Node) error {
+	ready := getNodeCondition(worker, v1.NodeReady)
+	if ready == nil {
+		return nil
+	}
+	oldReady := getNodeCondition(old, v1.NodeReady)
+
+	if ready.Status == v1.ConditionTrue {
+		if oldReady != nil && oldReady.Status != v1.ConditionTrue {
+			logs.Info("node %s is ready again", worker.Name)
+		}
+		// open records are looked up on transitions and for nodes not seen Ready yet
+		if oldReady == nil || oldReady.Status != v1.ConditionTrue {
+			if err := resolveRecords(worker.Name, ready.LastTransitionTime.Time, models.RecordTypeNodeNotReady, models.RecordTypeNodeLost); err != nil {
+				return err
+			}
+		}
+		c.outages.forget(worker.Name)
+		return nil
+	}
+
+	if oldReady != nil && oldReady.Status == v1.ConditionTrue {
+		logs.Warning("node %s became %s: %s", worker.Name, ready.Status, ready.Reason)
+	}
+	start := ready.LastTransitionTime.Time
+	if c.outages.isRecorded(worker.Name, start) {
+		return nil
+	}
+	grace := nodeNotReadyGracePeriod()
+	if elapsed := time.Since(start); elapsed < grace {
+		c.reconciler.EnqueueAfter(key, grace-elapsed)
+		return nil
+	}
+
+	reason := ready.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("Ready%s", ready.Status)
+	}
+	exists, err := models.RecordMode.Exist(worker.Name, reason, start)
+	if err != nil {
+		logs.Error("查询告警记录失败, ", err)
+		return err
+	}
+	if !exists {
+		record := &models.Record{
+			User:        "",
+			HostName:    worker.Name,
+			Type:        models.RecordTypeNodeNotReady,
+			Severity:    models.SeverityCritical,
+			Description: fmt.Sprintf("worker节点NotReady(%s)超过%s: %s", ready.Status, grace, ready.Message),
+			Reason:      reason,
+			Message:     ready.Message,
+			StartTime:   &start,
+			Status:      models.RecordTobeAltert,
+		}
+		record.SetLabels(worker.Labels)
+		if err := models.RecordMode.Add(record); err != nil {
+			logs.Error("记录告警记录失败, ", err)
+			return err
+		}
+		logs.Warning("node %s not ready since %s, outage recorded", worker.Name, start.Format("2006-01-02 15:04:05"))
+	}
+	c.outages.record(worker.Name, start)
+	return nil
+}
+
+// resolveRecords closes the open records of nodeName with one of types and queues
+// a recovery message for each of them.
+func resolveRecords(nodeName string, resolveTime time.Time, types ...string) error {
+	records, err := models.RecordMode.ListOpen(nodeName, types...)
+	if err != nil {
+		logs.Error("查询未恢复告警记录失败, ", err)
+		return err
+	}
+	for i := range records {
+		record := &records[i]
+		if err := models.RecordMode.Resolve(record, resolveTime); err != nil {
+			logs.Error("更新告警恢复记录失败, ", err)
+			return err
+		}
+		logs.Info("record %d of node %s resolved after %ds", record.Id, nodeName, record.Duration)
+		common.AddRecover(recoverMessage(record))
+	}
+	return nil
+}
+
+func recoverMessage(record *models.Record) common.Ready2Send {
+	start := ""
+	if record.StartTime != nil {
+		start = record.StartTime.Format("2006-01-02 15:04:05")
+	} else if record.CreateTime != nil {
+		start = record.CreateTime.Format("2006-01-02 15:04:05")
+	}
+	return common.Ready2Send{
+		Id:       record.Id,
+		HostName: record.HostName,
+		Title:    record.Subject() + " 已恢复",
+		Start:    start,
+		User:     record.User,
+		Type:     record.Type,
+		Severity: record.Severity,
+		Labels:   record.LabelMap(),
+		Alerts: "- [恢复通知] " + record.Subject() + "\n" +
+			"- [告警内容] " + record.Description + "\n" +
+			"- [开始时间] " + start + "\n" +
+			"- [恢复时间] " + record.ResolveTime.Format("2006-01-02 15:04:05") + "\n" +
+			"- [持续时间] " + (time.Duration(record.Duration) * time.Second).String(),
+	}
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"node-controller/common"
+	"node-controller/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckReady(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	ready := newConditionNode([]v1.NodeCondition{nodeCondition(v1.NodeReady, v1.ConditionTrue, now)})
+	notReady := newConditionNode([]v1.NodeCondition{nodeCondition(v1.NodeReady, v1.ConditionFalse, earlier)})
+
+	tests := []struct {
+		name   string
+		worker *v1.Node
+		old    *v1.Node
+		open   []string
+		// wantOpen are the types of the records left open, wantRecovers the types of the recoveries queued
+		wantOpen     []string
+		wantRecovers []string
+	}{
+		{"ready", ready, nil, nil, []string{}, []string{}},
+		{"no ready condition", newConditionNode(nil), nil, []string{models.RecordTypeNodeNotReady}, []string{models.RecordTypeNodeNotReady}, []string{}},
+		{"not ready", notReady, nil, nil, []string{models.RecordTypeNodeNotReady}, []string{}},
+		{
+			"not ready within the grace period",
+			newConditionNode([]v1.NodeCondition{nodeCondition(v1.NodeReady, v1.ConditionUnknown, now)}),
+			nil,
+			nil,
+			[]string{},
+			[]string{},
+		},
+		{
+			"ready again",
+			ready,
+			notReady,
+			[]string{models.RecordTypeNodeNotReady},
+			[]string{},
+			[]string{models.RecordTypeNodeNotReady},
+		},
+		{
+			"ready when first seen",
+			ready,
+			nil,
+			[]string{models.RecordTypeNodeNotReady, models.RecordTypeNodeLost, models.RecordTypeNodeMemoryPressure},
+			[]string{models.RecordTypeNodeMemoryPressure},
+			[]string{models.RecordTypeNodeNotReady, models.RecordTypeNodeLost},
+		},
+		{
+			"still ready",
+			ready,
+			ready,
+			[]string{models.RecordTypeNodeNotReady},
+			[]string{models.RecordTypeNodeNotReady},
+			[]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestDB(t)
+			stop := make(chan struct{})
+			defer close(stop)
+			c, _ := newTestWorkerController(t, stop)
+			for _, recordType := range test.open {
+				addOpenRecord(t, "node", recordType)
+			}
+
+			if err := c.checkReady("node", test.worker, test.old); err != nil {
+				t.Fatalf("checkReady() = %v", err)
+			}
+			// nothing more is recorded nor resolved by the next update
+			if err := c.checkReady("node", test.worker, test.worker); err != nil {
+				t.Fatalf("checkReady() again = %v", err)
+			}
+			if got := openRecords(t, "node"); !reflect.DeepEqual(got, test.wantOpen) {
+				t.Errorf("open records = %v, want %v", got, test.wantOpen)
+			}
+			recovers := []string{}
+			for _, recover := range common.TakeRecovers() {
+				recovers = append(recovers, recover.Type)
+			}
+			if !reflect.DeepEqual(recovers, test.wantRecovers) {
+				t.Errorf("recoveries = %v, want %v", recovers, test.wantRecovers)
+			}
+		})
+	}
+}
+
+func TestCheckReadyRecovered(t *testing.T) {
+	useTestDB(t)
+	stop := make(chan struct{})
+	defer close(stop)
+	c, _ := newTestWorkerController(t, stop)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	notReady := newConditionNode([]v1.NodeCondition{nodeCondition(v1.NodeReady, v1.ConditionFalse, start)})
+	notReady.Labels = map[string]string{"zone": "a"}
+
+	if err := c.checkReady("node", notReady, nil); err != nil {
+		t.Fatalf("checkReady() = %v", err)
+	}
+	records, err := models.RecordMode.ListOpen("node", models.RecordTypeNodeNotReady)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("open outage records = %d, want 1", len(records))
+	}
+	outage := records[0]
+
+	recovered := start.Add(30 * time.Minute)
+	ready := newConditionNode([]v1.NodeCondition{nodeCondition(v1.NodeReady, v1.ConditionTrue, recovered)})
+	ready.Labels = notReady.Labels
+	if err := c.checkReady("node", ready, notReady); err != nil {
+		t.Fatalf("checkReady() ready = %v", err)
+	}
+	if err := c.checkReady("node", ready, ready); err != nil {
+		t.Fatalf("checkReady() still ready = %v", err)
+	}
+
+	if got := openRecords(t, "node"); len(got) != 0 {
+		t.Errorf("open records = %v, want none", got)
+	}
+	resolved, err := models.RecordMode.GetById(outage.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Status != models.RecordResolved || resolved.Duration != int64((30*time.Minute)/time.Second) {
+		t.Errorf("outage status = %v, duration = %ds, want %v after %ds", resolved.Status, resolved.Duration, models.RecordResolved, int64((30*time.Minute)/time.Second))
+	}
+
+	recovers := common.TakeRecovers()
+	if len(recovers) != 1 {
+		t.Fatalf("recoveries = %+v, want exactly one", recovers)
+	}
+	recover := recovers[0]
+	want := common.Ready2Send{
+		Id:       outage.Id,
+		HostName: "node",
+		Title:    "node 已恢复",
+		Start:    start.Format("2006-01-02 15:04:05"),
+		Type:     models.RecordTypeNodeNotReady,
+		Severity: models.SeverityCritical,
+		Labels:   map[string]string{"zone": "a"},
+	}
+	alerts := recover.Alerts
+	recover.Alerts = ""
+	if !reflect.DeepEqual(recover, want) {
+		t.Errorf("recovery = %+v, want %+v", recover, want)
+	}
+	for _, line := range []string{
+		"- [恢复通知] node",
+		"- [开始时间] " + start.Format("2006-01-02 15:04:05"),
+		"- [恢复时间] " + recovered.Format("2006-01-02 15:04:05"),
+		"- [持续时间] 30m0s",
+	} {
+		if !strings.Contains(alerts, line) {
+			t.Errorf("recovery alerts %q do not contain %q", alerts, line)
+		}
+	}
+	if c.outages.isRecorded("node", start) {
+		t.Errorf("outage still remembered once ready")
+	}
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/astaxie/beego"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"node-controller/leader"
+	"node-controller/models"
+	"node-controller/util/logs"
+	"time"
+)
+
+// NodeLeaseNamespace holds the Lease renewed by the kubelet of each node
+const NodeLeaseNamespace = "kube-node-lease"
+
+// nodeHeartbeatTimeout is how long a node lease may go without renewal, it is meant
+// to be shorter than the node monitor grace period of the node lifecycle controller
+func nodeHeartbeatTimeout() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("NodeHeartbeatTimeout", 30)) * time.Second
+}
+
+func nodeHeartbeatCheckInterval() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("NodeHeartbeatCheckInterval", 10)) * time.Second
+}
+
+// heartbeatAge returns the time since the last renewal of lease, false when it was never renewed
+func heartbeatAge(lease *coordinationv1.Lease, now time.Time) (time.Duration, bool) {
+	if lease == nil || lease.Spec.RenewTime == nil {
+		return 0, false
+	}
+	return now.Sub(lease.Spec.RenewTime.Time), true
+}
+
+// heartbeatProblem returns the stale heartbeat problem of the node nodeName, nil when its lease is fresh
+func (c *K8sWorkerController) heartbeatProblem(nodeName string, now time.Time) *NodeProblem {
+	lease, err := c.leaseList.Leases(NodeLeaseNamespace).Get(nodeName)
+	if err != nil {
+		return nil
+	}
+	age, ok := heartbeatAge(lease, now)
+	if !ok || age <= nodeHeartbeatTimeout() {
+		return nil
+	}
+	return &NodeProblem{
+		Type:     models.RecordTypeNodeHeartbeatStale,
+		Severity: models.SeverityCritical,
+		Reason:   "LeaseNotRenewed",
+		Message:  fmt.Sprintf("kubelet lease not renewed for %s", age.Truncate(time.Second)),
+		Since:    metaV1.NewTime(lease.Spec.RenewTime.Time),
+	}
+}
+
+// checkHeartbeats records the nodes whose lease is older than the heartbeat timeout
+// and resolves them once the lease is renewed again.
+func (c *K8sWorkerController) checkHeartbeats() {
+	defer recoverException()
+	if !leader.IsLeader() || !c.leaseSynced() || !c.workerSynced() {
+		return
+	}
+	leases, err := c.leaseList.Leases(NodeLeaseNamespace).List(labels.Everything())
+	if err != nil {
+		logs.Error("failed to list node leases: %s", err.Error())
+		return
+	}
+
+	now := time.Now()
+	present := make(map[string]bool, len(leases))
+	for _, lease := range leases {
+		present[lease.Name] = true
+		worker, err := c.workerList.Get(lease.Name)
+		if err != nil {
+			// deleted nodes are reported as lost
+			if !errors.IsNotFound(err) {
+				logs.Error("failed to get node %s: %s", lease.Name, err.Error())
+			}
+			continue
+		}
+
+		problem := c.heartbeatProblem(worker.Name, now)
+		if problem == nil {
+			// open records are looked up once per node and when it recovers
+			if c.problems.has(worker.Name, models.RecordTypeNodeHeartbeatStale) || !c.heartbeatsChecked[worker.Name] {
+				age, _ := heartbeatAge(lease, now)
+				if c.problems.has(worker.Name, models.RecordTypeNodeHeartbeatStale) {
+					logs.Info("node %s heartbeat renewed %s ago", worker.Name, age.Truncate(time.Second))
+				}
+				if err := resolveRecords(worker.Name, now, models.RecordTypeNodeHeartbeatStale); err != nil {
+					continue
+				}
+				c.problems.forget(worker.Name, models.RecordTypeNodeHeartbeatStale)
+				c.heartbeatsChecked[worker.Name] = true
+			}
+			continue
+		}
+		c.heartbeatsChecked[worker.Name] = true
+
+		start := problem.Since.Time
+		if c.problems.isRecorded(worker.Name, problem.Type, start) {
+			continue
+		}
+		exists, err := models.RecordMode.ExistType(worker.Name, problem.Type, start)
+		if err != nil {
+			logs.Error("查询告警记录失败, ", err)
+			continue
+		}
+		if !exists {
+			record := &models.Record{
+				User:        "",
+				HostName:    worker.Name,
+				Type:        problem.Type,
+				Severity:    problem.Severity,
+				Description: fmt.Sprintf("worker节点心跳超时, 最后续约于%s", start.Format("2006-01-02 15:04:05")),
+				Reason:      problem.Reason,
+				Message:     problem.Message,
+				StartTime:   &start,
+				Status:      models.RecordTobeAltert,
+			}
+			record.SetLabels(worker.Labels)
+			if err := models.RecordMode.Add(record); err != nil {
+				logs.Error("记录告警记录失败, ", err)
+				continue
+			}
+			logs.Warning("node %s heartbeat stale: %s", worker.Name, problem.Message)
+		}
+		c.problems.record(worker.Name, problem.Type, start)
+	}
+	for nodeName := range c.heartbeatsChecked {
+		if !present[nodeName] {
+			delete(c.heartbeatsChecked, nodeName)
+		}
+	}
+}
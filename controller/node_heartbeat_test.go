@@ -0,0 +1,100 @@
+package controller
+
+import (
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"node-controller/common"
+	"node-controller/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newNodeLease is the lease of node nodeName renewed at renewTime, never renewed when nil
+func newNodeLease(nodeName string, renewTime *time.Time) *coordinationv1.Lease {
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: NodeLeaseNamespace, Name: nodeName},
+	}
+	if renewTime != nil {
+		lease.Spec.RenewTime = &metav1.MicroTime{Time: *renewTime}
+	}
+	return lease
+}
+
+func TestCheckHeartbeats(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    []string
+	}{
+		{"fresh lease", []runtime.Object{node, newNodeLease("node", ago(5*time.Second))}, []string{}},
+		{"within the timeout", []runtime.Object{node, newNodeLease("node", ago(25*time.Second))}, []string{}},
+		{"beyond the timeout", []runtime.Object{node, newNodeLease("node", ago(35*time.Second))}, []string{models.RecordTypeNodeHeartbeatStale}},
+		{"stale for long", []runtime.Object{node, newNodeLease("node", ago(time.Hour))}, []string{models.RecordTypeNodeHeartbeatStale}},
+		{"never renewed", []runtime.Object{node, newNodeLease("node", nil)}, []string{}},
+		{"missing lease", []runtime.Object{node}, []string{}},
+		{"deleted node", []runtime.Object{newNodeLease("node", ago(time.Hour))}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useTestDB(t)
+			stop := make(chan struct{})
+			defer close(stop)
+			c, _ := newTestWorkerController(t, stop, test.objects...)
+
+			c.checkHeartbeats()
+			if got := openRecords(t, "node"); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("open records = %v, want %v", got, test.want)
+			}
+			// the stale heartbeat is recorded once
+			c.checkHeartbeats()
+			if got := openRecords(t, "node"); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("open records checked again = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckHeartbeatsRenewed(t *testing.T) {
+	useTestDB(t)
+	stop := make(chan struct{})
+	defer close(stop)
+	stale := time.Now().Add(-time.Hour)
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	c, client := newTestWorkerController(t, stop, node, newNodeLease("node", &stale))
+
+	c.checkHeartbeats()
+	if got, want := openRecords(t, "node"), []string{models.RecordTypeNodeHeartbeatStale}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("open records = %v, want %v", got, want)
+	}
+
+	renewed := time.Now()
+	if _, err := client.CoordinationV1().Leases(NodeLeaseNamespace).Update(newNodeLease("node", &renewed)); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		lease, err := c.leaseList.Leases(NodeLeaseNamespace).Get("node")
+		return err == nil && lease.Spec.RenewTime.Time.Equal(renewed)
+	})
+
+	c.checkHeartbeats()
+	if got := openRecords(t, "node"); len(got) != 0 {
+		t.Errorf("open records after renewal = %v, want none", got)
+	}
+	recovers := common.TakeRecovers()
+	if len(recovers) != 1 || recovers[0].Type != models.RecordTypeNodeHeartbeatStale {
+		t.Errorf("recoveries = %+v, want one of %s", recovers, models.RecordTypeNodeHeartbeatStale)
+	}
+	if c.problems.has("node", models.RecordTypeNodeHeartbeatStale) {
+		t.Errorf("stale heartbeat still remembered after renewal")
+	}
+}
@@ -1,19 +1,25 @@
 package controller
 
 import (
+	"context"
 	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	CoreListerV1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
 	apiv1alpha1 "node-controller/api/virtulmachinecontroller/v1alpha1"
-	"node-controller/common"
+	"node-controller/events"
 	clientSet "node-controller/generated/clientset/versioned"
 	clientScheme "node-controller/generated/clientset/versioned/scheme"
 	nodeInformer "node-controller/generated/informers/externalversions/virtulmachinecontroller/v1alpha1"
 	"node-controller/generated/listers/virtulmachinecontroller/v1alpha1"
+	"node-controller/reconciler"
 	"node-controller/util/logs"
 	"time"
 )
@@ -26,147 +32,87 @@ func recoverException() {
 }
 
 type VirtulMachineListenerController struct {
+	kubeClientset kubernetes.Interface
 	nodeClientset clientSet.Interface
 	nodeList      v1alpha1.VirtulMachineLister
 	nodeSynced    cache.InformerSynced
-	workqueue     workqueue.RateLimitingInterface
-}
-
-type VirtulMachineQueueObj struct {
-	Key    string                     `json:"key"`
-	OldObj *apiv1alpha1.VirtulMachine `json:"old_obj"`
-	Ope    string                     `json:"ope"` // add / update / delete
+	workerList    CoreListerV1.NodeLister
+	workerSynced  cache.InformerSynced
+	reconciler    *reconciler.Controller
 }
 
 func BuildVirtulMachineListenerController(
+	kubeclientset kubernetes.Interface,
 	api6RouteClientset clientSet.Interface,
-	api6RouteInformer nodeInformer.VirtulMachineInformer) *VirtulMachineListenerController {
+	api6RouteInformer nodeInformer.VirtulMachineInformer,
+	workerInformer coreinformers.NodeInformer) *VirtulMachineListenerController {
 
 	runtime.Must(clientScheme.AddToScheme(scheme.Scheme))
 	controller := &VirtulMachineListenerController{
+		kubeClientset: kubeclientset,
 		nodeClientset: api6RouteClientset,
 		nodeList:      api6RouteInformer.Lister(),
 		nodeSynced:    api6RouteInformer.Informer().HasSynced,
-		workqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "VirtulMachineListener"),
-	}
-	api6RouteInformer.Informer().AddEventHandler(
+		workerList:    workerInformer.Lister(),
+		workerSynced:  workerInformer.Informer().HasSynced,
+	}
+	controller.reconciler = reconciler.New(reconciler.Config{
+		Name:         "VirtulMachineListener",
+		ConfigPrefix: "VirtulMachineListener",
+		Informer:     api6RouteInformer.Informer(),
+		Reconciler:   reconciler.ReconcilerFunc(controller.sync),
+		Hooks: reconciler.Hooks{
+			OnAdd: func(obj interface{}) {
+				events.Events.Publish(events.VirtulMachineAdded, obj)
+			},
+			OnUpdate: func(oldObj, newObj interface{}) {
+				events.Events.Publish(events.VirtulMachineUpdated, newObj)
+			},
+			OnDelete: func(obj interface{}) {
+				publishRemoved(events.VirtulMachineRemoved, obj)
+			},
+		},
+		WaitFor: []cache.InformerSynced{controller.workerSynced},
+	})
+	// node changes move the phase of the virtul machines bound to them
+	workerInformer.Informer().AddEventHandler(
 		cache.ResourceEventHandlerFuncs{
-			AddFunc:    controller.addFunc,
-			UpdateFunc: controller.updateFunc,
-			DeleteFunc: controller.deleteFunc,
+			AddFunc: controller.enqueueForNode,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				controller.enqueueForNode(newObj)
+			},
+			DeleteFunc: controller.enqueueForNode,
 		})
 	return controller
 }
 
-func (n *VirtulMachineListenerController) addFunc(obj interface{}) {
-	fmt.Println("add:", obj.(*apiv1alpha1.VirtulMachine).Name)
-	var key string
-	var err error
-	if key, err = cache.MetaNamespaceKeyFunc(obj); err != nil {
-		runtime.HandleError(err)
-		return
-	}
-	rqo := &VirtulMachineQueueObj{Key: key, OldObj: nil, Ope: common.ADD}
-	n.workqueue.AddRateLimited(rqo)
-}
-
-func (n *VirtulMachineListenerController) updateFunc(oldObj, newObj interface{}) {
-	oldVirtulMachine := oldObj.(*apiv1alpha1.VirtulMachine)
-	newVirtulMachine := newObj.(*apiv1alpha1.VirtulMachine)
-	if oldVirtulMachine.ResourceVersion == newVirtulMachine.ResourceVersion {
-		return
-	}
-	//n.addFunc(newObj)
-	var key string
-	var err error
-	if key, err = cache.MetaNamespaceKeyFunc(newObj); err != nil {
-		runtime.HandleError(err)
-		return
-	}
-	rqo := &VirtulMachineQueueObj{Key: key, OldObj: oldVirtulMachine, Ope: common.UPDATE}
-	n.workqueue.AddRateLimited(rqo)
-}
-
-func (n *VirtulMachineListenerController) deleteFunc(obj interface{}) {
-	var key string
-	var err error
-	key, err = cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-	if err != nil {
-		runtime.HandleError(err)
-		return
-	}
-	rqo := &VirtulMachineQueueObj{Key: key, OldObj: nil, Ope: common.DELETE}
-	n.workqueue.AddRateLimited(rqo)
-}
-
-func (n *VirtulMachineListenerController) Run(stop <-chan struct{}) error {
-	//defer c.workqueue.ShutDown()
-	// 同步缓存
-	if ok := cache.WaitForCacheSync(stop); !ok {
-		logs.Error("同步缓存失败")
-		return fmt.Errorf("failed to wait for caches to sync")
-	}
-	go wait.Until(n.runWorker, time.Second*10, stop)
-	return nil
-}
-
-func (n *VirtulMachineListenerController) runWorker() {
-	for n.processNextWorkItem() {
-	}
-}
-
-func (n *VirtulMachineListenerController) processNextWorkItem() bool {
-	defer recoverException()
-	obj, shutdown := n.workqueue.Get()
-	if shutdown {
-		return false
-	}
-	err := func(obj interface{}) error {
-		defer n.workqueue.Done(obj)
-		var key string
-		var ok bool
-		var rqo *VirtulMachineQueueObj
-		if rqo, ok = obj.(*VirtulMachineQueueObj); !ok {
-			n.workqueue.Forget(obj)
-			return fmt.Errorf("expected NodeQueueObj in workqueue but got %#v", obj)
+// enqueueForNode enqueues the virtul machines whose node is obj.
+func (n *VirtulMachineListenerController) enqueueForNode(obj interface{}) {
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
 		}
-		// 在syncHandler中处理业务
-		if err := n.syncHandler(rqo); err != nil {
-			return fmt.Errorf("error syncing '%s': %s", key, err.Error())
+		if node, ok = tombstone.Obj.(*v1.Node); !ok {
+			return
 		}
-
-		n.workqueue.Forget(obj)
-		return nil
-	}(obj)
+	}
+	vms, err := n.nodeList.List(labels.Everything())
 	if err != nil {
 		runtime.HandleError(err)
+		return
 	}
-	return true
-}
-
-func (n *VirtulMachineListenerController) syncHandler(rqo *VirtulMachineQueueObj) error {
-	key := rqo.Key
-	switch {
-	case rqo.Ope == common.ADD:
-		return n.add(key)
-	case rqo.Ope == common.UPDATE:
-		// 1.first add new route config
-		if err := n.add(key); err != nil {
-			// log error
-			return err
-		} else {
-			// 2.then delete routes not exist
-			return n.sync(rqo)
+	for _, vm := range vms {
+		if vm.Status.NodeName != node.Name && !matchNode(vm, node) {
+			continue
 		}
-	case rqo.Ope == common.DELETE:
-		return n.sync(rqo)
-	default:
-		// log error
-		return fmt.Errorf("VirtulMachineQueueObj is not expected")
+		n.reconciler.EnqueueObject(vm)
 	}
 }
 
-func (n *VirtulMachineListenerController) add(key string) error {
+// sync reconciles the virtul machine of key
+func (n *VirtulMachineListenerController) sync(ctx context.Context, key string) error {
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		logs.Error("invalid resource key: %s", key)
@@ -182,47 +128,70 @@ func (n *VirtulMachineListenerController) add(key string) error {
 		runtime.HandleError(fmt.Errorf("failed to list vm  %s/%s", key, err.Error()))
 		return err
 	}
-	if node.Status.Phase == "" {
-		node.Status.Phase = "Running"
-		_, err = n.nodeClientset.NodecontrollerV1alpha1().VirtulMachines(namespace).UpdateStatus(node)
-		if err != nil {
-			logs.Error("Update status error ,", err.Error())
-		}
-		fmt.Println(node.Status.Phase)
-	}
-
-	return err
+	return n.reconcile(node)
 }
 
-// sync
-// 1.diff routes between old and new objects
-// 2.delete routes not exist
-func (n *VirtulMachineListenerController) sync(rqo *VirtulMachineQueueObj) error {
-	key := rqo.Key
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+// reconcile binds vm to its node, mirrors the node status and walks vm through
+// its lifecycle until the observed state is reached, then writes the status once.
+func (n *VirtulMachineListenerController) reconcile(vm *apiv1alpha1.VirtulMachine) error {
+	if updated, err := n.ensureFinalizer(vm); updated || err != nil {
+		return err
+	}
+
+	worker, err := bindNode(vm, n.workerList)
 	if err != nil {
-		logs.Error("invalid resource key: %s", key)
-		return fmt.Errorf("invalid resource key: %s", key)
+		return err
 	}
 
-	switch {
-	case rqo.Ope == common.UPDATE:
-		node, err := n.nodeList.VirtulMachines(namespace).Get(name)
+	before := vm
+	vm = vm.DeepCopy()
+	if worker != nil && vm.Status.NodeName != worker.Name {
+		logs.Info("vm %s/%s bound to node %s", vm.Namespace, vm.Name, worker.Name)
+	}
+	mirrorNodeStatus(vm, worker)
+	if vm.DeletionTimestamp != nil {
+		return n.finalize(vm, worker)
+	}
+	if worker != nil {
+		patched, err := applyNodeSpec(n.kubeClientset, vm, worker)
 		if err != nil {
-			if errors.IsNotFound(err) {
-				logs.Info("vm %s is removed", key)
-				return nil
-			}
-			runtime.HandleError(fmt.Errorf("failed to list vm %s/%s", key, err.Error()))
-			return err
+			return fmt.Errorf("failed to apply spec of vm %s/%s to node %s: %s", vm.Namespace, vm.Name, worker.Name, err.Error())
 		}
-		fmt.Println(node.Name, node.Status.Phase)
-		fmt.Println("update")
-		return nil
-	case rqo.Ope == common.DELETE:
-		fmt.Println("delete")
+		if patched {
+			logs.Info("node %s patched with taints/labels of vm %s/%s", worker.Name, vm.Namespace, vm.Name)
+		}
+	}
+	now := time.Now()
+	var requeueAfter time.Duration
+	for i := 0; i < len(vmPhaseTransitions); i++ {
+		result := nextPhase(vm, worker, now)
+		requeueAfter = result.RequeueAfter
+		if result.Phase == vm.Status.Phase {
+			break
+		}
+		if err := setPhase(vm, result.Phase, result.Reason, result.Message); err != nil {
+			logs.Error(err)
+			break
+		}
+		logs.Info("vm %s/%s phase %s: %s", vm.Namespace, vm.Name, result.Phase, result.Message)
+	}
+	if requeueAfter > 0 {
+		key, _ := cache.MetaNamespaceKeyFunc(vm)
+		n.reconciler.EnqueueAfter(key, requeueAfter)
+	}
+	if equality.Semantic.DeepEqual(before.Status, vm.Status) {
 		return nil
-	default:
-		return fmt.Errorf("not expected in (VirtualMachineController) sync")
 	}
+	return n.updateStatus(vm)
+}
+
+// updateStatus writes the status of vm and keeps its resourceVersion current for further writes.
+func (n *VirtulMachineListenerController) updateStatus(vm *apiv1alpha1.VirtulMachine) error {
+	updated, err := n.nodeClientset.NodecontrollerV1alpha1().VirtulMachines(vm.Namespace).UpdateStatus(vm)
+	if err != nil {
+		logs.Error("Update status error ,", err.Error())
+		return err
+	}
+	vm.ResourceVersion = updated.ResourceVersion
+	return nil
 }
@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	labelNodeRolePrefix = "node-role.kubernetes.io/"
+	labelNodeRole       = "kubernetes.io/role"
+	labelZone           = "topology.kubernetes.io/zone"
+	labelZoneBeta       = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// NodeQuery filters, sorts and pages the node list. Filters with several values match
+// any of them, empty ones match every node.
+type NodeQuery struct {
+	LabelSelector labels.Selector
+	// Name is a substring of the node name
+	Name             string
+	Ready            []v1.ConditionStatus
+	Schedulable      *bool
+	Roles            []string
+	Zones            []string
+	KubeletVersions  []string
+	OperatingSystems []string
+	Architectures    []string
+	SortBy           string
+	Desc             bool
+	// Page starts at 1, every node is returned when PageSize is 0
+	Page     int
+	PageSize int
+}
+
+// nodeSortKeys compare two nodes by a column of the list
+var nodeSortKeys = map[string]func(a, b *Node) int{
+	"name": func(a, b *Node) int { return strings.Compare(a.Name, b.Name) },
+	"creationTimestamp": func(a, b *Node) int {
+		return compareInt64(a.CreationTimestamp.Unix(), b.CreationTimestamp.Unix())
+	},
+	"ready":       func(a, b *Node) int { return strings.Compare(string(a.Spec.Ready), string(b.Spec.Ready)) },
+	"schedulable": func(a, b *Node) int { return compareBool(!a.Spec.Unschedulable, !b.Spec.Unschedulable) },
+	"problems": func(a, b *Node) int {
+		return compareInt64(int64(len(a.Status.Problems)), int64(len(b.Status.Problems)))
+	},
+	"kubeletVersion": func(a, b *Node) int {
+		return strings.Compare(a.Status.NodeInfo.KubeletVersion, b.Status.NodeInfo.KubeletVersion)
+	},
+}
+
+func init() {
+	usages := map[string]func(n *Node) ResourceUsage{
+		"cpu":    func(n *Node) ResourceUsage { return n.Status.Usage.Cpu },
+		"memory": func(n *Node) ResourceUsage { return n.Status.Usage.Memory },
+		"pods":   func(n *Node) ResourceUsage { return n.Status.Usage.Pods },
+	}
+	for name, usage := range usages {
+		usage := usage
+		nodeSortKeys[name+"Allocatable"] = func(a, b *Node) int { return compareInt64(usage(a).Allocatable, usage(b).Allocatable) }
+		nodeSortKeys[name+"Requested"] = func(a, b *Node) int { return compareInt64(usage(a).Requested, usage(b).Requested) }
+		nodeSortKeys[name+"Percent"] = func(a, b *Node) int { return compareInt64(usage(a).Percent, usage(b).Percent) }
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareBool(a, b bool) int {
+	if a == b {
+		return 0
+	}
+	if b {
+		return -1
+	}
+	return 1
+}
+
+// ParseNodeQuery reads the query of the node list from its url parameters
+func ParseNodeQuery(values url.Values) (*NodeQuery, error) {
+	errs := make([]string, 0)
+	q := &NodeQuery{
+		LabelSelector:    labels.Everything(),
+		Name:             values.Get("name"),
+		Roles:            splitValues(values, "role"),
+		Zones:            splitValues(values, "zone"),
+		KubeletVersions:  splitValues(values, "kubeletVersion"),
+		OperatingSystems: splitValues(values, "os"),
+		Architectures:    splitValues(values, "arch"),
+		SortBy:           values.Get("sortBy"),
+	}
+	if selector := values.Get("labelSelector"); selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("labelSelector: %s", err.Error()))
+		} else {
+			q.LabelSelector = parsed
+		}
+	}
+	for _, ready := range splitValues(values, "ready") {
+		switch strings.ToLower(ready) {
+		case "true":
+			q.Ready = append(q.Ready, v1.ConditionTrue)
+		case "false":
+			q.Ready = append(q.Ready, v1.ConditionFalse)
+		case "unknown":
+			q.Ready = append(q.Ready, v1.ConditionUnknown)
+		default:
+			errs = append(errs, fmt.Sprintf("ready %q: must be true, false or unknown", ready))
+		}
+	}
+	if schedulable := values.Get("schedulable"); schedulable != "" {
+		parsed, err := strconv.ParseBool(schedulable)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("schedulable %q: must be true or false", schedulable))
+		} else {
+			q.Schedulable = &parsed
+		}
+	}
+	if q.SortBy == "" {
+		q.SortBy = "name"
+	} else if _, ok := nodeSortKeys[q.SortBy]; !ok {
+		columns := make([]string, 0, len(nodeSortKeys))
+		for column := range nodeSortKeys {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		errs = append(errs, fmt.Sprintf("sortBy %q: must be one of %s", q.SortBy, strings.Join(columns, ", ")))
+	}
+	switch order := strings.ToLower(values.Get("order")); order {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		errs = append(errs, fmt.Sprintf("order %q: must be asc or desc", order))
+	}
+	for param, value := range map[string]*int{"page": &q.Page, "pageSize": &q.PageSize} {
+		if values.Get(param) == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(values.Get(param))
+		if err != nil || parsed < 0 {
+			errs = append(errs, fmt.Sprintf("%s %q: must be a non-negative number", param, values.Get(param)))
+			continue
+		}
+		*value = parsed
+	}
+	if q.PageSize > 0 && q.Page == 0 {
+		q.Page = 1
+	}
+	return q, invalid(errs)
+}
+
+// splitValues returns the comma separated values of the parameter name, which may be repeated
+func splitValues(values url.Values, name string) []string {
+	result := make([]string, 0)
+	for _, value := range values[name] {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+// nodeRoles returns the roles of a node from its role labels
+func nodeRoles(nodeLabels map[string]string) []string {
+	roles := make([]string, 0)
+	for key, value := range nodeLabels {
+		if strings.HasPrefix(key, labelNodeRolePrefix) && len(key) > len(labelNodeRolePrefix) {
+			roles = append(roles, strings.TrimPrefix(key, labelNodeRolePrefix))
+		}
+		if key == labelNodeRole && value != "" {
+			roles = append(roles, value)
+		}
+	}
+	return roles
+}
+
+func nodeZone(nodeLabels map[string]string) string {
+	if zone, ok := nodeLabels[labelZone]; ok {
+		return zone
+	}
+	return nodeLabels[labelZoneBeta]
+}
+
+func matchAny(filter []string, values ...string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		for _, value := range values {
+			if f == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Matches tells whether node passes the filters of q
+func (q *NodeQuery) Matches(node *Node) bool {
+	if !q.LabelSelector.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(node.Name, q.Name) {
+		return false
+	}
+	if len(q.Ready) > 0 {
+		ready := false
+		for _, status := range q.Ready {
+			ready = ready || node.Spec.Ready == status || (status == v1.ConditionUnknown && node.Spec.Ready == "")
+		}
+		if !ready {
+			return false
+		}
+	}
+	if q.Schedulable != nil && *q.Schedulable == node.Spec.Unschedulable {
+		return false
+	}
+	return matchAny(q.Roles, nodeRoles(node.Labels)...) &&
+		matchAny(q.Zones, nodeZone(node.Labels)) &&
+		matchAny(q.KubeletVersions, node.Status.NodeInfo.KubeletVersion) &&
+		matchAny(q.OperatingSystems, node.Status.NodeInfo.OperatingSystem) &&
+		matchAny(q.Architectures, node.Status.NodeInfo.Architecture)
+}
+
+// Apply returns the page of the nodes matching q, sorted by its column, and their count
+func (q *NodeQuery) Apply(nodes []Node) ([]Node, int) {
+	result := make([]Node, 0)
+	for i := range nodes {
+		if q.Matches(&nodes[i]) {
+			result = append(result, nodes[i])
+		}
+	}
+
+	compare := nodeSortKeys[q.SortBy]
+	sort.SliceStable(result, func(i, j int) bool {
+		c := compare(&result[i], &result[j])
+		if c == 0 {
+			return result[i].Name < result[j].Name
+		}
+		if q.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	total := len(result)
+	if q.PageSize > 0 {
+		start := (q.Page - 1) * q.PageSize
+		if start > total {
+			start = total
+		}
+		end := start + q.PageSize
+		if end > total {
+			end = total
+		}
+		result = result[start:end]
+	}
+	return result, total
+}
+
+// ListWorkers returns the nodes of the node list matching q. The summaries are those of
+// the whole cluster.
+func ListWorkers(q *NodeQuery) (*NodeListResult, error) {
+	if workers == nil {
+		return &NodeListResult{Nodes: []Node{}, GeneratedAt: time.Now()}, nil
+	}
+	nodeList, err := workers.ListNode()
+	if err != nil {
+		return nil, err
+	}
+
+	result := *nodeList
+	result.Nodes, result.Total = q.Apply(nodeList.Nodes)
+	result.Page = q.Page
+	result.PageSize = q.PageSize
+	return &result, nil
+}
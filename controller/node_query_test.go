@@ -0,0 +1,177 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNodeQuery(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		query   string
+		want    NodeQuery
+		wantErr []string
+	}{
+		{
+			query: "",
+			want:  NodeQuery{SortBy: "name"},
+		},
+		{
+			query: "name=gpu&role=gpu&role=infra,+worker&zone=a&kubeletVersion=v1.16.3&os=linux&arch=amd64",
+			want: NodeQuery{
+				Name:             "gpu",
+				Roles:            []string{"gpu", "infra", "worker"},
+				Zones:            []string{"a"},
+				KubeletVersions:  []string{"v1.16.3"},
+				OperatingSystems: []string{"linux"},
+				Architectures:    []string{"amd64"},
+				SortBy:           "name",
+			},
+		},
+		{
+			query: "ready=True,unknown&schedulable=false",
+			want:  NodeQuery{Ready: []v1.ConditionStatus{v1.ConditionTrue, v1.ConditionUnknown}, Schedulable: &no, SortBy: "name"},
+		},
+		{
+			query: "schedulable=true&sortBy=cpuPercent&order=DESC",
+			want:  NodeQuery{Schedulable: &yes, SortBy: "cpuPercent", Desc: true},
+		},
+		{
+			query: "pageSize=20",
+			want:  NodeQuery{SortBy: "name", Page: 1, PageSize: 20},
+		},
+		{
+			query: "page=3&pageSize=20&order=asc",
+			want:  NodeQuery{SortBy: "name", Page: 3, PageSize: 20},
+		},
+		{
+			query:   "labelSelector=zone+in+(a",
+			wantErr: []string{"labelSelector"},
+		},
+		{
+			query:   "ready=maybe&schedulable=yes",
+			wantErr: []string{`ready "maybe"`, `schedulable "yes"`},
+		},
+		{
+			query:   "sortBy=color&order=up",
+			wantErr: []string{`sortBy "color": must be one of`, `order "up"`},
+		},
+		{
+			query:   "page=-1&pageSize=ten",
+			wantErr: []string{`page "-1"`, `pageSize "ten"`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := ParseNodeQuery(values)
+			if len(test.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("ParseNodeQuery() succeeded, want an error")
+				}
+				for _, wantErr := range test.wantErr {
+					if !strings.Contains(err.Error(), wantErr) {
+						t.Errorf("ParseNodeQuery() = %q, want it to mention %q", err.Error(), wantErr)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNodeQuery() = %v", err)
+			}
+			if !q.LabelSelector.Empty() {
+				t.Errorf("labelSelector = %s, want everything", q.LabelSelector)
+			}
+			got := *q
+			got.LabelSelector = nil
+			if !reflect.DeepEqual(emptySlices(got), emptySlices(test.want)) {
+				t.Errorf("ParseNodeQuery() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// emptySlices makes the nil filters of q empty, like the parsed ones
+func emptySlices(q NodeQuery) NodeQuery {
+	for _, filter := range []*[]string{&q.Roles, &q.Zones, &q.KubeletVersions, &q.OperatingSystems, &q.Architectures} {
+		if *filter == nil {
+			*filter = []string{}
+		}
+	}
+	return q
+}
+
+func TestNodeQueryApply(t *testing.T) {
+	created := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	node := func(name string, ready v1.ConditionStatus, unschedulable bool, labels map[string]string, kubelet string, cpuPercent int64, age int) Node {
+		n := Node{
+			Name:              name,
+			Labels:            labels,
+			CreationTimestamp: metav1.NewTime(created.Add(time.Duration(age) * time.Hour)),
+			Spec:              NodeSpec{Ready: ready, Unschedulable: unschedulable},
+		}
+		n.Status.NodeInfo.KubeletVersion = kubelet
+		n.Status.Usage.Cpu.Percent = cpuPercent
+		return n
+	}
+	nodes := []Node{
+		node("worker-2", v1.ConditionFalse, true, map[string]string{labelZone: "b"}, "v1.17.0", 10, 1),
+		node("worker-1", v1.ConditionTrue, false, map[string]string{labelNodeRolePrefix + "worker": "", labelZone: "a", "team": "infra"}, "v1.16.3", 50, 0),
+		node("gpu-1", "", false, map[string]string{labelNodeRolePrefix + "gpu": "", labelZoneBeta: "a"}, "v1.16.3", 90, 2),
+		node("worker-3", v1.ConditionTrue, false, map[string]string{labelNodeRole: "worker", labelZone: "b"}, "v1.16.3", 50, 3),
+	}
+
+	tests := []struct {
+		query     string
+		wantNames []string
+		wantTotal int
+	}{
+		{"", []string{"gpu-1", "worker-1", "worker-2", "worker-3"}, 4},
+		{"name=worker", []string{"worker-1", "worker-2", "worker-3"}, 3},
+		{"labelSelector=team%3Dinfra", []string{"worker-1"}, 1},
+		{"ready=unknown", []string{"gpu-1"}, 1},
+		{"ready=true,unknown", []string{"gpu-1", "worker-1", "worker-3"}, 3},
+		{"schedulable=false", []string{"worker-2"}, 1},
+		{"schedulable=true", []string{"gpu-1", "worker-1", "worker-3"}, 3},
+		{"role=gpu", []string{"gpu-1"}, 1},
+		{"role=worker", []string{"worker-1", "worker-3"}, 2},
+		{"zone=a", []string{"gpu-1", "worker-1"}, 2},
+		{"kubeletVersion=v1.17.0", []string{"worker-2"}, 1},
+		{"zone=b&ready=true", []string{"worker-3"}, 1},
+		{"sortBy=cpuPercent", []string{"worker-2", "worker-1", "worker-3", "gpu-1"}, 4},
+		{"sortBy=cpuPercent&order=desc", []string{"gpu-1", "worker-1", "worker-3", "worker-2"}, 4},
+		{"sortBy=creationTimestamp&order=desc", []string{"worker-3", "gpu-1", "worker-2", "worker-1"}, 4},
+		{"pageSize=2", []string{"gpu-1", "worker-1"}, 4},
+		{"page=2&pageSize=3", []string{"worker-3"}, 4},
+		{"page=5&pageSize=2", []string{}, 4},
+		{"zone=b&page=2&pageSize=1", []string{"worker-3"}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := ParseNodeQuery(values)
+			if err != nil {
+				t.Fatalf("ParseNodeQuery() = %v", err)
+			}
+			result, total := q.Apply(nodes)
+			names := make([]string, 0, len(result))
+			for _, n := range result {
+				names = append(names, n.Name)
+			}
+			if !reflect.DeepEqual(names, test.wantNames) || total != test.wantTotal {
+				t.Errorf("Apply() = %v (%d), want %v (%d)", names, total, test.wantNames, test.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"node-controller/common"
+	"sync"
+	"time"
+)
+
+// podUsage is what an active pod takes on its node
+type podUsage struct {
+	nodeName string
+	// requests of the pod counted as one pod, see podRequestsAndLimits
+	requests v1.ResourceList
+	// requests of its containers, none once it is deleting, as in the cluster summary
+	used common.ResourceList
+}
+
+// nodePods is what the active pods of a node add up to
+type nodePods struct {
+	requested v1.ResourceList
+	used      common.ResourceList
+}
+
+// podUsageOf returns the usage of pod, false when it is not scheduled or terminated
+func podUsageOf(pod *v1.Pod) (podUsage, bool) {
+	if pod.Spec.NodeName == "" || pod.Status.Phase == v1.PodFailed || pod.Status.Phase == v1.PodSucceeded {
+		return podUsage{}, false
+	}
+	requests, _ := podRequestsAndLimits(pod)
+	requests[v1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+	usage := podUsage{nodeName: pod.Spec.NodeName, requests: requests}
+	if pod.DeletionTimestamp == nil {
+		usage.used = *common.ContainersRequestResourceList(pod.Spec.Containers)
+	}
+	return usage, true
+}
+
+func (p *nodePods) add(usage podUsage) {
+	addResourceList(p.requested, usage.requests)
+	p.used.Cpu += usage.used.Cpu
+	p.used.Memory += usage.used.Memory
+}
+
+func (p *nodePods) sub(usage podUsage) {
+	for name, quantity := range usage.requests {
+		value := p.requested[name]
+		value.Sub(quantity)
+		p.requested[name] = value
+	}
+	p.used.Cpu -= usage.used.Cpu
+	p.used.Memory -= usage.used.Memory
+}
+
+// nodeStore keeps the nodes and what their pods take up to date from the informer events.
+// The node list is built from it on demand and kept until the next event, or for the
+// heartbeat check interval since stale heartbeats come without events.
+type nodeStore struct {
+	lock     sync.Mutex
+	nodes    map[string]*v1.Node
+	pods     map[string]podUsage
+	nodePods map[string]*nodePods
+	list     *NodeListResult
+}
+
+func newNodeStore() *nodeStore {
+	return &nodeStore{
+		nodes:    map[string]*v1.Node{},
+		pods:     map[string]podUsage{},
+		nodePods: map[string]*nodePods{},
+	}
+}
+
+func (s *nodeStore) setNode(node *v1.Node) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nodes[node.Name] = node
+	s.list = nil
+}
+
+func (s *nodeStore) deleteNode(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.nodes, name)
+	s.list = nil
+}
+
+func (s *nodeStore) addPod(obj interface{}) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	usage, active := podUsageOf(pod)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.removePod(key)
+	if active {
+		s.pods[key] = usage
+		p, ok := s.nodePods[usage.nodeName]
+		if !ok {
+			p = &nodePods{requested: v1.ResourceList{}}
+			s.nodePods[usage.nodeName] = p
+		}
+		p.add(usage)
+	}
+	s.list = nil
+}
+
+func (s *nodeStore) updatePod(oldObj, newObj interface{}) {
+	s.addPod(newObj)
+}
+
+func (s *nodeStore) deletePod(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.removePod(key)
+	s.list = nil
+}
+
+// removePod takes the pod key off its node, the lock must be held
+func (s *nodeStore) removePod(key string) {
+	usage, ok := s.pods[key]
+	if !ok {
+		return
+	}
+	delete(s.pods, key)
+	if p, ok := s.nodePods[usage.nodeName]; ok {
+		p.sub(usage)
+		if p.requested.Pods().IsZero() {
+			delete(s.nodePods, usage.nodeName)
+		}
+	}
+}
+
+// snapshot returns the node list, built by build when an event came since the last one
+func (s *nodeStore) snapshot(build func(nodes []*v1.Node, pods map[string]*nodePods, now time.Time) *NodeListResult) *NodeListResult {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if s.list != nil && now.Sub(s.list.GeneratedAt) < nodeHeartbeatCheckInterval() {
+		return s.list
+	}
+
+	nodes := make([]*v1.Node, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		nodes = append(nodes, node)
+	}
+	s.list = build(nodes, s.nodePods, now)
+	return s.list
+}
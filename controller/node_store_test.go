@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// podTotals are the pods, requested cpu and used cpu of a node, in millis for the cpu
+type podTotals [3]int64
+
+// usages returns what the pods of each node take in the snapshot of s
+func usages(s *nodeStore) map[string]podTotals {
+	got := map[string]podTotals{}
+	s.lock.Lock()
+	s.list = nil
+	s.lock.Unlock()
+	s.snapshot(func(nodes []*v1.Node, pods map[string]*nodePods, now time.Time) *NodeListResult {
+		for name, p := range pods {
+			got[name] = podTotals{p.requested.Pods().Value(), p.requested.Cpu().MilliValue(), p.used.Cpu}
+		}
+		return &NodeListResult{GeneratedAt: now}
+	})
+	return got
+}
+
+func TestNodeStorePods(t *testing.T) {
+	running := newDetailPod("default", "a", "node", v1.PodRunning, resources("1", "1Gi"), nil)
+	pending := newDetailPod("default", "b", "", v1.PodPending, resources("500m", "512Mi"), nil)
+	scheduled := pending.DeepCopy()
+	scheduled.Spec.NodeName = "node"
+	deleting := running.DeepCopy()
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	succeeded := scheduled.DeepCopy()
+	succeeded.Status.Phase = v1.PodSucceeded
+	elsewhere := newDetailPod("default", "c", "other", v1.PodRunning, resources("2", "1Gi"), nil)
+
+	s := newNodeStore()
+	steps := []struct {
+		name  string
+		event func()
+		want  map[string]podTotals
+	}{
+		{"pod added", func() { s.addPod(running) }, map[string]podTotals{"node": {1, 1000, 1000}}},
+		{"pod added again", func() { s.addPod(running) }, map[string]podTotals{"node": {1, 1000, 1000}}},
+		{"pod not scheduled", func() { s.addPod(pending) }, map[string]podTotals{"node": {1, 1000, 1000}}},
+		{"pod scheduled", func() { s.updatePod(pending, scheduled) }, map[string]podTotals{"node": {2, 1500, 1500}}},
+		{
+			"pod on another node",
+			func() { s.addPod(elsewhere) },
+			map[string]podTotals{"node": {2, 1500, 1500}, "other": {1, 2000, 2000}},
+		},
+		{
+			"pod deleting",
+			func() { s.updatePod(running, deleting) },
+			map[string]podTotals{"node": {2, 1500, 500}, "other": {1, 2000, 2000}},
+		},
+		{
+			"pod succeeded",
+			func() { s.updatePod(scheduled, succeeded) },
+			map[string]podTotals{"node": {1, 1000, 0}, "other": {1, 2000, 2000}},
+		},
+		{
+			"pod deleted unseen",
+			func() { s.deletePod(cache.DeletedFinalStateUnknown{Key: "default/a", Obj: deleting}) },
+			map[string]podTotals{"other": {1, 2000, 2000}},
+		},
+		{"terminated pod deleted", func() { s.deletePod(succeeded) }, map[string]podTotals{"other": {1, 2000, 2000}}},
+		{"pod deleted", func() { s.deletePod(elsewhere) }, map[string]podTotals{}},
+		{"not a pod", func() { s.addPod(&v1.Node{}) }, map[string]podTotals{}},
+	}
+	for _, step := range steps {
+		step.event()
+		if got := usages(s); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: nodes = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestNodeStoreSnapshot(t *testing.T) {
+	s := newNodeStore()
+	labeled := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a", Labels: map[string]string{"zone": "b"}}}
+	builds := 0
+	var built []string
+	build := func(nodes []*v1.Node, pods map[string]*nodePods, now time.Time) *NodeListResult {
+		builds++
+		built = make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			built = append(built, node.Name)
+		}
+		sort.Strings(built)
+		return &NodeListResult{GeneratedAt: now, Total: len(nodes)}
+	}
+
+	steps := []struct {
+		name       string
+		event      func()
+		wantBuilds int
+		wantNodes  []string
+	}{
+		{"first snapshot", func() {}, 1, []string{}},
+		{"node added", func() { s.setNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}}) }, 2, []string{"a"}},
+		{"no event", func() {}, 2, []string{"a"}},
+		{"node updated", func() { s.setNode(labeled) }, 3, []string{"a"}},
+		{"another node", func() { s.setNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "b"}}) }, 4, []string{"a", "b"}},
+		{"pod added", func() { s.addPod(newDetailPod("default", "p", "a", v1.PodRunning, nil, nil)) }, 5, []string{"a", "b"}},
+		{"pod deleted", func() { s.deletePod(newDetailPod("default", "p", "a", v1.PodRunning, nil, nil)) }, 6, []string{"a", "b"}},
+		{"node deleted", func() { s.deleteNode("a") }, 7, []string{"b"}},
+		{"still no event", func() {}, 7, []string{"b"}},
+	}
+	for _, step := range steps {
+		step.event()
+		list := s.snapshot(build)
+		if builds != step.wantBuilds || !reflect.DeepEqual(built, step.wantNodes) || list.Total != len(step.wantNodes) {
+			t.Errorf("%s: built %d times with %v (total %d), want %d times with %v", step.name, builds, built, list.Total, step.wantBuilds, step.wantNodes)
+		}
+	}
+
+	// the list is built again once it is older than the heartbeat check interval
+	s.lock.Lock()
+	s.list.GeneratedAt = time.Now().Add(-nodeHeartbeatCheckInterval())
+	s.lock.Unlock()
+	s.snapshot(build)
+	if builds != 8 {
+		t.Errorf("stale list built %d times, want 8", builds)
+	}
+}
+
+func TestNodeStoreConcurrent(t *testing.T) {
+	s := newNodeStore()
+	nodes := []string{"a", "b", "c"}
+	for _, name := range nodes {
+		s.setNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range nodes {
+		wg.Add(1)
+		go func(nodeName string) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				pod := newDetailPod("default", fmt.Sprintf("%s-%d", nodeName, i), nodeName, v1.PodRunning, resources("100m", "128Mi"), nil)
+				s.addPod(pod)
+				if i%2 == 0 {
+					s.deletePod(pod)
+				}
+			}
+		}(name)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// every snapshot sees whole pods, the requested cpu follows the pods
+			for name, totals := range usages(s) {
+				if totals[1] != totals[0]*100 || totals[2] != totals[1] {
+					t.Errorf("node %s = %v, pods and requests out of step", name, totals)
+				}
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	<-done
+
+	want := map[string]podTotals{"a": {50, 5000, 5000}, "b": {50, 5000, 5000}, "c": {50, 5000, 5000}}
+	if got := usages(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("nodes = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,440 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/astaxie/beego"
+	v1 "k8s.io/api/core/v1"
+	"node-controller/common"
+	"node-controller/models"
+	"node-controller/util/logs"
+	"strings"
+	"sync"
+	"time"
+)
+
+// podProblem is an unhealthy state found on a pod, Container is empty for the pod itself
+type podProblem struct {
+	Type        string
+	Severity    string
+	Container   string
+	Reason      string
+	Message     string
+	Description string
+	Start       time.Time
+}
+
+// podAlerts remembers the open pod alert records, loaded from the database each time
+// this replica becomes the leader, so that healthy pods never hit it. The lock only guards the maps, the database is used
+// without it; a pod is never checked by two workers at once.
+type podAlerts struct {
+	sync.Mutex
+	loaded bool
+	// open are the keys of the open records
+	open map[string]bool
+	// oomKills is the last OOM kill recorded per container
+	oomKills map[string]time.Time
+	// restarts is the restart count of each container at the beginning of its spike window
+	restarts map[string]restartWindow
+}
+
+type restartWindow struct {
+	since time.Time
+	count int32
+}
+
+func podAlertKey(t string, namespace string, podName string, container string) string {
+	return t + "/" + namespace + "/" + podName + "/" + container
+}
+
+func podPendingTimeout() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("PodPendingTimeout", 600)) * time.Second
+}
+
+func podRestartSpikeWindow() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("PodRestartSpikeWindow", 600)) * time.Second
+}
+
+// podStableAfter is how long a container has to be ready before its alerts are resolved
+func podStableAfter() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("PodStableAfter", 300)) * time.Second
+}
+
+func (a *podAlerts) load() error {
+	a.Lock()
+	loaded := a.loaded
+	a.Unlock()
+	if loaded {
+		return nil
+	}
+	records, err := models.RecordMode.ListOpenPods("", "")
+	if err != nil {
+		return err
+	}
+	a.Lock()
+	defer a.Unlock()
+	if !a.loaded {
+		for _, record := range records {
+			a.open[podAlertKey(record.Type, record.Namespace, record.PodName, record.Container)] = true
+		}
+		a.loaded = true
+	}
+	return nil
+}
+
+// reset forgets the open records, another leader may have written them meanwhile. They
+// are loaded again by the next check.
+func (a *podAlerts) reset() {
+	a.Lock()
+	defer a.Unlock()
+	a.loaded = false
+	a.open = make(map[string]bool)
+}
+
+func (a *podAlerts) isOpen(alertKey string) bool {
+	a.Lock()
+	defer a.Unlock()
+	return a.open[alertKey]
+}
+
+func (a *podAlerts) setOpen(alertKey string, open bool) {
+	a.Lock()
+	defer a.Unlock()
+	if open {
+		a.open[alertKey] = true
+	} else {
+		delete(a.open, alertKey)
+	}
+}
+
+// oomKillSeen reports whether the OOM kill of alertKey at start is recorded already
+func (a *podAlerts) oomKillSeen(alertKey string, start time.Time) bool {
+	a.Lock()
+	defer a.Unlock()
+	last, ok := a.oomKills[alertKey]
+	return ok && last.Equal(start)
+}
+
+// seeOOMKill remembers the OOM kill of alertKey at start is recorded
+func (a *podAlerts) seeOOMKill(alertKey string, start time.Time) {
+	a.Lock()
+	defer a.Unlock()
+	a.oomKills[alertKey] = start
+}
+
+// forget drops what is known of the pod, it reports whether the pod has open alerts
+func (a *podAlerts) forget(namespace string, name string) bool {
+	a.Lock()
+	defer a.Unlock()
+	// keys are type/namespace/name/container
+	suffix := "/" + namespace + "/" + name + "/"
+	ofPod := func(key string) bool {
+		i := strings.Index(key, "/")
+		return i >= 0 && strings.HasPrefix(key[i:], suffix)
+	}
+	for key := range a.restarts {
+		if ofPod(key) {
+			delete(a.restarts, key)
+		}
+	}
+	for key := range a.oomKills {
+		if ofPod(key) {
+			delete(a.oomKills, key)
+		}
+	}
+	open := false
+	for key := range a.open {
+		if ofPod(key) {
+			open = true
+			delete(a.open, key)
+		}
+	}
+	return open
+}
+
+// spike reports whether the restarts of a container reached the threshold within the window
+func (a *podAlerts) spike(key string, count int32, now time.Time) (int32, bool) {
+	a.Lock()
+	defer a.Unlock()
+	threshold := int32(beego.AppConfig.DefaultInt("PodRestartSpikeThreshold", 5))
+	window, ok := a.restarts[key]
+	if !ok || now.Sub(window.since) > podRestartSpikeWindow() || count < window.count {
+		a.restarts[key] = restartWindow{since: now, count: count}
+		return 0, false
+	}
+	if threshold <= 0 || count-window.count < threshold {
+		return 0, false
+	}
+	a.restarts[key] = restartWindow{since: now, count: count}
+	return count - window.count, true
+}
+
+// detectPodProblems returns the problems of pod at now
+func (a *podAlerts) detectPodProblems(pod *v1.Pod, now time.Time) []podProblem {
+	problems := make([]podProblem, 0)
+	if pod.Status.Phase == v1.PodPending && now.Sub(pod.CreationTimestamp.Time) > podPendingTimeout() {
+		reason, message := "Pending", ""
+		if scheduled := getPodCondition(pod, v1.PodScheduled); scheduled != nil && scheduled.Status != v1.ConditionTrue {
+			reason, message = scheduled.Reason, scheduled.Message
+		}
+		problems = append(problems, podProblem{
+			Type:        models.RecordTypePodPending,
+			Severity:    models.SeverityWarning,
+			Reason:      reason,
+			Message:     message,
+			Description: fmt.Sprintf("pod Pending超过%s: %s %s", podPendingTimeout(), reason, message),
+			Start:       pod.CreationTimestamp.Time,
+		})
+	}
+
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if waiting := status.State.Waiting; waiting != nil {
+			switch waiting.Reason {
+			case "CrashLoopBackOff":
+				problems = append(problems, podProblem{
+					Type:        models.RecordTypePodCrashLoopBackOff,
+					Severity:    models.SeverityCritical,
+					Container:   status.Name,
+					Reason:      waiting.Reason,
+					Message:     waiting.Message,
+					Description: fmt.Sprintf("容器%s CrashLoopBackOff, 已重启%d次: %s", status.Name, status.RestartCount, waiting.Message),
+					Start:       now,
+				})
+			case "ImagePullBackOff", "ErrImagePull":
+				problems = append(problems, podProblem{
+					Type:        models.RecordTypePodImagePullBackOff,
+					Severity:    models.SeverityWarning,
+					Container:   status.Name,
+					Reason:      waiting.Reason,
+					Message:     waiting.Message,
+					Description: fmt.Sprintf("容器%s 拉取镜像%s失败: %s", status.Name, status.Image, waiting.Message),
+					Start:       now,
+				})
+			}
+		}
+
+		terminated := status.State.Terminated
+		if terminated == nil || terminated.Reason != "OOMKilled" {
+			terminated = status.LastTerminationState.Terminated
+		}
+		if terminated != nil && terminated.Reason == "OOMKilled" {
+			problems = append(problems, podProblem{
+				Type:        models.RecordTypePodOOMKilled,
+				Severity:    models.SeverityWarning,
+				Container:   status.Name,
+				Reason:      terminated.Reason,
+				Message:     terminated.Message,
+				Description: fmt.Sprintf("容器%s 内存超限被杀(OOMKilled), exit code %d", status.Name, terminated.ExitCode),
+				Start:       terminated.FinishedAt.Time,
+			})
+		}
+
+		// a crash loop is reported as such rather than as a spike
+		key := podAlertKey("", pod.Namespace, pod.Name, status.Name)
+		restarts, ok := a.spike(key, status.RestartCount, now)
+		if ok && (status.State.Waiting == nil || status.State.Waiting.Reason != "CrashLoopBackOff") {
+			problems = append(problems, podProblem{
+				Type:        models.RecordTypePodRestartSpike,
+				Severity:    models.SeverityWarning,
+				Container:   status.Name,
+				Reason:      "RestartSpike",
+				Message:     fmt.Sprintf("%d restarts within %s", restarts, podRestartSpikeWindow()),
+				Description: fmt.Sprintf("容器%s %s内重启%d次, 共%d次", status.Name, podRestartSpikeWindow(), restarts, status.RestartCount),
+				Start:       now,
+			})
+		}
+	}
+	return problems
+}
+
+func getPodCondition(pod *v1.Pod, conditionType v1.PodConditionType) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == conditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// recovered reports whether the open alert of type t about container of pod is over at now.
+// Container alerts are over once the container has been ready for podStableAfter, until then
+// wait tells how long is left.
+func recovered(pod *v1.Pod, t string, container string, now time.Time) (ok bool, wait time.Duration) {
+	if t == models.RecordTypePodPending {
+		return pod.Status.Phase != v1.PodPending, 0
+	}
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Name != container {
+			continue
+		}
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode == 0 {
+			// completed init containers and jobs
+			return true, 0
+		}
+		running := status.State.Running
+		if !status.Ready || running == nil {
+			return false, 0
+		}
+		if stable := now.Sub(running.StartedAt.Time); stable < podStableAfter() {
+			return false, podStableAfter() - stable
+		}
+		return true, 0
+	}
+	// the container is gone
+	return true, 0
+}
+
+// checkPod records the new problems of pod and resolves the alerts that are over.
+func (c *PodListenerController) checkPod(key string, pod *v1.Pod) error {
+	if err := c.alerts.load(); err != nil {
+		logs.Error("查询未恢复pod告警记录失败, ", err)
+		return err
+	}
+
+	now := time.Now()
+	// ongoing problems, OOM kills and restart spikes are events resolved once the container is stable
+	found := make(map[string]bool)
+	for _, problem := range c.alerts.detectPodProblems(pod, now) {
+		alertKey := podAlertKey(problem.Type, pod.Namespace, pod.Name, problem.Container)
+		isEvent := problem.Type == models.RecordTypePodOOMKilled || problem.Type == models.RecordTypePodRestartSpike
+		if !isEvent {
+			found[alertKey] = true
+		}
+		if c.alerts.isOpen(alertKey) {
+			continue
+		}
+		if problem.Type == models.RecordTypePodOOMKilled {
+			// an OOM kill stays the last termination of the container after its record was resolved
+			if c.alerts.oomKillSeen(alertKey, problem.Start) {
+				continue
+			}
+			exists, err := models.RecordMode.ExistPod(problem.Type, pod.Namespace, pod.Name, problem.Container, problem.Start)
+			if err != nil {
+				logs.Error("查询pod告警记录失败, ", err)
+				return err
+			}
+			if exists {
+				c.alerts.seeOOMKill(alertKey, problem.Start)
+				continue
+			}
+		}
+		if err := c.addPodRecord(pod, problem); err != nil {
+			return err
+		}
+		if problem.Type == models.RecordTypePodOOMKilled {
+			c.alerts.seeOOMKill(alertKey, problem.Start)
+		}
+		c.alerts.setOpen(alertKey, true)
+		logs.Warning("pod %s %s: %s", key, problem.Type, problem.Description)
+	}
+
+	var requeueAfter time.Duration
+	for _, t := range []string{models.RecordTypePodPending, models.RecordTypePodCrashLoopBackOff, models.RecordTypePodImagePullBackOff,
+		models.RecordTypePodOOMKilled, models.RecordTypePodRestartSpike} {
+		containers := []string{""}
+		if t != models.RecordTypePodPending {
+			containers = containerNames(pod)
+		}
+		for _, container := range containers {
+			alertKey := podAlertKey(t, pod.Namespace, pod.Name, container)
+			if !c.alerts.isOpen(alertKey) || found[alertKey] {
+				continue
+			}
+			ok, wait := recovered(pod, t, container, now)
+			if !ok {
+				if wait > 0 && (requeueAfter == 0 || wait < requeueAfter) {
+					requeueAfter = wait
+				}
+				continue
+			}
+			if err := resolvePodRecords(pod.Namespace, pod.Name, t, container, now); err != nil {
+				return err
+			}
+			c.alerts.setOpen(alertKey, false)
+		}
+	}
+	if requeueAfter > 0 {
+		c.reconciler.EnqueueAfter(key, requeueAfter)
+	} else if pod.Status.Phase == v1.PodPending && !found[podAlertKey(models.RecordTypePodPending, pod.Namespace, pod.Name, "")] {
+		if left := podPendingTimeout() - now.Sub(pod.CreationTimestamp.Time); left > 0 {
+			c.reconciler.EnqueueAfter(key, left+time.Second)
+		}
+	}
+	return nil
+}
+
+// forgetPod resolves the open alerts of a deleted pod
+func (c *PodListenerController) forgetPod(namespace string, name string) error {
+	if err := c.alerts.load(); err != nil {
+		logs.Error("查询未恢复pod告警记录失败, ", err)
+		return err
+	}
+	if !c.alerts.forget(namespace, name) {
+		return nil
+	}
+	return resolvePodRecords(namespace, name, "", "", time.Now())
+}
+
+func containerNames(pod *v1.Pod) []string {
+	names := make([]string, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for _, container := range pod.Spec.InitContainers {
+		names = append(names, container.Name)
+	}
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	return names
+}
+
+func (c *PodListenerController) addPodRecord(pod *v1.Pod, problem podProblem) error {
+	start := problem.Start
+	record := &models.Record{
+		User:        "",
+		HostName:    pod.Spec.NodeName,
+		Namespace:   pod.Namespace,
+		PodName:     pod.Name,
+		Container:   problem.Container,
+		Type:        problem.Type,
+		Severity:    problem.Severity,
+		Description: problem.Description,
+		Reason:      problem.Reason,
+		Message:     problem.Message,
+		StartTime:   &start,
+		Status:      models.RecordTobeAltert,
+	}
+	// pod alerts are routed and silenced by the labels of their node
+	if pod.Spec.NodeName != "" {
+		if worker, err := c.workerList.Get(pod.Spec.NodeName); err == nil {
+			record.SetLabels(worker.Labels)
+		}
+	}
+	if err := models.RecordMode.Add(record); err != nil {
+		logs.Error("记录pod告警记录失败, ", err)
+		return err
+	}
+	return nil
+}
+
+// resolvePodRecords closes the open records of the pod, of type t and container when
+// they are not empty, and queues a recovery message for each of them.
+func resolvePodRecords(namespace string, name string, t string, container string, resolveTime time.Time) error {
+	records, err := models.RecordMode.ListOpenPods(namespace, name)
+	if err != nil {
+		logs.Error("查询未恢复pod告警记录失败, ", err)
+		return err
+	}
+	for i := range records {
+		record := &records[i]
+		if t != "" && (record.Type != t || record.Container != container) {
+			continue
+		}
+		if err := models.RecordMode.Resolve(record, resolveTime); err != nil {
+			logs.Error("更新告警恢复记录失败, ", err)
+			return err
+		}
+		logs.Info("record %d of pod %s/%s resolved after %ds", record.Id, namespace, name, record.Duration)
+		common.AddRecover(recoverMessage(record))
+	}
+	return nil
+}
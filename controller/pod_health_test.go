@@ -0,0 +1,153 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"node-controller/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestPodAlerts() *podAlerts {
+	return &podAlerts{
+		open:     make(map[string]bool),
+		oomKills: make(map[string]time.Time),
+		restarts: make(map[string]restartWindow),
+	}
+}
+
+// newTestPod is a pod created at created in phase with the container statuses given
+func newTestPod(phase v1.PodPhase, created time.Time, statuses ...v1.ContainerStatus) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod", CreationTimestamp: metav1.NewTime(created)},
+		Status:     v1.PodStatus{Phase: phase, ContainerStatuses: statuses},
+	}
+}
+
+func waitingStatus(name string, reason string, restarts int32) v1.ContainerStatus {
+	return v1.ContainerStatus{
+		Name:         name,
+		State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}},
+		RestartCount: restarts,
+	}
+}
+
+func runningStatus(name string, restarts int32) v1.ContainerStatus {
+	return v1.ContainerStatus{
+		Name:         name,
+		Ready:        true,
+		State:        v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+		RestartCount: restarts,
+	}
+}
+
+func TestDetectPodProblems(t *testing.T) {
+	now := time.Now()
+	killed := metav1.NewTime(now.Add(-time.Minute))
+	oomKilled := &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137, FinishedAt: killed}
+
+	unschedulable := newTestPod(v1.PodPending, now.Add(-time.Hour))
+	unschedulable.Status.Conditions = []v1.PodCondition{{Type: v1.PodScheduled, Status: v1.ConditionFalse, Reason: "Unschedulable"}}
+	initCrashLoop := newTestPod(v1.PodPending, now)
+	initCrashLoop.Status.InitContainerStatuses = []v1.ContainerStatus{waitingStatus("init", "CrashLoopBackOff", 3)}
+	restartedOOMKilled := runningStatus("app", 1)
+	restartedOOMKilled.LastTerminationState.Terminated = oomKilled
+
+	tests := []struct {
+		name string
+		pod  *v1.Pod
+		// restartsBefore is the restart count observed a minute before, -1 when not observed
+		restartsBefore int32
+		// want are the type, container and reason of the problems
+		want [][3]string
+	}{
+		{"healthy", newTestPod(v1.PodRunning, now.Add(-time.Hour), runningStatus("app", 0)), -1, nil},
+		{"pending", newTestPod(v1.PodPending, now.Add(-time.Minute)), -1, nil},
+		{"pending too long", newTestPod(v1.PodPending, now.Add(-time.Hour)), -1, [][3]string{{models.RecordTypePodPending, "", "Pending"}}},
+		{"unschedulable too long", unschedulable, -1, [][3]string{{models.RecordTypePodPending, "", "Unschedulable"}}},
+		{
+			"crash loop",
+			newTestPod(v1.PodRunning, now.Add(-time.Hour), waitingStatus("app", "CrashLoopBackOff", 12)),
+			2,
+			[][3]string{{models.RecordTypePodCrashLoopBackOff, "app", "CrashLoopBackOff"}},
+		},
+		{"init container crash loop", initCrashLoop, -1, [][3]string{{models.RecordTypePodCrashLoopBackOff, "init", "CrashLoopBackOff"}}},
+		{
+			"image pull back off",
+			newTestPod(v1.PodPending, now, waitingStatus("app", "ImagePullBackOff", 0)),
+			-1,
+			[][3]string{{models.RecordTypePodImagePullBackOff, "app", "ImagePullBackOff"}},
+		},
+		{
+			"image pull error",
+			newTestPod(v1.PodPending, now, waitingStatus("app", "ErrImagePull", 0)),
+			-1,
+			[][3]string{{models.RecordTypePodImagePullBackOff, "app", "ErrImagePull"}},
+		},
+		{
+			"OOM killed",
+			newTestPod(v1.PodFailed, now.Add(-time.Hour), v1.ContainerStatus{Name: "app", State: v1.ContainerState{Terminated: oomKilled}}),
+			-1,
+			[][3]string{{models.RecordTypePodOOMKilled, "app", "OOMKilled"}},
+		},
+		{
+			"restarted after an OOM kill",
+			newTestPod(v1.PodRunning, now.Add(-time.Hour), restartedOOMKilled),
+			-1,
+			[][3]string{{models.RecordTypePodOOMKilled, "app", "OOMKilled"}},
+		},
+		{
+			"restart spike",
+			newTestPod(v1.PodRunning, now.Add(-time.Hour), runningStatus("app", 8)),
+			2,
+			[][3]string{{models.RecordTypePodRestartSpike, "app", "RestartSpike"}},
+		},
+		{"restarts below the threshold", newTestPod(v1.PodRunning, now.Add(-time.Hour), runningStatus("app", 6)), 2, nil},
+		{"restarts not observed before", newTestPod(v1.PodRunning, now.Add(-time.Hour), runningStatus("app", 20)), -1, nil},
+	}
+	for _, test := range tests {
+		a := newTestPodAlerts()
+		if test.restartsBefore >= 0 {
+			for _, status := range test.pod.Status.ContainerStatuses {
+				a.spike(podAlertKey("", test.pod.Namespace, test.pod.Name, status.Name), test.restartsBefore, now.Add(-time.Minute))
+			}
+		}
+		var got [][3]string
+		for _, problem := range a.detectPodProblems(test.pod, now) {
+			got = append(got, [3]string{problem.Type, problem.Container, problem.Reason})
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: detectPodProblems() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPodAlertsReset(t *testing.T) {
+	useTestDB(t)
+	a := newTestPodAlerts()
+	if err := a.load(); err != nil {
+		t.Fatal(err)
+	}
+	// written by another leader meanwhile
+	start := time.Now()
+	record := &models.Record{Type: models.RecordTypePodCrashLoopBackOff, Namespace: "default", PodName: "pod", Container: "app", StartTime: &start}
+	if err := models.RecordMode.Add(record); err != nil {
+		t.Fatal(err)
+	}
+	alertKey := podAlertKey(models.RecordTypePodCrashLoopBackOff, "default", "pod", "app")
+	if err := a.load(); err != nil {
+		t.Fatal(err)
+	}
+	if a.isOpen(alertKey) {
+		t.Fatalf("records loaded again before the reset")
+	}
+
+	a.reset()
+	if err := a.load(); err != nil {
+		t.Fatal(err)
+	}
+	if !a.isOpen(alertKey) {
+		t.Errorf("open record not loaded after the reset")
+	}
+}
@@ -49,6 +49,11 @@ func (c *ResultHandlerController) AbortBadRequestFormat(paramName string) {
 	c.AbortBadRequest(msg)
 }
 
+func (c *ResultHandlerController) AbortNotFound(msg string) {
+	logs.Info("Abort NotFound error. %s", msg)
+	c.CustomAbort(http.StatusNotFound, hack.String(c.errorResult(http.StatusNotFound, msg)))
+}
+
 func (c *ResultHandlerController) AbortUnauthorized(msg string) {
 	logs.Info("Abort Unauthorized error. %s", msg)
 	c.CustomAbort(http.StatusUnauthorized, hack.String(c.errorResult(http.StatusUnauthorized, msg)))
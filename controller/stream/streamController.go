@@ -0,0 +1,154 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/websocket"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"node-controller/common"
+	"node-controller/controller"
+	"node-controller/events"
+	"node-controller/util/logs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keepAlive is the interval of the comments sent to idle event streams so that proxies
+// keep them open
+const keepAlive = 15 * time.Second
+
+type StreamController struct {
+	controller.ResultHandlerController
+}
+
+func (c *StreamController) URLMapping() {
+	c.Mapping("Events", c.Events)
+	c.Mapping("WebSocket", c.WebSocket)
+}
+
+// subscribe reads the last event id and the event types of the request
+func (c *StreamController) subscribe(lastEventId string) (*events.Subscription, map[string]bool) {
+	var lastId uint64
+	if lastEventId != "" {
+		var err error
+		if lastId, err = strconv.ParseUint(lastEventId, 10, 64); err != nil {
+			c.AbortBadRequestFormat("lastEventId")
+		}
+	}
+	types := make(map[string]bool)
+	for _, t := range strings.Split(c.GetString("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = true
+		}
+	}
+	return events.Events.Subscribe(lastId), types
+}
+
+func wanted(types map[string]bool, event events.Event) bool {
+	return len(types) == 0 || types[event.Type] || event.Type == events.Reset
+}
+
+// @Title Events
+// @Description server-sent events of the nodes, virtul machines and alerts. A client resumes with the Last-Event-ID header or lastEventId.
+// @Param	lastEventId	query	string	false	"id of the last event received"
+// @Param	types	query	string	false	"event types, comma separated, all by default"
+// @Success 200 {object} events.Event success
+// @router /sse [get]
+func (c *StreamController) Events() {
+	lastEventId := c.Ctx.Input.Header("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = c.GetString("lastEventId")
+	}
+	subscription, types := c.subscribe(lastEventId)
+	defer subscription.Close()
+
+	w := c.Ctx.ResponseWriter
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-subscription.C:
+			if !ok {
+				// lagging behind, the client resumes from its last event
+				return
+			}
+			if !wanted(types, event) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				logs.Error("failed to marshal event %d: %s", event.Id, err.Error())
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-c.Ctx.Request.Context().Done():
+			return
+		}
+		w.Flush()
+	}
+}
+
+// @Title WebSocket
+// @Description websocket of the nodes, virtul machines and alerts events, one json event per message
+// @Param	lastEventId	query	string	false	"id of the last event received"
+// @Param	types	query	string	false	"event types, comma separated, all by default"
+// @Success 101 {object} events.Event success
+// @router /ws [get]
+func (c *StreamController) WebSocket() {
+	subscription, types := c.subscribe(c.GetString("lastEventId"))
+	defer subscription.Close()
+
+	server := websocket.Server{
+		// the cors filter does not apply to websockets, a page of another site could open one
+		// with the cookies of the user. Clients without Origin are not browsers.
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			origin := r.Header.Get("Origin")
+			if origin != "" && !common.IsOriginAllowed(origin) {
+				return fmt.Errorf("origin %s is not allowed", origin)
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			closed := make(chan struct{})
+			go func() {
+				io.Copy(ioutil.Discard, ws)
+				close(closed)
+			}()
+
+			for {
+				select {
+				case event, ok := <-subscription.C:
+					if !ok {
+						return
+					}
+					if !wanted(types, event) {
+						continue
+					}
+					if err := websocket.JSON.Send(ws, event); err != nil {
+						return
+					}
+				case <-closed:
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Ctx.ResponseWriter, c.Ctx.Request)
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	apiv1alpha1 "node-controller/api/virtulmachinecontroller/v1alpha1"
+)
+
+// matchNode reports whether node belongs to vm.
+// The provider id wins when both sides have one, then addresses and hostname are compared.
+func matchNode(vm *apiv1alpha1.VirtulMachine, node *v1.Node) bool {
+	if vm.Spec.ProviderID != "" && node.Spec.ProviderID != "" {
+		return vm.Spec.ProviderID == node.Spec.ProviderID
+	}
+	for _, vmAddress := range vm.Status.Addresses {
+		for _, nodeAddress := range node.Status.Addresses {
+			if vmAddress.Address == nodeAddress.Address {
+				return true
+			}
+		}
+	}
+	return vm.Name == node.Name || vm.Name == node.Labels[v1.LabelHostname]
+}
+
+// bindNode looks up the node of vm. The node recorded in status is kept while it exists.
+func bindNode(vm *apiv1alpha1.VirtulMachine, workerList nodeGetter) (*v1.Node, error) {
+	if vm.Status.NodeName != "" {
+		node, err := workerList.Get(vm.Status.NodeName)
+		if err == nil {
+			return node, nil
+		}
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	nodes, err := workerList.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	// provider id is the strongest match, so look for it before the weaker ones
+	if vm.Spec.ProviderID != "" {
+		for _, node := range nodes {
+			if node.Spec.ProviderID == vm.Spec.ProviderID {
+				return node, nil
+			}
+		}
+	}
+	for _, node := range nodes {
+		if matchNode(vm, node) {
+			return node, nil
+		}
+	}
+	return nil, nil
+}
+
+type nodeGetter interface {
+	List(selector labels.Selector) ([]*v1.Node, error)
+	Get(name string) (*v1.Node, error)
+}
+
+// mirrorNodeStatus copies the status of node into vm, keeping the phase conditions of vm.
+// A nil node clears the binding and what was mirrored of the node. The heartbeat of a node
+// condition is only copied along with a change of the condition, so that the heartbeats of
+// the kubelet do not update vm.
+func mirrorNodeStatus(vm *apiv1alpha1.VirtulMachine, node *v1.Node) {
+	conditions := make([]apiv1alpha1.VirtulMachineCondition, 0, len(vm.Status.Conditions))
+	mirrored := make(map[apiv1alpha1.VirtulMachineConditionType]apiv1alpha1.VirtulMachineCondition)
+	for _, condition := range vm.Status.Conditions {
+		if isPhaseCondition(condition.Type) {
+			conditions = append(conditions, condition)
+		} else {
+			mirrored[condition.Type] = condition
+		}
+	}
+
+	if node == nil {
+		vm.Status.NodeName = ""
+		vm.Status.Capacity = nil
+		vm.Status.Allocatable = nil
+		vm.Status.Addresses = nil
+		vm.Status.VirtulMachineInfo = apiv1alpha1.VirtulMachineSystemInfo{}
+		vm.Status.Conditions = conditions
+		return
+	}
+
+	vm.Status.NodeName = node.Name
+	vm.Status.Capacity = toResourceList(node.Status.Capacity)
+	vm.Status.Allocatable = toResourceList(node.Status.Allocatable)
+	vm.Status.VirtulMachineInfo = apiv1alpha1.VirtulMachineSystemInfo{
+		MachineID:               node.Status.NodeInfo.MachineID,
+		SystemUUID:              node.Status.NodeInfo.SystemUUID,
+		BootID:                  node.Status.NodeInfo.BootID,
+		KernelVersion:           node.Status.NodeInfo.KernelVersion,
+		OSImage:                 node.Status.NodeInfo.OSImage,
+		ContainerRuntimeVersion: node.Status.NodeInfo.ContainerRuntimeVersion,
+		KubeletVersion:          node.Status.NodeInfo.KubeletVersion,
+		KubeProxyVersion:        node.Status.NodeInfo.KubeProxyVersion,
+		OperatingSystem:         node.Status.NodeInfo.OperatingSystem,
+		Architecture:            node.Status.NodeInfo.Architecture,
+	}
+
+	addresses := make([]apiv1alpha1.VirtulMachineAddress, 0, len(node.Status.Addresses))
+	for _, address := range node.Status.Addresses {
+		addresses = append(addresses, apiv1alpha1.VirtulMachineAddress{
+			Type:    apiv1alpha1.VirtulMachineAddressType(address.Type),
+			Address: address.Address,
+		})
+	}
+	vm.Status.Addresses = addresses
+
+	for _, condition := range node.Status.Conditions {
+		c := apiv1alpha1.VirtulMachineCondition{
+			Type:               apiv1alpha1.VirtulMachineConditionType(condition.Type),
+			Status:             apiv1alpha1.ConditionStatus(condition.Status),
+			LastHeartbeatTime:  condition.LastHeartbeatTime,
+			LastTransitionTime: condition.LastTransitionTime,
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+		}
+		if last, ok := mirrored[c.Type]; ok {
+			heartbeat := c
+			heartbeat.LastHeartbeatTime = last.LastHeartbeatTime
+			if equality.Semantic.DeepEqual(heartbeat, last) {
+				c = last
+			}
+		}
+		conditions = append(conditions, c)
+	}
+	vm.Status.Conditions = conditions
+}
+
+func toResourceList(list v1.ResourceList) apiv1alpha1.ResourceList {
+	if list == nil {
+		return nil
+	}
+	result := make(apiv1alpha1.ResourceList, len(list))
+	for name, quantity := range list {
+		result[apiv1alpha1.ResourceName(name)] = quantity.DeepCopy()
+	}
+	return result
+}
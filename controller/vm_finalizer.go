@@ -0,0 +1,236 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/astaxie/beego"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	apiv1alpha1 "node-controller/api/virtulmachinecontroller/v1alpha1"
+	"node-controller/models"
+	"node-controller/util/logs"
+	"time"
+)
+
+// VirtulMachineFinalizer keeps a deleted VirtulMachine until its node is drained and removed
+const VirtulMachineFinalizer = "nodecontroller.k8s.io/drain"
+
+// AnnotationDecommissioned marks a node deleted by the finalizer of its VirtulMachine, the
+// value is the key of the VirtulMachine. The deletion of such a node is not a NodeLost alert.
+const AnnotationDecommissioned = "nodecontroller.k8s.io/decommissioned"
+
+const (
+	ReasonDraining     = "Draining"
+	ReasonDrainTimeout = "DrainTimeout"
+	ReasonNodeDeleted  = "NodeDeleted"
+	ReasonDecommission = "Decommissioned"
+
+	// drainPollInterval is how often a draining node is checked for remaining pods
+	drainPollInterval = 5 * time.Second
+)
+
+func drainTimeout() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("VMDrainTimeout", 600)) * time.Second
+}
+
+// drainForceAfterTimeout tells whether the pods left on the node when the drain times out are
+// deleted, the node is then removed anyway. Otherwise the vm stays Failed with a DrainTimeout
+// alert until the pods are gone.
+func drainForceAfterTimeout() bool {
+	return beego.AppConfig.DefaultBool("VMDrainForceAfterTimeout", false)
+}
+
+func vmDrainOptions() DrainOptions {
+	return DrainOptions{
+		GracePeriodSeconds: beego.AppConfig.DefaultInt64("VMDrainGracePeriod", -1),
+		IgnoreDaemonSets:   true,
+		DeleteEmptyDirData: true,
+	}
+}
+
+func hasFinalizer(vm *apiv1alpha1.VirtulMachine) bool {
+	for _, finalizer := range vm.Finalizers {
+		if finalizer == VirtulMachineFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(finalizers []string) []string {
+	result := make([]string, 0, len(finalizers))
+	for _, finalizer := range finalizers {
+		if finalizer != VirtulMachineFinalizer {
+			result = append(result, finalizer)
+		}
+	}
+	return result
+}
+
+// ensureFinalizer adds the drain finalizer to vm. It returns true when vm was updated,
+// the update event reconciles it again.
+func (n *VirtulMachineListenerController) ensureFinalizer(vm *apiv1alpha1.VirtulMachine) (bool, error) {
+	if vm.DeletionTimestamp != nil || hasFinalizer(vm) {
+		return false, nil
+	}
+	vm = vm.DeepCopy()
+	vm.Finalizers = append(vm.Finalizers, VirtulMachineFinalizer)
+	_, err := n.nodeClientset.NodecontrollerV1alpha1().VirtulMachines(vm.Namespace).Update(vm)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// finalize decommissions the node of a deleted vm: cordon and drain it, delete the Node,
+// write a record and finally release the vm by removing the finalizer.
+// vm is a copy owned by the caller, its status is written here.
+func (n *VirtulMachineListenerController) finalize(vm *apiv1alpha1.VirtulMachine, worker *v1.Node) error {
+	if !hasFinalizer(vm) {
+		return nil
+	}
+	key := vm.Namespace + "/" + vm.Name
+
+	if worker != nil && vm.Status.Phase != apiv1alpha1.VirtulMachineTerminating && vm.Status.Phase != apiv1alpha1.VirtulMachineTerminated {
+		// a timed out drain stays Failed while it is retried
+		drainTimedOut := vm.Status.Phase == apiv1alpha1.VirtulMachineFailed && phaseReason(vm) == ReasonDrainTimeout
+		if vm.Status.Phase != apiv1alpha1.VirtulMachineDraining && !drainTimedOut {
+			if err := setPhase(vm, apiv1alpha1.VirtulMachineDraining, ReasonDraining, fmt.Sprintf("draining node %s", worker.Name)); err != nil {
+				logs.Error(err)
+			}
+		}
+		if !worker.Spec.Unschedulable {
+			if err := Cordon(n.kubeClientset, worker.Name, true); err != nil {
+				return fmt.Errorf("failed to cordon node %s: %s", worker.Name, err.Error())
+			}
+			logs.Info("node %s cordoned for deletion of vm %s", worker.Name, key)
+		}
+
+		remaining, err := EvictPods(n.kubeClientset, worker.Name, vmDrainOptions())
+		if err != nil {
+			return err
+		}
+		if len(remaining) > 0 {
+			if !drainTimedOut {
+				if time.Since(phaseSince(vm)) <= drainTimeout() {
+					n.reconciler.EnqueueAfter(key, drainPollInterval)
+					return n.updateStatus(vm)
+				}
+				message := fmt.Sprintf("%d pods still on node %s after %s", len(remaining), worker.Name, drainTimeout())
+				if err := setPhase(vm, apiv1alpha1.VirtulMachineFailed, ReasonDrainTimeout, message); err != nil {
+					logs.Error(err)
+				}
+				logs.Error("drain of vm %s timed out: %s", key, message)
+				if !drainForceAfterTimeout() {
+					recordDrainTimeout(key, worker, message)
+				}
+			}
+			if !drainForceAfterTimeout() {
+				// no more polling, the drain is tried again on the events of the vm and its node
+				return n.updateStatus(vm)
+			}
+			if err := DeletePods(n.kubeClientset, remaining, vmDrainOptions().GracePeriodSeconds); err != nil {
+				return err
+			}
+			logs.Warning("%d pods left on node %s deleted after the drain of vm %s timed out", len(remaining), worker.Name, key)
+		}
+
+		if err := setPhase(vm, apiv1alpha1.VirtulMachineTerminating, ReasonNodeDeleted, fmt.Sprintf("node %s drained", worker.Name)); err != nil {
+			logs.Error(err)
+		}
+		if err := n.updateStatus(vm); err != nil {
+			return err
+		}
+	}
+
+	if vm.Status.Phase != apiv1alpha1.VirtulMachineTerminated {
+		if vm.Status.Phase != apiv1alpha1.VirtulMachineTerminating {
+			if err := setPhase(vm, apiv1alpha1.VirtulMachineTerminating, ReasonDeletionRequested, "virtul machine is being deleted"); err != nil {
+				logs.Error(err)
+			}
+		}
+		nodeName := vm.Status.NodeName
+		if worker != nil {
+			nodeName = worker.Name
+			if worker.Annotations[AnnotationDecommissioned] == "" {
+				patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, AnnotationDecommissioned, key)
+				_, err := n.kubeClientset.CoreV1().Nodes().Patch(worker.Name, types.StrategicMergePatchType, []byte(patch))
+				if err != nil && !errors.IsNotFound(err) {
+					return fmt.Errorf("failed to annotate node %s: %s", worker.Name, err.Error())
+				}
+			}
+			err := n.kubeClientset.CoreV1().Nodes().Delete(worker.Name, &metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete node %s: %s", worker.Name, err.Error())
+			}
+			logs.Info("node %s of vm %s deleted", worker.Name, key)
+		}
+
+		record := &models.Record{
+			User:        "",
+			HostName:    nodeName,
+			Type:        models.RecordTypeNodeDecommissioned,
+			Severity:    models.SeverityInfo,
+			Description: fmt.Sprintf("worker节点已下线, vm %s", key),
+			Status:      models.RecordAlerted,
+		}
+		if worker != nil {
+			record.SetLabels(worker.Labels)
+		}
+		if err := models.RecordMode.Add(record); err != nil {
+			logs.Error("记录下线记录失败, ", err)
+		}
+		if err := resolveDecommissioned(nodeName, time.Now()); err != nil {
+			return err
+		}
+
+		if err := setPhase(vm, apiv1alpha1.VirtulMachineTerminated, ReasonDecommission, fmt.Sprintf("node %s removed from the cluster", nodeName)); err != nil {
+			logs.Error(err)
+		}
+		if err := n.updateStatus(vm); err != nil {
+			return err
+		}
+	}
+
+	latest, err := n.nodeClientset.NodecontrollerV1alpha1().VirtulMachines(vm.Namespace).Get(vm.Name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	latest.Finalizers = removeFinalizer(latest.Finalizers)
+	_, err = n.nodeClientset.NodecontrollerV1alpha1().VirtulMachines(vm.Namespace).Update(latest)
+	if err == nil {
+		logs.Info("vm %s released", key)
+	}
+	return err
+}
+
+// resolveDecommissioned resolves every open record of the node nodeName removed with its
+// VirtulMachine, the node is not coming back
+func resolveDecommissioned(nodeName string, resolveTime time.Time) error {
+	types := append(nodeOutageTypes(), models.RecordTypeNodeLost, models.RecordTypeVMDrainTimeout)
+	return resolveRecords(nodeName, resolveTime, types...)
+}
+
+// recordDrainTimeout alerts that the node of the deleted vm key could not be drained in time,
+// it is resolved once the node is removed
+func recordDrainTimeout(key string, worker *v1.Node, message string) {
+	now := time.Now()
+	record := &models.Record{
+		HostName:    worker.Name,
+		Type:        models.RecordTypeVMDrainTimeout,
+		Severity:    models.SeverityWarning,
+		Description: fmt.Sprintf("vm %s 删除时节点驱逐超时: %s", key, message),
+		Reason:      ReasonDrainTimeout,
+		Message:     message,
+		StartTime:   &now,
+		Status:      models.RecordTobeAltert,
+	}
+	record.SetLabels(worker.Labels)
+	if err := models.RecordMode.Add(record); err != nil {
+		logs.Error("记录告警记录失败, ", err)
+	}
+}
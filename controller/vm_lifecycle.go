@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/astaxie/beego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiv1alpha1 "node-controller/api/virtulmachinecontroller/v1alpha1"
+	"time"
+)
+
+// phase transition reasons
+const (
+	ReasonCreated           = "Created"
+	ReasonProviderAssigned  = "ProviderAssigned"
+	ReasonNodeRegistered    = "NodeRegistered"
+	ReasonNodeReady         = "NodeReady"
+	ReasonNodeLost          = "NodeLost"
+	ReasonProvisionTimeout  = "ProvisionTimeout"
+	ReasonJoinTimeout       = "JoinTimeout"
+	ReasonDeletionRequested = "DeletionRequested"
+)
+
+// vmPhaseTransitions lists the phases every phase is allowed to move to.
+var vmPhaseTransitions = map[apiv1alpha1.VirtulMachinePhase][]apiv1alpha1.VirtulMachinePhase{
+	apiv1alpha1.VirtulMachinePending: {
+		apiv1alpha1.VirtulMachineProvisioning,
+		apiv1alpha1.VirtulMachineTerminating,
+		apiv1alpha1.VirtulMachineFailed,
+	},
+	apiv1alpha1.VirtulMachineProvisioning: {
+		apiv1alpha1.VirtulMachineJoining,
+		apiv1alpha1.VirtulMachineTerminating,
+		apiv1alpha1.VirtulMachineFailed,
+	},
+	apiv1alpha1.VirtulMachineJoining: {
+		apiv1alpha1.VirtulMachineRunning,
+		apiv1alpha1.VirtulMachineDraining,
+		apiv1alpha1.VirtulMachineTerminating,
+		apiv1alpha1.VirtulMachineFailed,
+	},
+	apiv1alpha1.VirtulMachineRunning: {
+		apiv1alpha1.VirtulMachineDraining,
+		apiv1alpha1.VirtulMachineTerminating,
+		apiv1alpha1.VirtulMachineFailed,
+	},
+	apiv1alpha1.VirtulMachineDraining: {
+		apiv1alpha1.VirtulMachineTerminating,
+		apiv1alpha1.VirtulMachineFailed,
+	},
+	apiv1alpha1.VirtulMachineTerminating: {
+		apiv1alpha1.VirtulMachineTerminated,
+		apiv1alpha1.VirtulMachineFailed,
+	},
+	apiv1alpha1.VirtulMachineTerminated: {},
+	// a failed machine recovers once its node is back, see nextPhase
+	apiv1alpha1.VirtulMachineFailed: {
+		apiv1alpha1.VirtulMachineJoining,
+		apiv1alpha1.VirtulMachineRunning,
+		apiv1alpha1.VirtulMachineDraining,
+		apiv1alpha1.VirtulMachineTerminating,
+	},
+}
+
+// canTransition reports whether a machine in phase from may move to phase to.
+// An empty phase is a freshly created machine and may only become Pending.
+func canTransition(from, to apiv1alpha1.VirtulMachinePhase) bool {
+	if from == "" {
+		return to == apiv1alpha1.VirtulMachinePending
+	}
+	for _, phase := range vmPhaseTransitions[from] {
+		if phase == to {
+			return true
+		}
+	}
+	return false
+}
+
+func isPhaseCondition(conditionType apiv1alpha1.VirtulMachineConditionType) bool {
+	_, ok := vmPhaseTransitions[apiv1alpha1.VirtulMachinePhase(conditionType)]
+	return ok
+}
+
+// setPhase moves vm to phase and records the transition in its conditions.
+// The condition of the new phase becomes True, the one of the previous phase becomes False.
+func setPhase(vm *apiv1alpha1.VirtulMachine, phase apiv1alpha1.VirtulMachinePhase, reason, message string) error {
+	if vm.Status.Phase == phase {
+		return nil
+	}
+	if !canTransition(vm.Status.Phase, phase) {
+		return fmt.Errorf("invalid phase transition of vm %s/%s: %q -> %q", vm.Namespace, vm.Name, vm.Status.Phase, phase)
+	}
+
+	now := metav1.Now()
+	found := false
+	for i := range vm.Status.Conditions {
+		condition := &vm.Status.Conditions[i]
+		if !isPhaseCondition(condition.Type) {
+			continue
+		}
+		if condition.Type == apiv1alpha1.VirtulMachineConditionType(phase) {
+			found = true
+			condition.Status = apiv1alpha1.ConditionTrue
+			condition.LastHeartbeatTime = now
+			condition.LastTransitionTime = now
+			condition.Reason = reason
+			condition.Message = message
+		} else if condition.Status == apiv1alpha1.ConditionTrue {
+			condition.Status = apiv1alpha1.ConditionFalse
+			condition.LastHeartbeatTime = now
+			condition.LastTransitionTime = now
+		}
+	}
+	if !found {
+		vm.Status.Conditions = append(vm.Status.Conditions, apiv1alpha1.VirtulMachineCondition{
+			Type:               apiv1alpha1.VirtulMachineConditionType(phase),
+			Status:             apiv1alpha1.ConditionTrue,
+			LastHeartbeatTime:  now,
+			LastTransitionTime: now,
+			Reason:             reason,
+			Message:            message,
+		})
+	}
+	vm.Status.Phase = phase
+	return nil
+}
+
+// phaseReason returns the reason vm entered its current phase for.
+func phaseReason(vm *apiv1alpha1.VirtulMachine) string {
+	for _, condition := range vm.Status.Conditions {
+		if condition.Type == apiv1alpha1.VirtulMachineConditionType(vm.Status.Phase) {
+			return condition.Reason
+		}
+	}
+	return ""
+}
+
+// phaseSince returns when vm entered its current phase.
+func phaseSince(vm *apiv1alpha1.VirtulMachine) time.Time {
+	for _, condition := range vm.Status.Conditions {
+		if condition.Type == apiv1alpha1.VirtulMachineConditionType(vm.Status.Phase) {
+			return condition.LastTransitionTime.Time
+		}
+	}
+	return vm.CreationTimestamp.Time
+}
+
+func provisionTimeout() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("VMProvisionTimeout", 1800)) * time.Second
+}
+
+func joinTimeout() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt("VMJoinTimeout", 600)) * time.Second
+}
+
+// phaseResult is the phase a machine should be in, with the reason of the transition.
+// RequeueAfter is set when the phase has a deadline that has to be checked again.
+type phaseResult struct {
+	Phase        apiv1alpha1.VirtulMachinePhase
+	Reason       string
+	Message      string
+	RequeueAfter time.Duration
+}
+
+// nextPhase computes the phase vm should move to from what is observed in the cluster.
+// node is the Node registered for vm, nil if there is none.
+func nextPhase(vm *apiv1alpha1.VirtulMachine, node *v1.Node, now time.Time) phaseResult {
+	current := vm.Status.Phase
+	result := phaseResult{Phase: current}
+
+	if vm.DeletionTimestamp != nil {
+		// deletion is driven by the finalizer
+		return result
+	}
+
+	switch current {
+	case "":
+		return phaseResult{Phase: apiv1alpha1.VirtulMachinePending, Reason: ReasonCreated, Message: "virtul machine accepted"}
+	case apiv1alpha1.VirtulMachineTerminated, apiv1alpha1.VirtulMachineDraining, apiv1alpha1.VirtulMachineTerminating:
+		return result
+	case apiv1alpha1.VirtulMachineFailed:
+		return recoverPhase(vm, node)
+	}
+
+	if vm.Spec.ProviderID == "" {
+		return result
+	}
+	if current == apiv1alpha1.VirtulMachinePending {
+		return phaseResult{
+			Phase:   apiv1alpha1.VirtulMachineProvisioning,
+			Reason:  ReasonProviderAssigned,
+			Message: fmt.Sprintf("provider id %s assigned", vm.Spec.ProviderID),
+		}
+	}
+
+	since := phaseSince(vm)
+	switch {
+	case node == nil && current == apiv1alpha1.VirtulMachineRunning:
+		return phaseResult{Phase: apiv1alpha1.VirtulMachineFailed, Reason: ReasonNodeLost, Message: "node of the virtul machine disappeared"}
+	case node == nil:
+		if deadline := since.Add(provisionTimeout()); now.Before(deadline) {
+			result.RequeueAfter = deadline.Sub(now)
+			return result
+		}
+		return phaseResult{
+			Phase:   apiv1alpha1.VirtulMachineFailed,
+			Reason:  ReasonProvisionTimeout,
+			Message: fmt.Sprintf("no node registered within %s", provisionTimeout()),
+		}
+	case isNodeReady(node):
+		if current == apiv1alpha1.VirtulMachineProvisioning {
+			// Joining is passed through when the node is already Ready at registration.
+			return phaseResult{
+				Phase:   apiv1alpha1.VirtulMachineJoining,
+				Reason:  ReasonNodeRegistered,
+				Message: fmt.Sprintf("node %s registered", node.Name),
+			}
+		}
+		return phaseResult{Phase: apiv1alpha1.VirtulMachineRunning, Reason: ReasonNodeReady, Message: fmt.Sprintf("node %s is ready", node.Name)}
+	case current == apiv1alpha1.VirtulMachineProvisioning:
+		return phaseResult{
+			Phase:   apiv1alpha1.VirtulMachineJoining,
+			Reason:  ReasonNodeRegistered,
+			Message: fmt.Sprintf("node %s registered", node.Name),
+		}
+	case current == apiv1alpha1.VirtulMachineJoining:
+		if deadline := since.Add(joinTimeout()); now.Before(deadline) {
+			result.RequeueAfter = deadline.Sub(now)
+			return result
+		}
+		return phaseResult{
+			Phase:   apiv1alpha1.VirtulMachineFailed,
+			Reason:  ReasonJoinTimeout,
+			Message: fmt.Sprintf("node %s not ready within %s", node.Name, joinTimeout()),
+		}
+	}
+	// a Running machine whose node is NotReady stays Running, the outage is alerted on the node
+	return result
+}
+
+// recoverPhase is the phase of a Failed vm whose node is back: Running once the node is Ready,
+// Joining while it is not unless it failed to join. A timed out drain stays Failed.
+func recoverPhase(vm *apiv1alpha1.VirtulMachine, node *v1.Node) phaseResult {
+	result := phaseResult{Phase: vm.Status.Phase}
+	reason := phaseReason(vm)
+	if node == nil || reason == ReasonDrainTimeout {
+		return result
+	}
+	if isNodeReady(node) {
+		return phaseResult{Phase: apiv1alpha1.VirtulMachineRunning, Reason: ReasonNodeReady, Message: fmt.Sprintf("node %s is ready again", node.Name)}
+	}
+	if reason == ReasonJoinTimeout {
+		return result
+	}
+	return phaseResult{
+		Phase:   apiv1alpha1.VirtulMachineJoining,
+		Reason:  ReasonNodeRegistered,
+		Message: fmt.Sprintf("node %s registered", node.Name),
+	}
+}
+
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiv1alpha1 "node-controller/api/virtulmachinecontroller/v1alpha1"
+	"testing"
+	"time"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to apiv1alpha1.VirtulMachinePhase
+		want     bool
+	}{
+		{"", apiv1alpha1.VirtulMachinePending, true},
+		{"", apiv1alpha1.VirtulMachineRunning, false},
+		{apiv1alpha1.VirtulMachinePending, apiv1alpha1.VirtulMachineProvisioning, true},
+		{apiv1alpha1.VirtulMachinePending, apiv1alpha1.VirtulMachineRunning, false},
+		{apiv1alpha1.VirtulMachineProvisioning, apiv1alpha1.VirtulMachineJoining, true},
+		{apiv1alpha1.VirtulMachineJoining, apiv1alpha1.VirtulMachineRunning, true},
+		{apiv1alpha1.VirtulMachineRunning, apiv1alpha1.VirtulMachineJoining, false},
+		{apiv1alpha1.VirtulMachineRunning, apiv1alpha1.VirtulMachineDraining, true},
+		{apiv1alpha1.VirtulMachineDraining, apiv1alpha1.VirtulMachineRunning, false},
+		{apiv1alpha1.VirtulMachineTerminating, apiv1alpha1.VirtulMachineTerminated, true},
+		{apiv1alpha1.VirtulMachineTerminated, apiv1alpha1.VirtulMachinePending, false},
+		{apiv1alpha1.VirtulMachineFailed, apiv1alpha1.VirtulMachineJoining, true},
+		{apiv1alpha1.VirtulMachineFailed, apiv1alpha1.VirtulMachineRunning, true},
+		{apiv1alpha1.VirtulMachineFailed, apiv1alpha1.VirtulMachineTerminating, true},
+		{apiv1alpha1.VirtulMachineFailed, apiv1alpha1.VirtulMachineProvisioning, false},
+	}
+	for _, test := range tests {
+		if got := canTransition(test.from, test.to); got != test.want {
+			t.Errorf("canTransition(%q, %q) = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+// newPhaseVM is a vm in phase since the time given, entered for reason
+func newPhaseVM(phase apiv1alpha1.VirtulMachinePhase, reason string, since time.Time) *apiv1alpha1.VirtulMachine {
+	vm := &apiv1alpha1.VirtulMachine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "vm"},
+		Spec:       apiv1alpha1.VirtulMachineSpec{ProviderID: "cloud://vm"},
+	}
+	vm.Status.Phase = phase
+	if phase != "" {
+		vm.Status.Conditions = []apiv1alpha1.VirtulMachineCondition{{
+			Type:               apiv1alpha1.VirtulMachineConditionType(phase),
+			Status:             apiv1alpha1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(since),
+			Reason:             reason,
+		}}
+	}
+	return vm
+}
+
+func newReadyNode(ready bool) *v1.Node {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func TestNextPhase(t *testing.T) {
+	now := time.Now()
+	recently := now.Add(-time.Minute)
+	longAgo := now.Add(-24 * time.Hour)
+
+	deleted := newPhaseVM(apiv1alpha1.VirtulMachineRunning, ReasonNodeReady, recently)
+	deletedAt := metav1.NewTime(now)
+	deleted.DeletionTimestamp = &deletedAt
+	unassigned := newPhaseVM(apiv1alpha1.VirtulMachinePending, ReasonCreated, recently)
+	unassigned.Spec.ProviderID = ""
+
+	tests := []struct {
+		name    string
+		vm      *apiv1alpha1.VirtulMachine
+		node    *v1.Node
+		phase   apiv1alpha1.VirtulMachinePhase
+		reason  string
+		requeue bool
+	}{
+		{"deleting is left to the finalizer", deleted, nil, apiv1alpha1.VirtulMachineRunning, "", false},
+		{"created", newPhaseVM("", "", now), nil, apiv1alpha1.VirtulMachinePending, ReasonCreated, false},
+		{"pending without provider", unassigned, nil, apiv1alpha1.VirtulMachinePending, "", false},
+		{"provider assigned", newPhaseVM(apiv1alpha1.VirtulMachinePending, ReasonCreated, recently), nil, apiv1alpha1.VirtulMachineProvisioning, ReasonProviderAssigned, false},
+		{"provisioning", newPhaseVM(apiv1alpha1.VirtulMachineProvisioning, ReasonProviderAssigned, recently), nil, apiv1alpha1.VirtulMachineProvisioning, "", true},
+		{"provision timeout", newPhaseVM(apiv1alpha1.VirtulMachineProvisioning, ReasonProviderAssigned, longAgo), nil, apiv1alpha1.VirtulMachineFailed, ReasonProvisionTimeout, false},
+		{"node registered", newPhaseVM(apiv1alpha1.VirtulMachineProvisioning, ReasonProviderAssigned, recently), newReadyNode(false), apiv1alpha1.VirtulMachineJoining, ReasonNodeRegistered, false},
+		{"node registered ready", newPhaseVM(apiv1alpha1.VirtulMachineProvisioning, ReasonProviderAssigned, recently), newReadyNode(true), apiv1alpha1.VirtulMachineJoining, ReasonNodeRegistered, false},
+		{"joining", newPhaseVM(apiv1alpha1.VirtulMachineJoining, ReasonNodeRegistered, recently), newReadyNode(false), apiv1alpha1.VirtulMachineJoining, "", true},
+		{"joined", newPhaseVM(apiv1alpha1.VirtulMachineJoining, ReasonNodeRegistered, recently), newReadyNode(true), apiv1alpha1.VirtulMachineRunning, ReasonNodeReady, false},
+		{"join timeout", newPhaseVM(apiv1alpha1.VirtulMachineJoining, ReasonNodeRegistered, longAgo), newReadyNode(false), apiv1alpha1.VirtulMachineFailed, ReasonJoinTimeout, false},
+		{"running not ready", newPhaseVM(apiv1alpha1.VirtulMachineRunning, ReasonNodeReady, recently), newReadyNode(false), apiv1alpha1.VirtulMachineRunning, "", false},
+		{"node lost", newPhaseVM(apiv1alpha1.VirtulMachineRunning, ReasonNodeReady, recently), nil, apiv1alpha1.VirtulMachineFailed, ReasonNodeLost, false},
+		{"draining", newPhaseVM(apiv1alpha1.VirtulMachineDraining, ReasonDeletionRequested, recently), newReadyNode(true), apiv1alpha1.VirtulMachineDraining, "", false},
+		{"failed without node", newPhaseVM(apiv1alpha1.VirtulMachineFailed, ReasonNodeLost, recently), nil, apiv1alpha1.VirtulMachineFailed, "", false},
+		{"failed node back ready", newPhaseVM(apiv1alpha1.VirtulMachineFailed, ReasonNodeLost, recently), newReadyNode(true), apiv1alpha1.VirtulMachineRunning, ReasonNodeReady, false},
+		{"failed node back not ready", newPhaseVM(apiv1alpha1.VirtulMachineFailed, ReasonNodeLost, recently), newReadyNode(false), apiv1alpha1.VirtulMachineJoining, ReasonNodeRegistered, false},
+		{"failed to join", newPhaseVM(apiv1alpha1.VirtulMachineFailed, ReasonJoinTimeout, recently), newReadyNode(false), apiv1alpha1.VirtulMachineFailed, "", false},
+		{"failed to join ready at last", newPhaseVM(apiv1alpha1.VirtulMachineFailed, ReasonJoinTimeout, recently), newReadyNode(true), apiv1alpha1.VirtulMachineRunning, ReasonNodeReady, false},
+		{"drain timeout is sticky", newPhaseVM(apiv1alpha1.VirtulMachineFailed, ReasonDrainTimeout, recently), newReadyNode(true), apiv1alpha1.VirtulMachineFailed, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			from := test.vm.Status.Phase
+			got := nextPhase(test.vm, test.node, now)
+			if got.Phase != test.phase || got.Reason != test.reason {
+				t.Errorf("nextPhase() = %q (%s), want %q (%s)", got.Phase, got.Reason, test.phase, test.reason)
+			}
+			if requeue := got.RequeueAfter > 0; requeue != test.requeue {
+				t.Errorf("nextPhase() requeue after %s, want requeue %v", got.RequeueAfter, test.requeue)
+			}
+			if got.Phase != from && !canTransition(from, got.Phase) {
+				t.Errorf("nextPhase() moves %q to %q, which is not an allowed transition", from, got.Phase)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"encoding/json"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes"
+	apiv1alpha1 "node-controller/api/virtulmachinecontroller/v1alpha1"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AnnotationManagedTaints records the taints (key:effect) the controller applied to a node
+	AnnotationManagedTaints = "nodecontroller.k8s.io/managed-taints"
+	// AnnotationManagedLabels records the label keys the controller applied to a node
+	AnnotationManagedLabels = "nodecontroller.k8s.io/managed-labels"
+	// AnnotationManagedUnschedulable records the schedulability ("true" or "false") the
+	// controller last applied to a node
+	AnnotationManagedUnschedulable = "nodecontroller.k8s.io/managed-unschedulable"
+)
+
+// desiredNode returns a copy of node with the taints, labels and schedulability of vm applied.
+// Only the taints and labels recorded in the managed annotations are touched,
+// everything added to the node by other parties is left alone. The schedulability is only
+// applied when the spec of vm changes it, a cordon for maintenance is kept.
+func desiredNode(vm *apiv1alpha1.VirtulMachine, node *v1.Node) *v1.Node {
+	desired := node.DeepCopy()
+	if desired.Annotations == nil {
+		desired.Annotations = map[string]string{}
+	}
+	if desired.Labels == nil {
+		desired.Labels = map[string]string{}
+	}
+
+	// taints
+	wanted := make([]v1.Taint, 0, len(vm.Spec.Taints))
+	wantedByKey := make(map[string]v1.Taint, len(vm.Spec.Taints))
+	for _, taint := range vm.Spec.Taints {
+		t := v1.Taint{
+			Key:       taint.Key,
+			Value:     taint.Value,
+			Effect:    v1.TaintEffect(taint.Effect),
+			TimeAdded: taint.TimeAdded,
+		}
+		wanted = append(wanted, t)
+		wantedByKey[taintKey(t)] = t
+	}
+	managed := splitAnnotation(node.Annotations[AnnotationManagedTaints])
+	taints := make([]v1.Taint, 0, len(node.Spec.Taints)+len(wanted))
+	applied := make(map[string]bool, len(wanted))
+	for _, taint := range node.Spec.Taints {
+		key := taintKey(taint)
+		if t, ok := wantedByKey[key]; ok {
+			if t.TimeAdded == nil {
+				t.TimeAdded = taint.TimeAdded
+			}
+			taints = append(taints, t)
+			applied[key] = true
+			continue
+		}
+		if managed[key] {
+			// applied by us before and removed from the spec since
+			continue
+		}
+		taints = append(taints, taint)
+	}
+	for _, t := range wanted {
+		if key := taintKey(t); !applied[key] {
+			taints = append(taints, t)
+			applied[key] = true
+		}
+	}
+	if len(taints) == 0 {
+		taints = nil
+	}
+	desired.Spec.Taints = taints
+	setAnnotation(desired, AnnotationManagedTaints, applied)
+
+	// labels
+	for key := range splitAnnotation(node.Annotations[AnnotationManagedLabels]) {
+		if _, ok := vm.Spec.Labels[key]; !ok {
+			delete(desired.Labels, key)
+		}
+	}
+	labelKeys := make(map[string]bool, len(vm.Spec.Labels))
+	for key, value := range vm.Spec.Labels {
+		desired.Labels[key] = value
+		labelKeys[key] = true
+	}
+	setAnnotation(desired, AnnotationManagedLabels, labelKeys)
+
+	// schedulability, a node not managed yet is only cordoned
+	unschedulable := strconv.FormatBool(vm.Spec.Unschedulable)
+	if last, ok := node.Annotations[AnnotationManagedUnschedulable]; last != unschedulable {
+		if ok || vm.Spec.Unschedulable {
+			desired.Spec.Unschedulable = vm.Spec.Unschedulable
+		}
+		desired.Annotations[AnnotationManagedUnschedulable] = unschedulable
+	}
+	return desired
+}
+
+// applyNodeSpec patches node so that it matches the spec of vm, reverting drift.
+// The patch carries the resourceVersion of node, a concurrent edit makes it fail with a conflict
+// and the virtul machine is retried against the new node.
+func applyNodeSpec(kubeClient kubernetes.Interface, vm *apiv1alpha1.VirtulMachine, node *v1.Node) (bool, error) {
+	desired := desiredNode(vm, node)
+
+	oldData, err := json.Marshal(node)
+	if err != nil {
+		return false, err
+	}
+	newData, err := json.Marshal(desired)
+	if err != nil {
+		return false, err
+	}
+	patch, err := strategicpatch.CreateTwoWayMergePatch(oldData, newData, v1.Node{})
+	if err != nil {
+		return false, err
+	}
+	if string(patch) == "{}" {
+		return false, nil
+	}
+
+	patch, err = withResourceVersion(patch, node.ResourceVersion)
+	if err != nil {
+		return false, err
+	}
+	_, err = kubeClient.CoreV1().Nodes().Patch(node.Name, types.StrategicMergePatchType, patch)
+	return err == nil, err
+}
+
+// withResourceVersion adds metadata.resourceVersion to patch as an optimistic lock.
+func withResourceVersion(patch []byte, resourceVersion string) ([]byte, error) {
+	var patchMap map[string]interface{}
+	if err := json.Unmarshal(patch, &patchMap); err != nil {
+		return nil, err
+	}
+	metadata, ok := patchMap["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		patchMap["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = resourceVersion
+	return json.Marshal(patchMap)
+}
+
+func taintKey(taint v1.Taint) string {
+	return taint.Key + ":" + string(taint.Effect)
+}
+
+func splitAnnotation(value string) map[string]bool {
+	result := map[string]bool{}
+	for _, item := range strings.Split(value, ",") {
+		if item != "" {
+			result[item] = true
+		}
+	}
+	return result
+}
+
+func setAnnotation(node *v1.Node, annotation string, items map[string]bool) {
+	if len(items) == 0 {
+		delete(node.Annotations, annotation)
+		return
+	}
+	values := make([]string, 0, len(items))
+	for item := range items {
+		values = append(values, item)
+	}
+	sort.Strings(values)
+	node.Annotations[annotation] = strings.Join(values, ",")
+}
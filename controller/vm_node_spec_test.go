@@ -0,0 +1,126 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiv1alpha1 "node-controller/api/virtulmachinecontroller/v1alpha1"
+	"testing"
+)
+
+func TestDesiredNode(t *testing.T) {
+	noSchedule := apiv1alpha1.Taint{Key: "dedicated", Value: "vm", Effect: apiv1alpha1.TaintEffect(v1.TaintEffectNoSchedule)}
+	foreign := v1.Taint{Key: "maintenance", Effect: v1.TaintEffectNoExecute}
+
+	tests := []struct {
+		name string
+		spec apiv1alpha1.VirtulMachineSpec
+		node v1.NodeSpec
+		// annotations of the node before
+		annotations map[string]string
+		labels      map[string]string
+
+		wantTaints        []v1.Taint
+		wantLabels        map[string]string
+		wantUnschedulable bool
+		wantAnnotations   map[string]string
+	}{
+		{
+			name:            "nothing to apply",
+			wantAnnotations: map[string]string{AnnotationManagedUnschedulable: "false"},
+		},
+		{
+			name:       "taints and labels applied",
+			spec:       apiv1alpha1.VirtulMachineSpec{Taints: []apiv1alpha1.Taint{noSchedule}, Labels: map[string]string{"zone": "a"}},
+			wantTaints: []v1.Taint{{Key: "dedicated", Value: "vm", Effect: v1.TaintEffectNoSchedule}},
+			wantLabels: map[string]string{"zone": "a"},
+			wantAnnotations: map[string]string{
+				AnnotationManagedTaints:        "dedicated:NoSchedule",
+				AnnotationManagedLabels:        "zone",
+				AnnotationManagedUnschedulable: "false",
+			},
+		},
+		{
+			name:        "foreign taints and labels kept",
+			spec:        apiv1alpha1.VirtulMachineSpec{Taints: []apiv1alpha1.Taint{noSchedule}},
+			node:        v1.NodeSpec{Taints: []v1.Taint{foreign}},
+			labels:      map[string]string{"team": "infra"},
+			annotations: map[string]string{AnnotationManagedUnschedulable: "false"},
+			wantTaints:  []v1.Taint{foreign, {Key: "dedicated", Value: "vm", Effect: v1.TaintEffectNoSchedule}},
+			wantLabels:  map[string]string{"team": "infra"},
+			wantAnnotations: map[string]string{
+				AnnotationManagedTaints:        "dedicated:NoSchedule",
+				AnnotationManagedUnschedulable: "false",
+			},
+		},
+		{
+			name: "managed taints and labels removed from the spec",
+			node: v1.NodeSpec{Taints: []v1.Taint{{Key: "dedicated", Value: "vm", Effect: v1.TaintEffectNoSchedule}, foreign}},
+			annotations: map[string]string{
+				AnnotationManagedTaints:        "dedicated:NoSchedule",
+				AnnotationManagedLabels:        "zone",
+				AnnotationManagedUnschedulable: "false",
+			},
+			labels:          map[string]string{"zone": "a", "team": "infra"},
+			wantTaints:      []v1.Taint{foreign},
+			wantLabels:      map[string]string{"team": "infra"},
+			wantAnnotations: map[string]string{AnnotationManagedUnschedulable: "false"},
+		},
+		{
+			name:              "cordoned when first managed",
+			spec:              apiv1alpha1.VirtulMachineSpec{Unschedulable: true},
+			wantUnschedulable: true,
+			wantAnnotations:   map[string]string{AnnotationManagedUnschedulable: "true"},
+		},
+		{
+			name:              "a cordon for maintenance is not undone when first managed",
+			node:              v1.NodeSpec{Unschedulable: true},
+			wantUnschedulable: true,
+			wantAnnotations:   map[string]string{AnnotationManagedUnschedulable: "false"},
+		},
+		{
+			name:              "a cordon for maintenance is kept while the spec does not change",
+			node:              v1.NodeSpec{Unschedulable: true},
+			annotations:       map[string]string{AnnotationManagedUnschedulable: "false"},
+			wantUnschedulable: true,
+			wantAnnotations:   map[string]string{AnnotationManagedUnschedulable: "false"},
+		},
+		{
+			name:            "uncordoned when the spec changes",
+			node:            v1.NodeSpec{Unschedulable: true},
+			annotations:     map[string]string{AnnotationManagedUnschedulable: "true"},
+			wantAnnotations: map[string]string{AnnotationManagedUnschedulable: "false"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vm := &apiv1alpha1.VirtulMachine{Spec: test.spec}
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node", Annotations: test.annotations, Labels: test.labels},
+				Spec:       test.node,
+			}
+			before := node.DeepCopy()
+
+			desired := desiredNode(vm, node)
+			if !equality.Semantic.DeepEqual(desired.Spec.Taints, test.wantTaints) {
+				t.Errorf("taints = %v, want %v", desired.Spec.Taints, test.wantTaints)
+			}
+			wantLabels := test.wantLabels
+			if wantLabels == nil {
+				wantLabels = map[string]string{}
+			}
+			if !equality.Semantic.DeepEqual(desired.Labels, wantLabels) {
+				t.Errorf("labels = %v, want %v", desired.Labels, wantLabels)
+			}
+			if desired.Spec.Unschedulable != test.wantUnschedulable {
+				t.Errorf("unschedulable = %v, want %v", desired.Spec.Unschedulable, test.wantUnschedulable)
+			}
+			if !equality.Semantic.DeepEqual(desired.Annotations, test.wantAnnotations) {
+				t.Errorf("annotations = %v, want %v", desired.Annotations, test.wantAnnotations)
+			}
+			if !equality.Semantic.DeepEqual(node, before) {
+				t.Errorf("node was modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package events
+
+import (
+	"github.com/astaxie/beego"
+	"sync"
+	"time"
+)
+
+// event types
+const (
+	WorkerAdded   = "WorkerAdded"
+	WorkerUpdated = "WorkerUpdated"
+	WorkerRemoved = "WorkerRemoved"
+	// WorkerConditionChanged is sent when the status of a node condition changes
+	WorkerConditionChanged = "WorkerConditionChanged"
+
+	VirtulMachineAdded   = "VirtulMachineAdded"
+	VirtulMachineUpdated = "VirtulMachineUpdated"
+	VirtulMachineRemoved = "VirtulMachineRemoved"
+
+	AlertCreated      = "AlertCreated"
+	AlertAcknowledged = "AlertAcknowledged"
+	AlertResolved     = "AlertResolved"
+
+	// Reset tells a subscriber the events after its last event id are lost, it has to
+	// list everything again
+	Reset = "Reset"
+)
+
+// subscriberBuffer is how many events a subscriber may lag behind before it is dropped
+const subscriberBuffer = 256
+
+type Event struct {
+	Id     uint64      `json:"id"`
+	Type   string      `json:"type"`
+	Time   time.Time   `json:"time"`
+	Object interface{} `json:"object,omitempty"`
+}
+
+// Broker fans the published events out to the subscribers and keeps the last ones so
+// that a subscriber can resume after its last event id. Ids start at the startup time in
+// milliseconds times 1000, they keep increasing across restarts.
+type Broker struct {
+	lock        sync.Mutex
+	lastId      uint64
+	buffer      []Event
+	size        int
+	subscribers map[*Subscription]bool
+	closed      bool
+}
+
+type Subscription struct {
+	C      chan Event
+	broker *Broker
+	closed bool
+}
+
+var Events *Broker
+
+func init() {
+	Events = NewBroker(beego.AppConfig.DefaultInt("EventBufferSize", 1000))
+}
+
+func NewBroker(size int) *Broker {
+	if size <= 0 {
+		size = 1
+	}
+	return &Broker{
+		lastId:      uint64(time.Now().UnixNano()/int64(time.Millisecond)) * 1000,
+		buffer:      make([]Event, 0, size),
+		size:        size,
+		subscribers: map[*Subscription]bool{},
+	}
+}
+
+// Publish sends an event of type t about object to every subscriber, the subscribers
+// lagging behind are dropped
+func (b *Broker) Publish(t string, object interface{}) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.lastId++
+	event := Event{Id: b.lastId, Type: t, Time: time.Now(), Object: object}
+	if len(b.buffer) == b.size {
+		copy(b.buffer, b.buffer[1:])
+		b.buffer = b.buffer[:b.size-1]
+	}
+	b.buffer = append(b.buffer, event)
+
+	for s := range b.subscribers {
+		select {
+		case s.C <- event:
+		default:
+			b.close(s)
+		}
+	}
+}
+
+// Subscribe returns a subscription receiving the events after lastId, every new event
+// when lastId is 0. A Reset event comes first when the events after lastId are no
+// longer kept. C is closed when the subscriber lags behind, it may resume from the last
+// event it got.
+func (b *Broker) Subscribe(lastId uint64) *Subscription {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s := &Subscription{C: make(chan Event, subscriberBuffer+b.size+1), broker: b}
+	if b.closed {
+		s.closed = true
+		close(s.C)
+		return s
+	}
+	if lastId != 0 && lastId != b.lastId {
+		if lastId > b.lastId || len(b.buffer) == 0 || lastId < b.buffer[0].Id-1 {
+			s.C <- Event{Id: b.lastId, Type: Reset, Time: time.Now()}
+		} else {
+			for _, event := range b.buffer {
+				if event.Id > lastId {
+					s.C <- event
+				}
+			}
+		}
+	}
+	b.subscribers[s] = true
+	return s
+}
+
+// close drops s, the lock must be held
+func (b *Broker) close(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(b.subscribers, s)
+	close(s.C)
+}
+
+// Close ends every subscription and the ones to come, on shutdown
+func (b *Broker) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		b.close(s)
+	}
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.broker.lock.Lock()
+	defer s.broker.lock.Unlock()
+	s.broker.close(s)
+}
@@ -0,0 +1,179 @@
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// pending returns the types of the events waiting in s, "closed" last when C is closed
+func pending(s *Subscription) []string {
+	types := make([]string, 0)
+	for {
+		select {
+		case event, ok := <-s.C:
+			if !ok {
+				return append(types, "closed")
+			}
+			types = append(types, event.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	b := NewBroker(3)
+	first := b.lastId
+	for i := 1; i <= 5; i++ {
+		b.Publish(fmt.Sprintf("e%d", i), i)
+	}
+	// e3, e4 and e5 are kept
+	tests := []struct {
+		name   string
+		lastId uint64
+		want   []string
+	}{
+		{"new events only", 0, []string{}},
+		{"up to date", first + 5, []string{}},
+		{"after the last kept", first + 4, []string{"e5"}},
+		{"before the first kept", first + 2, []string{"e3", "e4", "e5"}},
+		{"events lost", first + 1, []string{Reset}},
+		{"id of another run", first + 6, []string{Reset}},
+	}
+	for _, test := range tests {
+		s := b.Subscribe(test.lastId)
+		if got := pending(s); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Subscribe(%d) got %v, want %v", test.name, test.lastId, got, test.want)
+		}
+		s.Close()
+	}
+
+	s := b.Subscribe(first + 1)
+	if event := <-s.C; event.Id != first+5 {
+		t.Errorf("reset event id = %d, want the last id %d", event.Id, first+5)
+	}
+	b.Publish("e6", 6)
+	if event := <-s.C; event.Type != "e6" || event.Id != first+6 || event.Object != 6 {
+		t.Errorf("event after the reset = %+v, want e6 with id %d", event, first+6)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	b := NewBroker(10)
+	a, c := b.Subscribe(0), b.Subscribe(0)
+	b.Publish(WorkerAdded, "node")
+	b.Publish(WorkerRemoved, "node")
+
+	want := []string{WorkerAdded, WorkerRemoved}
+	for _, s := range []*Subscription{a, c} {
+		if got := pending(s); !reflect.DeepEqual(got, want) {
+			t.Errorf("events = %v, want %v", got, want)
+		}
+	}
+
+	c.Close()
+	b.Publish(WorkerUpdated, "node")
+	if got := pending(a); !reflect.DeepEqual(got, []string{WorkerUpdated}) {
+		t.Errorf("events = %v, want %v", got, []string{WorkerUpdated})
+	}
+	if got := pending(c); !reflect.DeepEqual(got, []string{"closed"}) {
+		t.Errorf("events after close = %v, want the channel closed", got)
+	}
+	// closing again is harmless
+	c.Close()
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	b := NewBroker(4)
+	slow, fast := b.Subscribe(0), b.Subscribe(0)
+	capacity := cap(slow.C)
+	for i := 0; i <= capacity; i++ {
+		b.Publish(WorkerUpdated, i)
+		if event := <-fast.C; event.Object != i {
+			t.Fatalf("fast subscriber got %v, want event %d", event.Object, i)
+		}
+	}
+	got := pending(slow)
+	if len(got) != capacity+1 || got[capacity] != "closed" {
+		t.Errorf("slow subscriber got %d events, want %d and the channel closed", len(got), capacity)
+	}
+	var lastId uint64
+	for _, event := range b.buffer {
+		lastId = event.Id
+	}
+
+	// the slow subscriber resumes from the last event it got, or lists everything again
+	resumed := b.Subscribe(lastId - 1)
+	if got := pending(resumed); !reflect.DeepEqual(got, []string{WorkerUpdated}) {
+		t.Errorf("resumed events = %v, want the last one", got)
+	}
+	resumed.Close()
+
+	// the subscriber keeping up stays
+	b.Publish(WorkerRemoved, nil)
+	if got := pending(fast); !reflect.DeepEqual(got, []string{WorkerRemoved}) {
+		t.Errorf("fast subscriber events = %v, want %v", got, []string{WorkerRemoved})
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := NewBroker(10)
+	s := b.Subscribe(0)
+	b.Close()
+	if got := pending(s); !reflect.DeepEqual(got, []string{"closed"}) {
+		t.Errorf("events after the broker closed = %v, want the channel closed", got)
+	}
+	if got := pending(b.Subscribe(0)); !reflect.DeepEqual(got, []string{"closed"}) {
+		t.Errorf("subscription after the broker closed = %v, want the channel closed", got)
+	}
+	// publishing after Close reaches nobody
+	b.Publish(WorkerAdded, "node")
+	s.Close()
+}
+
+func TestConcurrent(t *testing.T) {
+	b := NewBroker(100)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				b.Publish(WorkerUpdated, j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				s := b.Subscribe(0)
+				var last uint64
+				for k := 0; k < 10; k++ {
+					select {
+					case event, ok := <-s.C:
+						if !ok {
+							// dropped for lagging behind
+							break
+						}
+						if event.Id <= last {
+							t.Errorf("event id %d after %d", event.Id, last)
+						}
+						last = event.Id
+					default:
+					}
+				}
+				s.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	b.Close()
+
+	// the ids are increasing in the buffer
+	for i := 1; i < len(b.buffer); i++ {
+		if b.buffer[i].Id != b.buffer[i-1].Id+1 {
+			t.Fatalf("buffer ids %d then %d", b.buffer[i-1].Id, b.buffer[i].Id)
+		}
+	}
+}
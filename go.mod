@@ -8,8 +8,11 @@ require (
 	github.com/getsentry/raven-go v0.2.0
 	github.com/go-sql-driver/mysql v1.4.1
 	github.com/iresty/ingress-controller v0.0.0-20200607064931-f2a806c0e5af // indirect
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/prometheus/client_golang v1.1.0
 	github.com/shiena/ansicolor v0.0.0-20151119151921-a422bbe96644 // indirect
 	github.com/tidwall/gjson v1.3.5
+	golang.org/x/net v0.0.0-20191004110552-13f9640d40b9
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d // indirect
 	golang.org/x/time v0.0.0-20200416051211-89c76fbcd5d1 // indirect
 	k8s.io/api v0.0.0-20190819141258-3544db3b9e44
@@ -0,0 +1,52 @@
+package health
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	shuttingDown int32
+
+	lock   sync.Mutex
+	checks = map[string]func() error{}
+)
+
+// AddReadinessCheck adds the check name of /readyz
+func AddReadinessCheck(name string, check func() error) {
+	lock.Lock()
+	defer lock.Unlock()
+	checks[name] = check
+}
+
+// ShutDown makes the replica not ready, load balancers stop sending it requests
+func ShutDown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+// Ready returns the failures of the readiness checks by name, none when ready
+func Ready() map[string]string {
+	failures := map[string]string{}
+	if atomic.LoadInt32(&shuttingDown) == 1 {
+		failures["shutdown"] = "shutting down"
+		return failures
+	}
+
+	lock.Lock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	lock.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		lock.Lock()
+		check := checks[name]
+		lock.Unlock()
+		if err := check(); err != nil {
+			failures[name] = err.Error()
+		}
+	}
+	return failures
+}
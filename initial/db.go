@@ -1,6 +1,7 @@
 package initial
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/astaxie/beego"
@@ -82,11 +83,12 @@ func ensureDatabase() error {
 		return err
 
 	}
+	// create missing tables and add missing columns of existing ones
+	err = orm.RunSyncdb("default", false, true)
+	if err != nil {
+		return err
+	}
 	if needInit {
-		err = orm.RunSyncdb("default", false, true)
-		if err != nil {
-			return err
-		}
 		for _, insertSql := range InitialData {
 			_, err = orm.NewOrm().Raw(insertSql).Exec()
 			if err != nil {
@@ -102,3 +104,25 @@ func addLocation(dbURL string) string {
 	// https://stackoverflow.com/questions/30074492/what-is-the-difference-between-utf8mb4-and-utf8-charsets-in-mysql
 	return fmt.Sprintf("%s?charset=utf8mb4&loc=%s", dbURL, beego.AppConfig.DefaultString("DBLoc", "Asia%2FShanghai"))
 }
+
+// PingDb checks the connection to the database
+func PingDb() error {
+	db, err := orm.GetDB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+func CloseDb() {
+	db, err := orm.GetDB()
+	if err != nil {
+		logs.Error("failed to get database: %s", err.Error())
+		return
+	}
+	if err := db.Close(); err != nil {
+		logs.Error("failed to close database: %s", err.Error())
+	}
+}
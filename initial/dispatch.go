@@ -0,0 +1,190 @@
+package initial
+
+import (
+	"fmt"
+	"github.com/astaxie/beego"
+	"node-controller/common"
+	"node-controller/models"
+	"node-controller/util/logs"
+	"strings"
+	"time"
+)
+
+// timerTolerance absorbs the drift of the one minute timer when comparing intervals
+const timerTolerance = 30 * time.Second
+
+var severityRank = map[string]int{
+	models.SeverityInfo:     1,
+	models.SeverityWarning:  2,
+	models.SeverityCritical: 3,
+}
+
+// sendPolicy is how the timer batches, repeats and escalates the alerts
+type sendPolicy struct {
+	// repeat are the intervals between notifications of an unacknowledged record, the last one is kept
+	repeat []time.Duration
+	// groupBy are the keys grouping records into one digest:
+	// type, severity, host, time (window of the start time) or label:<name>
+	groupBy       []string
+	window        time.Duration
+	escalateAfter time.Duration
+	escalateTo    []string
+}
+
+func loadSendPolicy() sendPolicy {
+	policy := sendPolicy{
+		groupBy:       common.SplitList(beego.AppConfig.DefaultString("AlertGroupBy", "type,label:topology.kubernetes.io/zone,time")),
+		window:        time.Duration(beego.AppConfig.DefaultInt("AlertGroupWindow", 300)) * time.Second,
+		escalateAfter: time.Duration(beego.AppConfig.DefaultInt("AlertEscalateAfter", 1800)) * time.Second,
+		escalateTo:    common.SplitList(beego.AppConfig.String("AlertEscalateReceivers")),
+	}
+	for _, item := range common.SplitList(beego.AppConfig.DefaultString("AlertRepeatIntervals", "5m,15m,1h")) {
+		interval, err := time.ParseDuration(item)
+		if err != nil || interval <= 0 {
+			logs.Error("invalid AlertRepeatIntervals item %q", item)
+			continue
+		}
+		policy.repeat = append(policy.repeat, interval)
+	}
+	if policy.window <= 0 {
+		policy.window = time.Minute
+	}
+	return policy
+}
+
+// due reports whether record has to be sent at now
+func (p sendPolicy) due(record *models.Record, now time.Time) bool {
+	if record.NotifyCount == 0 || record.LastNotifyTime == nil {
+		return true
+	}
+	if len(p.repeat) == 0 {
+		return false
+	}
+	i := int(record.NotifyCount) - 1
+	if i >= len(p.repeat) {
+		i = len(p.repeat) - 1
+	}
+	return now.Sub(*record.LastNotifyTime)+timerTolerance >= p.repeat[i]
+}
+
+// escalationDue reports whether record stayed unacknowledged long enough to be escalated
+func (p sendPolicy) escalationDue(record *models.Record, now time.Time) bool {
+	if len(p.escalateTo) == 0 || p.escalateAfter <= 0 || record.EscalateTime != nil || record.NotifyCount == 0 {
+		return false
+	}
+	return now.Sub(recordStart(record)) >= p.escalateAfter
+}
+
+// group turns records into digest messages, one per group, and returns the ids of the records sent
+func (p sendPolicy) group(records []models.Record) ([]common.Ready2Send, []int64) {
+	keys := make([]string, 0)
+	groups := make(map[string][]models.Record)
+	titles := make(map[string]string)
+	for _, record := range records {
+		values := make([]string, 0, len(p.groupBy))
+		for _, by := range p.groupBy {
+			values = append(values, p.groupValue(&record, by))
+		}
+		key := strings.Join(values, "|")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+			titles[key] = strings.Join(common.SplitList(strings.Join(values, ",")), " ")
+		}
+		groups[key] = append(groups[key], record)
+	}
+
+	ready2Send := make([]common.Ready2Send, 0, len(keys))
+	ids := make([]int64, 0, len(records))
+	for _, key := range keys {
+		item := digest(groups[key], titles[key])
+		for _, record := range groups[key] {
+			item.Ids = append(item.Ids, record.Id)
+		}
+		ready2Send = append(ready2Send, item)
+		ids = append(ids, item.Ids...)
+	}
+	return ready2Send, ids
+}
+
+func (p sendPolicy) groupValue(record *models.Record, by string) string {
+	switch {
+	case by == "type":
+		return record.Type
+	case by == "severity":
+		return record.Severity
+	case by == "host":
+		return record.HostName
+	case by == "time":
+		return recordStart(record).Truncate(p.window).Format("15:04")
+	case strings.HasPrefix(by, "label:"):
+		return record.LabelMap()[strings.TrimPrefix(by, "label:")]
+	default:
+		return ""
+	}
+}
+
+// digest is the message of a group of records, a group of one is sent as before
+func digest(records []models.Record, title string) common.Ready2Send {
+	first := records[0]
+	item := common.Ready2Send{
+		Id:       first.Id,
+		HostName: first.HostName,
+		Title:    first.Subject(),
+		Start:    recordStart(&first).Format("2006-01-02 15:04:05"),
+		User:     first.User,
+		Alerts:   first.Description,
+		Type:     first.Type,
+		Severity: first.Severity,
+		Labels:   first.LabelMap(),
+	}
+	if len(records) == 1 {
+		return item
+	}
+
+	users := common.SplitList(first.User)
+	earliest := recordStart(&first)
+	lines := make([]string, 0, len(records))
+	for i := range records {
+		record := &records[i]
+		lines = append(lines, "- "+record.Subject()+": "+record.Description)
+		for _, user := range common.SplitList(record.User) {
+			if !common.Contains(users, user) {
+				users = append(users, user)
+			}
+		}
+		if record.HostName != item.HostName {
+			item.HostName = ""
+		}
+		if record.Type != item.Type {
+			item.Type = ""
+		}
+		if severityRank[record.Severity] > severityRank[item.Severity] {
+			item.Severity = record.Severity
+		}
+		// only the labels shared by the whole group route the digest
+		labels := record.LabelMap()
+		for key, value := range item.Labels {
+			if labels[key] != value {
+				delete(item.Labels, key)
+			}
+		}
+		if start := recordStart(record); start.Before(earliest) {
+			earliest = start
+		}
+	}
+	item.Start = earliest.Format("2006-01-02 15:04:05")
+	item.Title = fmt.Sprintf("%d个告警 %s", len(records), title)
+	item.User = strings.Join(users, ",")
+	item.Alerts = "\n" + strings.Join(lines, "\n")
+	return item
+}
+
+func recordStart(record *models.Record) time.Time {
+	if record.StartTime != nil {
+		return *record.StartTime
+	}
+	if record.CreateTime != nil {
+		return *record.CreateTime
+	}
+	return time.Now()
+}
@@ -0,0 +1,132 @@
+package initial
+
+import (
+	"node-controller/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSendPolicyDue(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+	policy := sendPolicy{repeat: []time.Duration{5 * time.Minute, 15 * time.Minute, time.Hour}}
+
+	tests := []struct {
+		name   string
+		policy sendPolicy
+		record models.Record
+		want   bool
+	}{
+		{"never sent", policy, models.Record{}, true},
+		{"sent without time", policy, models.Record{NotifyCount: 1}, true},
+		{"no repeat", sendPolicy{}, models.Record{NotifyCount: 1, LastNotifyTime: ago(24 * time.Hour)}, false},
+		{"first interval not elapsed", policy, models.Record{NotifyCount: 1, LastNotifyTime: ago(4 * time.Minute)}, false},
+		{"first interval elapsed", policy, models.Record{NotifyCount: 1, LastNotifyTime: ago(5 * time.Minute)}, true},
+		{"timer drift tolerated", policy, models.Record{NotifyCount: 1, LastNotifyTime: ago(5*time.Minute - 20*time.Second)}, true},
+		{"second interval not elapsed", policy, models.Record{NotifyCount: 2, LastNotifyTime: ago(10 * time.Minute)}, false},
+		{"second interval elapsed", policy, models.Record{NotifyCount: 2, LastNotifyTime: ago(15 * time.Minute)}, true},
+		{"last interval kept", policy, models.Record{NotifyCount: 9, LastNotifyTime: ago(30 * time.Minute)}, false},
+		{"last interval elapsed", policy, models.Record{NotifyCount: 9, LastNotifyTime: ago(time.Hour)}, true},
+	}
+	for _, test := range tests {
+		if got := test.policy.due(&test.record, now); got != test.want {
+			t.Errorf("%s: due() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSendPolicyGroup(t *testing.T) {
+	start := time.Date(2026, 10, 14, 12, 1, 0, 0, time.UTC)
+	later := start.Add(10 * time.Minute)
+	record := func(id int64, host, recordType, severity, user, zone string, startTime time.Time) models.Record {
+		r := models.Record{Id: id, HostName: host, Type: recordType, Severity: severity, User: user, StartTime: &startTime}
+		r.SetLabels(map[string]string{"topology.kubernetes.io/zone": zone})
+		return r
+	}
+	records := []models.Record{
+		record(1, "node-1", models.RecordTypeNodeNotReady, models.SeverityWarning, "a", "z1", start),
+		record(2, "node-2", models.RecordTypeNodeNotReady, models.SeverityCritical, "b,a", "z1", start),
+		record(3, "node-3", models.RecordTypeNodeNotReady, models.SeverityWarning, "", "z2", start),
+		record(4, "node-1", models.RecordTypeNodeLost, models.SeverityCritical, "", "z1", later),
+	}
+
+	tests := []struct {
+		name    string
+		groupBy []string
+		// wantIds are the ids of each message
+		wantIds      [][]int64
+		wantHosts    []string
+		wantSeverity []string
+		wantUsers    []string
+	}{
+		{
+			name:         "no grouping key",
+			groupBy:      nil,
+			wantIds:      [][]int64{{1, 2, 3, 4}},
+			wantHosts:    []string{""},
+			wantSeverity: []string{models.SeverityCritical},
+			wantUsers:    []string{"a,b"},
+		},
+		{
+			name:         "by type and zone",
+			groupBy:      []string{"type", "label:topology.kubernetes.io/zone"},
+			wantIds:      [][]int64{{1, 2}, {3}, {4}},
+			wantHosts:    []string{"", "node-3", "node-1"},
+			wantSeverity: []string{models.SeverityCritical, models.SeverityWarning, models.SeverityCritical},
+			wantUsers:    []string{"a,b", "", ""},
+		},
+		{
+			name:         "by time window",
+			groupBy:      []string{"time"},
+			wantIds:      [][]int64{{1, 2, 3}, {4}},
+			wantHosts:    []string{"", "node-1"},
+			wantSeverity: []string{models.SeverityCritical, models.SeverityCritical},
+			wantUsers:    []string{"a,b", ""},
+		},
+		{
+			name:         "by host",
+			groupBy:      []string{"host"},
+			wantIds:      [][]int64{{1, 4}, {2}, {3}},
+			wantHosts:    []string{"node-1", "node-2", "node-3"},
+			wantSeverity: []string{models.SeverityCritical, models.SeverityCritical, models.SeverityWarning},
+			wantUsers:    []string{"a", "b,a", ""},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := sendPolicy{groupBy: test.groupBy, window: 5 * time.Minute}
+			messages, ids := policy.group(records)
+			wantIds := make([]int64, 0, len(records))
+			for _, messageIds := range test.wantIds {
+				wantIds = append(wantIds, messageIds...)
+			}
+			if !reflect.DeepEqual(ids, wantIds) {
+				t.Errorf("ids = %v, want %v", ids, wantIds)
+			}
+			if len(messages) != len(test.wantIds) {
+				t.Fatalf("%d messages, want %d", len(messages), len(test.wantIds))
+			}
+			for i, message := range messages {
+				if !reflect.DeepEqual(message.Ids, test.wantIds[i]) {
+					t.Errorf("message %d: ids = %v, want %v", i, message.Ids, test.wantIds[i])
+				}
+				if message.Id != test.wantIds[i][0] {
+					t.Errorf("message %d: id = %d, want the first record %d", i, message.Id, test.wantIds[i][0])
+				}
+				if message.HostName != test.wantHosts[i] {
+					t.Errorf("message %d: host = %q, want %q", i, message.HostName, test.wantHosts[i])
+				}
+				if message.Severity != test.wantSeverity[i] {
+					t.Errorf("message %d: severity = %q, want %q", i, message.Severity, test.wantSeverity[i])
+				}
+				if message.User != test.wantUsers[i] {
+					t.Errorf("message %d: users = %q, want %q", i, message.User, test.wantUsers[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package initial
+
+import (
+	"github.com/astaxie/beego"
+	"node-controller/conf"
+	"node-controller/models"
+	"node-controller/util/logs"
+	"time"
+)
+
+// silencer tells which alerts are muted in one round of the timer
+type silencer struct {
+	silences []models.Silence
+}
+
+func newSilencer(now time.Time) *silencer {
+	silences, err := models.SilenceMode.List(true, now)
+	if err != nil {
+		logs.Error("Query Silence table error, ", err)
+	}
+	return &silencer{silences: silences}
+}
+
+// silenced returns why the alerts of hostName are muted, empty when they are not
+func (s *silencer) silenced(hostName string, labels map[string]string) string {
+	for i := range s.silences {
+		if s.silences[i].Matches(hostName, labels) {
+			return "silence " + s.silences[i].CreatedBy + ": " + s.silences[i].Comment
+		}
+	}
+	return autoSilenced(hostName)
+}
+
+// autoSilenced mutes nodes under maintenance: cordoned nodes when AutoSilenceCordoned
+// is set, and nodes carrying the AutoSilenceAnnotation with a value other than "false".
+func autoSilenced(hostName string) string {
+	cordoned := beego.AppConfig.DefaultBool("AutoSilenceCordoned", false)
+	annotation := beego.AppConfig.String("AutoSilenceAnnotation")
+	if !cordoned && annotation == "" {
+		return ""
+	}
+	node, err := conf.WorkerInformer.Lister().Get(hostName)
+	if err != nil {
+		return ""
+	}
+	if cordoned && node.Spec.Unschedulable {
+		return "node is cordoned"
+	}
+	if value, ok := node.Annotations[annotation]; annotation != "" && ok && value != "false" {
+		return "node is annotated " + annotation
+	}
+	return ""
+}
@@ -1,63 +1,135 @@
 package initial
 
 import (
-	"github.com/astaxie/beego"
 	"node-controller/common"
+	"node-controller/leader"
 	"node-controller/models"
+	"node-controller/notifier"
 	"node-controller/util/logs"
 	"runtime"
+	"sync"
 	"time"
 )
 
+// sending keeps the round on shutdown from overlapping the one of the timer
+var sending sync.Mutex
+
 func init() {
 	go func() {
 		for {
 			current := time.Now()
 			time.Sleep(time.Duration(60-current.Second()) * time.Second)
-			now := time.Now().Format("2006-01-02 15:04:05")
-			go func() {
-				defer func() {
-					if e := recover(); e != nil {
-						buf := make([]byte, 16384)
-						buf = buf[:runtime.Stack(buf, false)]
-						logs.Error("Panic in timer:%v\n%s", e, buf)
-					}
-				}()
-				var info []models.Record
-				info, err := models.RecordMode.List()
-				if err != nil {
-					logs.Error("Query Record table error, ", err)
-				}
-				if len(info) == 0 {
-					logs.Info("No alter need to be handler!")
-					return
-				}
-
-				logs.Info("Alerts to send:%v", info)
-
-				ready2Send := make([]common.Ready2Send, 0)
-				for _, v := range info {
-					singleInfo := common.Ready2Send{
-						Title:  v.HostName,
-						Start:  v.CreateTime.Format("2006-01-02 15:04:05"),
-						User:   v.User,
-						Alerts: v.Description,
-					}
-					ready2Send = append(ready2Send, singleInfo)
-				}
-				alertUrl := beego.AppConfig.String("AlertUrl")
-				common.Send2Hook(ready2Send, now, "alter", alertUrl)
-				//TODO: Recover msg to send
-				//common.Lock.Lock()
-				//recover2send := common.Recover2Send
-				//common.Recover2Send = map[string]map[[2]int64]*common.Ready2Send{
-				//	"LANXIN": map[[2]int64]*common.Ready2Send{},
-				//	//"HOOK":   map[[2]int64]*common.Ready2Send{},
-				//}
-				//common.Lock.Unlock()
-				//logs.Alertloger.Info("Recoveries to send:%v", recover2send)
-				//RecoverSender(recover2send, now)
-			}()
+			go SendAlerts()
+		}
+	}()
+}
+
+// SendAlerts sends the queued recoveries and the alerts due, it is run every minute and
+// once more on shutdown
+func SendAlerts() {
+	sending.Lock()
+	defer sending.Unlock()
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 16384)
+			buf = buf[:runtime.Stack(buf, false)]
+			logs.Error("Panic in timer:%v\n%s", e, buf)
 		}
 	}()
+	// only the leader sends, the records are shared by the replicas
+	if !leader.IsLeader() {
+		return
+	}
+	silencer := newSilencer(time.Now())
+	if recovers := common.TakeRecovers(); len(recovers) > 0 {
+		recover2send := make([]common.Ready2Send, 0, len(recovers))
+		// silenced recoveries stay queued and are sent once the silence ends
+		requeue := make([]common.Ready2Send, 0)
+		for _, v := range recovers {
+			if reason := silencer.silenced(v.HostName, v.Labels); reason != "" {
+				logs.Info("Recovery of %s silenced, %s", v.HostName, reason)
+				requeue = append(requeue, v)
+				continue
+			}
+			recover2send = append(recover2send, v)
+		}
+		if len(recover2send) > 0 {
+			logs.Info("Recoveries to send:%v", recover2send)
+			// the recoveries held back by the routes or not delivered are sent again next time
+			delivered := notifier.Send2Hook(recover2send, "recover")
+			requeue = append(requeue, undelivered(recover2send, delivered)...)
+		}
+		common.RequeueRecovers(requeue)
+	}
+
+	var info []models.Record
+	info, err := models.RecordMode.ListPending()
+	if err != nil {
+		logs.Error("Query Record table error, ", err)
+	}
+	if len(info) == 0 {
+		logs.Info("No alter need to be handler!")
+		return
+	}
+
+	now := time.Now()
+	policy := loadSendPolicy()
+	due := make([]models.Record, 0)
+	overdue := make([]models.Record, 0)
+	for _, v := range info {
+		// silenced records stay stored and are sent once the silence ends
+		if reason := silencer.silenced(v.HostName, v.LabelMap()); reason != "" {
+			logs.Info("Record %d of %s silenced, %s", v.Id, v.HostName, reason)
+			continue
+		}
+		if policy.due(&v, now) {
+			due = append(due, v)
+		}
+		if policy.escalationDue(&v, now) {
+			overdue = append(overdue, v)
+		}
+	}
+
+	if len(due) > 0 {
+		ready2Send, _ := policy.group(due)
+		logs.Info("Alerts to send:%v", ready2Send)
+		// the alerts held back by the routes or not delivered are sent again next time
+		ids := notifier.Send2Hook(ready2Send, "alter")
+		if err := models.RecordMode.MarkNotified(ids, now); err != nil {
+			logs.Error("Update Record notification error, ", err)
+		}
+	}
+	if len(overdue) > 0 {
+		ready2Send, ids := policy.group(overdue)
+		for i := range ready2Send {
+			ready2Send[i].Title = "[升级] " + ready2Send[i].Title
+		}
+		logs.Info("Alerts to escalate to %v:%v", policy.escalateTo, ready2Send)
+		notifier.Send2Receivers(ready2Send, "alter", policy.escalateTo)
+		if err := models.RecordMode.MarkEscalated(ids, now); err != nil {
+			logs.Error("Update Record escalation error, ", err)
+		}
+	}
+}
+
+// undelivered returns the messages of msgs whose records are not all in delivered
+func undelivered(msgs []common.Ready2Send, delivered []int64) []common.Ready2Send {
+	sent := make(map[int64]bool, len(delivered))
+	for _, id := range delivered {
+		sent[id] = true
+	}
+	left := make([]common.Ready2Send, 0)
+	for _, msg := range msgs {
+		ids := msg.Ids
+		if len(ids) == 0 {
+			ids = []int64{msg.Id}
+		}
+		for _, id := range ids {
+			if !sent[id] {
+				left = append(left, msg)
+				break
+			}
+		}
+	}
+	return left
 }
@@ -0,0 +1,43 @@
+package initial
+
+import (
+	"node-controller/common"
+	"reflect"
+	"testing"
+)
+
+func TestUndelivered(t *testing.T) {
+	msgs := []common.Ready2Send{{Id: 1}, {Id: 2}, {Id: 3, Ids: []int64{3, 4}}}
+	tests := []struct {
+		name      string
+		delivered []int64
+		want      []int64
+	}{
+		{"all delivered", []int64{1, 2, 3, 4}, []int64{}},
+		{"none delivered", nil, []int64{1, 2, 3}},
+		{"held back", []int64{1, 3, 4}, []int64{2}},
+		{"grouped message partly delivered", []int64{1, 2, 3}, []int64{3}},
+	}
+	for _, test := range tests {
+		got := make([]int64, 0)
+		for _, msg := range undelivered(msgs, test.delivered) {
+			got = append(got, msg.Id)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: undelivered() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRequeueRecovers(t *testing.T) {
+	common.TakeRecovers()
+	common.AddRecover(common.Ready2Send{Id: 3})
+	common.RequeueRecovers([]common.Ready2Send{{Id: 1}, {Id: 2}})
+	got := make([]int64, 0)
+	for _, msg := range common.TakeRecovers() {
+		got = append(got, msg.Id)
+	}
+	if want := []int64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recoveries = %v, want %v", got, want)
+	}
+}
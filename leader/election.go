@@ -0,0 +1,121 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"github.com/astaxie/beego"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"node-controller/util/logs"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	leading int32
+
+	lock      sync.Mutex
+	onStarted []func()
+)
+
+// IsLeader tells whether this replica runs the reconcilers and sends the alerts. Every
+// replica serves the api from its own caches.
+func IsLeader() bool {
+	return atomic.LoadInt32(&leading) == 1
+}
+
+// OnStartedLeading registers f to run each time this replica becomes the leader, the
+// events it ignored as a follower have to be handled again
+func OnStartedLeading(f func()) {
+	lock.Lock()
+	defer lock.Unlock()
+	onStarted = append(onStarted, f)
+}
+
+func setLeading(isLeader bool) {
+	if !isLeader {
+		atomic.StoreInt32(&leading, 0)
+		return
+	}
+	atomic.StoreInt32(&leading, 1)
+	lock.Lock()
+	callbacks := append([]func(){}, onStarted...)
+	lock.Unlock()
+	for _, f := range callbacks {
+		go f()
+	}
+}
+
+func duration(key string, seconds int) time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt(key, seconds)) * time.Second
+}
+
+// Run takes part in the election of the leader through a Lease until stop is closed.
+// Without LeaderElection this replica leads.
+func Run(kubeClient kubernetes.Interface, stop <-chan struct{}) error {
+	if !beego.AppConfig.DefaultBool("LeaderElection", false) {
+		setLeading(true)
+		return nil
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	identity := hostname + "_" + rand.String(5)
+	namespace := beego.AppConfig.DefaultString("LeaderElectionNamespace", os.Getenv("POD_NAMESPACE"))
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	name := beego.AppConfig.DefaultString("LeaderElectionLeaseName", "node-controller")
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Client:     kubeClient.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   duration("LeaderElectionLeaseDuration", 15),
+		RenewDeadline:   duration("LeaderElectionRenewDeadline", 10),
+		RetryPeriod:     duration("LeaderElectionRetryPeriod", 2),
+		ReleaseOnCancel: true,
+		Name:            name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				logs.Info("%s started leading", identity)
+				setLeading(true)
+			},
+			OnStoppedLeading: func() {
+				logs.Info("%s stopped leading", identity)
+				setLeading(false)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					logs.Info("leader is %s", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create leader elector: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	// Run returns when the leadership is lost, this replica stands again as a follower
+	go func() {
+		for ctx.Err() == nil {
+			elector.Run(ctx)
+		}
+	}()
+	logs.Info("leader election of %s/%s started as %s", namespace, name, identity)
+	return nil
+}
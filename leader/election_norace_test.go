@@ -0,0 +1,98 @@
+//go:build !race
+// +build !race
+
+// The renewal of the lease by client-go outlives the cancellation of the election, the race
+// detector reports it once stopped, so the election runs without it.
+
+package leader
+
+import (
+	"github.com/astaxie/beego"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setConfig sets the configuration keys of config until the returned func is called
+func setConfig(t *testing.T, config map[string]string) func() {
+	saved := map[string]string{}
+	for key, value := range config {
+		saved[key] = beego.AppConfig.String(key)
+		if err := beego.AppConfig.Set(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for key, value := range saved {
+			beego.AppConfig.Set(key, value)
+		}
+	}
+}
+
+func TestRunElection(t *testing.T) {
+	started, restore := startedLeading()
+	defer restore()
+	defer setConfig(t, map[string]string{
+		"LeaderElection":              "true",
+		"LeaderElectionNamespace":     "kube-system",
+		"LeaderElectionLeaseName":     "test-controller",
+		"LeaderElectionLeaseDuration": "3",
+		"LeaderElectionRenewDeadline": "2",
+		"LeaderElectionRetryPeriod":   "1",
+	})()
+
+	// another replica holds the lease and stops renewing it
+	other := "other_abcde"
+	renewed := metav1.NewMicroTime(time.Now())
+	leaseDuration := int32(3)
+	client := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "test-controller"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &other,
+			LeaseDurationSeconds: &leaseDuration,
+			AcquireTime:          &renewed,
+			RenewTime:            &renewed,
+		},
+	})
+	holder := func() string {
+		lease, err := client.CoordinationV1().Leases("kube-system").Get("test-controller", metav1.GetOptions{})
+		if err != nil || lease.Spec.HolderIdentity == nil {
+			return ""
+		}
+		return *lease.Spec.HolderIdentity
+	}
+
+	stop := make(chan struct{})
+	if err := Run(client, stop); err != nil {
+		close(stop)
+		t.Fatalf("Run() = %v", err)
+	}
+	time.Sleep(time.Second)
+	if IsLeader() {
+		t.Errorf("leading while the lease of %s is valid", other)
+	}
+
+	// the lease is taken once it is not renewed for the lease duration
+	waitStarted(t, started, 10*time.Second)
+	if !IsLeader() {
+		t.Errorf("IsLeader() = false after started leading")
+	}
+	hostname, _ := os.Hostname()
+	if got := holder(); !strings.HasPrefix(got, hostname+"_") {
+		t.Errorf("lease holder = %q, want this replica %s_*", got, hostname)
+	}
+
+	// the lease is released on stop
+	close(stop)
+	err := wait.Poll(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return !IsLeader() && holder() == "", nil
+	})
+	if err != nil {
+		t.Errorf("lease held by %q after stop, leading %v", holder(), IsLeader())
+	}
+}
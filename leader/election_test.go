@@ -0,0 +1,77 @@
+package leader
+
+import (
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+// startedLeading registers a callback for the test and returns the channel it signals on,
+// the callbacks registered before are restored by the returned func
+func startedLeading() (chan struct{}, func()) {
+	lock.Lock()
+	saved := onStarted
+	onStarted = nil
+	lock.Unlock()
+
+	started := make(chan struct{}, 10)
+	OnStartedLeading(func() { started <- struct{}{} })
+	return started, func() {
+		lock.Lock()
+		onStarted = saved
+		lock.Unlock()
+		setLeading(false)
+	}
+}
+
+func waitStarted(t *testing.T, started chan struct{}, timeout time.Duration) {
+	select {
+	case <-started:
+	case <-time.After(timeout):
+		t.Fatal("OnStartedLeading callback not run")
+	}
+}
+
+func TestSetLeading(t *testing.T) {
+	started, restore := startedLeading()
+	defer restore()
+
+	steps := []struct {
+		leading     bool
+		wantStarted bool
+	}{
+		{true, true},
+		{false, false},
+		{false, false},
+		{true, true},
+	}
+	for i, step := range steps {
+		setLeading(step.leading)
+		if IsLeader() != step.leading {
+			t.Errorf("step %d: IsLeader() = %v, want %v", i, IsLeader(), step.leading)
+		}
+		if step.wantStarted {
+			waitStarted(t, started, time.Second)
+		}
+		select {
+		case <-started:
+			t.Errorf("step %d: OnStartedLeading callback run again", i)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestRunWithoutElection(t *testing.T) {
+	started, restore := startedLeading()
+	defer restore()
+	stop := make(chan struct{})
+	defer close(stop)
+
+	if err := Run(fake.NewSimpleClientset(), stop); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if !IsLeader() {
+		t.Errorf("replica not leading without election")
+	}
+	waitStarted(t, started, time.Second)
+}
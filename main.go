@@ -1,19 +1,29 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/astaxie/beego"
 	"node-controller/conf"
 	"node-controller/controller"
+	"node-controller/events"
 	nodeInformer "node-controller/generated/informers/externalversions"
+	"node-controller/health"
 	"node-controller/initial"
+	"node-controller/leader"
 	_ "node-controller/models"
 	_ "node-controller/routers"
+	"node-controller/util/logs"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 func main() {
 	flag.Parse()
+	// init informer
+	conf.InitInformer()
 	nodeClientSet := conf.InitVirtulMachineClient()
 	kubeClientSet := conf.GetKubeClient()
 	sharedInformerFactory := nodeInformer.NewSharedInformerFactory(nodeClientSet, 0)
@@ -26,15 +36,16 @@ func main() {
 		Stop:                      stop,
 	}
 
-	//c.PodListener()
+	if beego.AppConfig.DefaultBool("PodAlertEnabled", false) {
+		c.PodListener()
+	}
 	c.WorkerListener()
-	go c.CoreSharedInformerFactory.Start(stop)
-
 	c.VirtulMachineListener()
-	go func() {
-		time.Sleep(time.Duration(5) * time.Second)
-		c.SharedInformerFactory.Start(stop)
-	}()
+	c.Run()
+	if err := leader.Run(kubeClientSet, stop); err != nil {
+		logs.Error("failed to start leader election: %s", err.Error())
+		os.Exit(1)
+	}
 
 	if beego.BConfig.RunMode == "dev" {
 		beego.BConfig.WebConfig.DirectoryIndex = true
@@ -42,6 +53,50 @@ func main() {
 	}
 
 	initial.InitDb()
+	health.AddReadinessCheck("informers", c.Synced)
+	health.AddReadinessCheck("database", initial.PingDb)
+
+	done := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		sig := <-signals
+		logs.Info("received %s, shutting down", sig)
+		shutdown(c)
+		close(done)
+	}()
 
 	beego.Run()
+	<-done
+}
+
+// shutdown stops serving, drains the workqueues while this replica still leads, sends the
+// alerts pending, then stops the informers and the leader election and closes the database
+func shutdown(c *controller.VirtulMachineController) {
+	health.ShutDown()
+	// the load balancers take some time to see the replica not ready, requests keep coming meanwhile
+	time.Sleep(time.Duration(beego.AppConfig.DefaultInt("ShutdownDelay", 5)) * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(beego.AppConfig.DefaultInt("ShutdownTimeout", 30))*time.Second)
+	defer cancel()
+	// the event streams never end by themselves
+	events.Events.Close()
+	if err := beego.BeeApp.Server.Shutdown(ctx); err != nil {
+		logs.Error("failed to shut down the http server: %s", err.Error())
+	}
+	c.ShutDown(ctx)
+	sent := make(chan struct{})
+	go func() {
+		initial.SendAlerts()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-ctx.Done():
+		logs.Warning("alerts pending not sent: %s", ctx.Err().Error())
+	}
+	close(c.Stop)
+	initial.CloseDb()
+	logs.Info("shut down")
 }
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const TableNameAudit = "audit"
+
+type auditModel struct{}
+
+// Audit is a change made through the api, Result is empty when it succeeded
+type Audit struct {
+	Id         int64      `orm:"auto" json:"id,omitempty"`
+	User       string     `orm:"size(128)" json:"user"`
+	Action     string     `orm:"size(64)" json:"action"`
+	Resource   string     `orm:"size(256)" json:"resource"`
+	Detail     string     `orm:"null;type(text)" json:"detail,omitempty"`
+	Result     string     `orm:"null;size(1024)" json:"result,omitempty"`
+	CreateTime *time.Time `orm:"auto_now_add;type(datetime)" json:"createTime,omitempty"`
+}
+
+func (*Audit) TableName() string {
+	return TableNameAudit
+}
+
+// Add writes the audit of action by user on resource, detail is stored as json and
+// err, when not nil, as the result
+func (*auditModel) Add(user string, action string, resource string, detail interface{}, err error) error {
+	audit := &Audit{
+		User:     user,
+		Action:   action,
+		Resource: resource,
+	}
+	if detail != nil {
+		data, _ := json.Marshal(detail)
+		audit.Detail = string(data)
+	}
+	if err != nil {
+		audit.Result = err.Error()
+	}
+	_, err = Ormer().Insert(audit)
+
+	return err
+}
@@ -9,14 +9,18 @@ var (
 	globalOrm orm.Ormer
 	once      sync.Once
 
-	RecordMode *recordModel
+	RecordMode  *recordModel
+	SilenceMode *silenceModel
+	AuditMode   *auditModel
 )
 
 func init() {
-	orm.RegisterModel(new(Record))
+	orm.RegisterModel(new(Record), new(Silence), new(Audit))
 
 	// init models
 	RecordMode = &recordModel{}
+	SilenceMode = &silenceModel{}
+	AuditMode = &auditModel{}
 }
 
 // singleton init ormer ,only use for normal db operation
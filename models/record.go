@@ -1,6 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"github.com/astaxie/beego/orm"
+	"net/http"
+	erroresult "node-controller/models/response/errors"
 	"node-controller/util/logs"
 	"time"
 )
@@ -10,35 +14,154 @@ type RecordStatus int32
 const (
 	RecordAlerted    RecordStatus = 1
 	RecordTobeAltert RecordStatus = 0
+	RecordResolved   RecordStatus = 2
+	RecordAcked      RecordStatus = 3
 
 	TableNameRecord = "record"
 )
 
+// record severities
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// record types
+const (
+	RecordTypeNodeNotReady       = "NodeNotReady"
+	RecordTypeNodeLost           = "NodeLost"
+	RecordTypeNodeDecommissioned = "NodeDecommissioned"
+	// RecordTypeVMDrainTimeout is a deleted VirtulMachine whose node keeps pods after VMDrainTimeout
+	RecordTypeVMDrainTimeout = "VMDrainTimeout"
+
+	RecordTypeNodeMemoryPressure     = "NodeMemoryPressure"
+	RecordTypeNodeDiskPressure       = "NodeDiskPressure"
+	RecordTypeNodePIDPressure        = "NodePIDPressure"
+	RecordTypeNodeNetworkUnavailable = "NodeNetworkUnavailable"
+	RecordTypeNodeUnreachable        = "NodeUnreachable"
+	RecordTypeNodeNotReadyTaint      = "NodeNotReadyTaint"
+	RecordTypeNodeHeartbeatStale     = "NodeHeartbeatStale"
+
+	RecordTypePodCrashLoopBackOff = "PodCrashLoopBackOff"
+	RecordTypePodOOMKilled        = "PodOOMKilled"
+	RecordTypePodImagePullBackOff = "PodImagePullBackOff"
+	RecordTypePodRestartSpike     = "PodRestartSpike"
+	RecordTypePodPending          = "PodPending"
+)
+
 type recordModel struct{}
 
+// Record is an alert. Namespace, PodName and Container are set on the records of pod alerts,
+// HostName is then the node of the pod. NotifyCount and LastNotifyTime drive the re-notification backoff.
 type Record struct {
-	Id          int64        `orm:"auto" json:"id,omitempty"`
-	User        string       `orm:"null;size(128)" json:"user,omitempty"`
-	HostName    string       `orm:"null;size(128)" json:"hostName,omitempty"`
-	Description string       `orm:"null;size(512)" json:"description,omitempty"`
-	Status      RecordStatus `orm:"default(0)" json:"status"`
-	CreateTime  *time.Time   `orm:"auto_now_add;type(datetime)" json:"createTime,omitempty"`
-	UpdateTime  *time.Time   `orm:"auto_now;type(datetime)" json:"updateTime,omitempty"`
+	Id             int64        `orm:"auto" json:"id,omitempty"`
+	User           string       `orm:"null;size(128)" json:"user,omitempty"`
+	HostName       string       `orm:"null;size(128)" json:"hostName,omitempty"`
+	Namespace      string       `orm:"null;size(128)" json:"namespace,omitempty"`
+	PodName        string       `orm:"null;size(256)" json:"podName,omitempty"`
+	Container      string       `orm:"null;size(128)" json:"container,omitempty"`
+	Type           string       `orm:"null;size(64)" json:"type,omitempty"`
+	Severity       string       `orm:"null;size(32)" json:"severity,omitempty"`
+	Labels         string       `orm:"null;type(text)" json:"labels,omitempty"`
+	Description    string       `orm:"null;size(512)" json:"description,omitempty"`
+	Reason         string       `orm:"null;size(128)" json:"reason,omitempty"`
+	Message        string       `orm:"null;size(1024)" json:"message,omitempty"`
+	StartTime      *time.Time   `orm:"null;type(datetime)" json:"startTime,omitempty"`
+	ResolveTime    *time.Time   `orm:"null;type(datetime)" json:"resolveTime,omitempty"`
+	Duration       int64        `orm:"default(0)" json:"duration"`
+	AckUser        string       `orm:"null;size(128)" json:"ackUser,omitempty"`
+	AckComment     string       `orm:"null;size(512)" json:"ackComment,omitempty"`
+	AckTime        *time.Time   `orm:"null;type(datetime)" json:"ackTime,omitempty"`
+	NotifyCount    int64        `orm:"default(0)" json:"notifyCount"`
+	LastNotifyTime *time.Time   `orm:"null;type(datetime)" json:"lastNotifyTime,omitempty"`
+	EscalateTime   *time.Time   `orm:"null;type(datetime)" json:"escalateTime,omitempty"`
+	Status         RecordStatus `orm:"default(0)" json:"status"`
+	CreateTime     *time.Time   `orm:"auto_now_add;type(datetime)" json:"createTime,omitempty"`
+	UpdateTime     *time.Time   `orm:"auto_now;type(datetime)" json:"updateTime,omitempty"`
 }
 
 func (*Record) TableName() string {
 	return TableNameRecord
 }
 
-func (*recordModel) List() ([]Record, error) {
+// SetLabels keeps a snapshot of the node labels, they are used to route the alert
+func (r *Record) SetLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		r.Labels = ""
+		return
+	}
+	data, _ := json.Marshal(labels)
+	r.Labels = string(data)
+}
+
+// Subject names what the record is about: the node, or the pod and its node
+func (r *Record) Subject() string {
+	if r.PodName == "" {
+		return r.HostName
+	}
+	subject := r.Namespace + "/" + r.PodName
+	if r.Container != "" {
+		subject += "[" + r.Container + "]"
+	}
+	if r.HostName != "" {
+		subject += "@" + r.HostName
+	}
+	return subject
+}
+
+func (r *Record) LabelMap() map[string]string {
+	labels := map[string]string{}
+	if r.Labels != "" {
+		json.Unmarshal([]byte(r.Labels), &labels)
+	}
+	return labels
+}
+
+// ListPending returns the records to send: new ones and the alerted ones not acknowledged yet.
+// Records stored as alerted without ever being sent are left out.
+func (*recordModel) ListPending() ([]Record, error) {
 	var records []Record
+	cond := orm.NewCondition()
+	cond = cond.And("Status", RecordTobeAltert).
+		OrCond(orm.NewCondition().And("Status", RecordAlerted).And("NotifyCount__gt", 0))
 	_, err := Ormer().QueryTable(new(Record)).
-		Filter("Status", 0).
+		SetCond(cond).
+		OrderBy("Id").
 		All(&records)
 
 	return records, err
 }
 
+// MarkNotified counts a notification of the records ids sent at now, acknowledged records are left alone
+func (*recordModel) MarkNotified(ids []int64, now time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := Ormer().QueryTable(new(Record)).
+		Filter("Id__in", ids).
+		Filter("Status__in", RecordTobeAltert, RecordAlerted).
+		Update(orm.Params{
+			"Status":         RecordAlerted,
+			"NotifyCount":    orm.ColValue(orm.ColAdd, 1),
+			"LastNotifyTime": now,
+		})
+
+	return err
+}
+
+// MarkEscalated remembers the records ids were sent to the escalation receivers at now
+func (*recordModel) MarkEscalated(ids []int64, now time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := Ormer().QueryTable(new(Record)).
+		Filter("Id__in", ids).
+		Update(orm.Params{"EscalateTime": now})
+
+	return err
+}
+
 func (*recordModel) Add(record *Record) error {
 	record.CreateTime = nil
 	_, err := Ormer().Insert(record)
@@ -46,6 +169,223 @@ func (*recordModel) Add(record *Record) error {
 	return err
 }
 
+// Exist reports whether the outage of hostName starting at start has been recorded already
+func (*recordModel) Exist(hostName string, reason string, start time.Time) (bool, error) {
+	count, err := Ormer().QueryTable(new(Record)).
+		Filter("HostName", hostName).
+		Filter("Reason", reason).
+		Filter("StartTime", start).
+		Count()
+
+	return count > 0, err
+}
+
+// ListOpen returns the unresolved records of hostName with one of the given types
+func (*recordModel) ListOpen(hostName string, types ...string) ([]Record, error) {
+	var records []Record
+	_, err := Ormer().QueryTable(new(Record)).
+		Filter("HostName", hostName).
+		Filter("Type__in", types).
+		Filter("Status__in", RecordTobeAltert, RecordAlerted, RecordAcked).
+		All(&records)
+
+	return records, err
+}
+
+// ExistType reports whether the alert of type about hostName starting at start has been recorded already
+func (*recordModel) ExistType(hostName string, t string, start time.Time) (bool, error) {
+	count, err := Ormer().QueryTable(new(Record)).
+		Filter("HostName", hostName).
+		Filter("Type", t).
+		Filter("StartTime", start).
+		Count()
+
+	return count > 0, err
+}
+
+// ExistPod reports whether the alert of type about the pod container starting at start has been recorded already
+func (*recordModel) ExistPod(t string, namespace string, podName string, container string, start time.Time) (bool, error) {
+	count, err := Ormer().QueryTable(new(Record)).
+		Filter("Type", t).
+		Filter("Namespace", namespace).
+		Filter("PodName", podName).
+		Filter("Container", container).
+		Filter("StartTime", start).
+		Count()
+
+	return count > 0, err
+}
+
+// ListOpenPods returns the unresolved records of pod alerts. With namespace and podName
+// only the records of that pod are returned.
+func (*recordModel) ListOpenPods(namespace string, podName string) ([]Record, error) {
+	var records []Record
+	qs := Ormer().QueryTable(new(Record)).
+		Filter("Type__in", RecordTypePodCrashLoopBackOff, RecordTypePodOOMKilled, RecordTypePodImagePullBackOff,
+			RecordTypePodRestartSpike, RecordTypePodPending).
+		Filter("Status__in", RecordTobeAltert, RecordAlerted, RecordAcked)
+	if podName != "" {
+		qs = qs.Filter("Namespace", namespace).Filter("PodName", podName)
+	}
+	_, err := qs.All(&records)
+
+	return records, err
+}
+
+// resolution returns when record is resolved at resolveTime, now when that is before its
+// start, and the duration of the outage in seconds
+func resolution(record *Record, resolveTime time.Time) (time.Time, int64) {
+	start := resolveTime
+	if record.StartTime != nil {
+		start = *record.StartTime
+	} else if record.CreateTime != nil {
+		start = *record.CreateTime
+	}
+	if resolveTime.Before(start) {
+		resolveTime = time.Now()
+	}
+	return resolveTime, int64(resolveTime.Sub(start).Seconds())
+}
+
+// Resolve closes record at resolveTime and computes the duration of the outage
+func (*recordModel) Resolve(record *Record, resolveTime time.Time) error {
+	resolveTime, duration := resolution(record, resolveTime)
+	record.Status = RecordResolved
+	record.ResolveTime = &resolveTime
+	record.Duration = duration
+	record.UpdateTime = nil
+	_, err := Ormer().Update(record, "Status", "ResolveTime", "Duration", "UpdateTime")
+
+	return err
+}
+
+// ListUpdatedSince returns the records created, acknowledged or resolved at or after since,
+// in the order of their update
+func (*recordModel) ListUpdatedSince(since time.Time) ([]Record, error) {
+	var records []Record
+	_, err := Ormer().QueryTable(new(Record)).
+		Filter("UpdateTime__gte", since).
+		OrderBy("UpdateTime", "Id").
+		All(&records)
+
+	return records, err
+}
+
+// RecordQuery filters the records returned by Query, zero values match everything
+type RecordQuery struct {
+	HostName string
+	Type     string
+	Status   []RecordStatus
+	Offset   int64
+	Limit    int64
+}
+
+// Query returns the records matching query, newest first, with the total count of matches
+func (*recordModel) Query(query RecordQuery) ([]Record, int64, error) {
+	qs := Ormer().QueryTable(new(Record))
+	if query.HostName != "" {
+		qs = qs.Filter("HostName", query.HostName)
+	}
+	if query.Type != "" {
+		qs = qs.Filter("Type", query.Type)
+	}
+	if len(query.Status) > 0 {
+		qs = qs.Filter("Status__in", query.Status)
+	}
+	total, err := qs.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var records []Record
+	_, err = qs.OrderBy("-Id").Offset(query.Offset).Limit(query.Limit).All(&records)
+
+	return records, total, err
+}
+
+func (*recordModel) GetById(id int64) (*Record, error) {
+	v := &Record{Id: id}
+	if err := Ormer().Read(v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Acknowledge marks the open record id as handled by user, the timer stops sending it
+func (m *recordModel) Acknowledge(id int64, user string, comment string) (*Record, error) {
+	v, err := m.GetById(id)
+	if err != nil {
+		return nil, err
+	}
+	if v.Status == RecordResolved {
+		return nil, &erroresult.ErrorResult{
+			Code:    http.StatusConflict,
+			SubCode: http.StatusConflict,
+			Msg:     "record is resolved already",
+		}
+	}
+
+	now := time.Now()
+	v.Status = RecordAcked
+	v.AckUser = user
+	v.AckComment = comment
+	v.AckTime = &now
+	v.UpdateTime = nil
+	_, err = Ormer().Update(v, "Status", "AckUser", "AckComment", "AckTime", "UpdateTime")
+
+	return v, err
+}
+
+// ResolveById closes the record id by hand, user and comment are kept with the acknowledgement.
+// The record is only updated while open, a record resolved meanwhile is returned as is.
+func (m *recordModel) ResolveById(id int64, user string, comment string) (*Record, error) {
+	v, err := m.GetById(id)
+	if err != nil {
+		return nil, err
+	}
+	if v.Status == RecordResolved {
+		return v, nil
+	}
+
+	now := time.Now()
+	resolveTime, duration := resolution(v, now)
+	params := orm.Params{
+		"Status":      RecordResolved,
+		"ResolveTime": resolveTime,
+		"Duration":    duration,
+		"UpdateTime":  now,
+	}
+	if v.AckTime == nil {
+		params["AckUser"] = user
+		params["AckComment"] = comment
+		params["AckTime"] = now
+	}
+	_, err = Ormer().QueryTable(new(Record)).
+		Filter("Id", id).
+		Filter("Status__in", RecordTobeAltert, RecordAlerted, RecordAcked).
+		Update(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.GetById(id)
+}
+
+// RecordCount is the number of records of a type in a status
+type RecordCount struct {
+	Type   string
+	Status RecordStatus
+	Count  int64
+}
+
+func (*recordModel) CountByTypeStatus() ([]RecordCount, error) {
+	var counts []RecordCount
+	_, err := Ormer().Raw("SELECT type, status, COUNT(*) AS count FROM " + TableNameRecord + " GROUP BY type, status").QueryRows(&counts)
+
+	return counts, err
+}
+
 func (*recordModel) UpdateStatus(hostName string, status RecordStatus) error {
 	v := &Record{
 		HostName: hostName,
@@ -54,12 +394,18 @@ func (*recordModel) UpdateStatus(hostName string, status RecordStatus) error {
 	if err := Ormer().Read(v, "HostName"); err != nil {
 		logs.Error("为找到相应主机信息, ", err)
 		return err
-	} else {
-		v.UpdateTime = nil
-		v.Status = status
-		_, err = Ormer().Update(v, "Status", "UpdateTime")
-		return err
 	}
+	v.UpdateTime = nil
+	v.Status = status
+	_, err := Ormer().Update(v, "Status", "UpdateTime")
+	return err
+}
 
-	return nil
+// UpdateStatusById sets the status of the record id
+func (*recordModel) UpdateStatusById(id int64, status RecordStatus) error {
+	_, err := Ormer().QueryTable(new(Record)).
+		Filter("Id", id).
+		Update(orm.Params{"Status": status, "UpdateTime": time.Now()})
+
+	return err
 }
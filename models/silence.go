@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const TableNameSilence = "silence"
+
+type silenceModel struct{}
+
+// Silence mutes the alerts of the matching nodes between StartTime and EndTime.
+// Matched records are still stored, they are only not sent.
+type Silence struct {
+	Id int64 `orm:"auto" json:"id,omitempty"`
+	// HostName matches one node, empty matches every node
+	HostName string `orm:"null;size(128)" json:"hostName,omitempty"`
+	// Labels are the node labels to match as a json object, a value "*" only requires the label
+	Labels     string     `orm:"null;type(text)" json:"labels,omitempty"`
+	StartTime  *time.Time `orm:"type(datetime)" json:"startTime"`
+	EndTime    *time.Time `orm:"type(datetime)" json:"endTime"`
+	CreatedBy  string     `orm:"size(128)" json:"createdBy"`
+	Comment    string     `orm:"null;size(512)" json:"comment,omitempty"`
+	CreateTime *time.Time `orm:"auto_now_add;type(datetime)" json:"createTime,omitempty"`
+	UpdateTime *time.Time `orm:"auto_now;type(datetime)" json:"updateTime,omitempty"`
+}
+
+func (*Silence) TableName() string {
+	return TableNameSilence
+}
+
+func (s *Silence) SetLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		s.Labels = ""
+		return
+	}
+	data, _ := json.Marshal(labels)
+	s.Labels = string(data)
+}
+
+func (s *Silence) LabelMap() map[string]string {
+	labels := map[string]string{}
+	if s.Labels != "" {
+		json.Unmarshal([]byte(s.Labels), &labels)
+	}
+	return labels
+}
+
+// ActiveAt reports whether the silence applies at now
+func (s *Silence) ActiveAt(now time.Time) bool {
+	if s.StartTime != nil && now.Before(*s.StartTime) {
+		return false
+	}
+	return s.EndTime == nil || now.Before(*s.EndTime)
+}
+
+// Matches reports whether the alerts of the node hostName with labels are muted by the silence
+func (s *Silence) Matches(hostName string, labels map[string]string) bool {
+	if s.HostName != "" && s.HostName != hostName {
+		return false
+	}
+	for key, value := range s.LabelMap() {
+		actual, ok := labels[key]
+		if !ok || (value != "*" && value != actual) {
+			return false
+		}
+	}
+	return true
+}
+
+// List returns the silences, newest first. With active only those applying at now are returned.
+func (*silenceModel) List(active bool, now time.Time) ([]Silence, error) {
+	var silences []Silence
+	qs := Ormer().QueryTable(new(Silence))
+	if active {
+		qs = qs.Filter("StartTime__lte", now).Filter("EndTime__gt", now)
+	}
+	_, err := qs.OrderBy("-Id").All(&silences)
+
+	return silences, err
+}
+
+func (*silenceModel) GetById(id int64) (*Silence, error) {
+	v := &Silence{Id: id}
+	if err := Ormer().Read(v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (*silenceModel) Add(silence *Silence) (int64, error) {
+	silence.CreateTime = nil
+	return Ormer().Insert(silence)
+}
+
+func (*silenceModel) Update(silence *Silence) error {
+	silence.UpdateTime = nil
+	_, err := Ormer().Update(silence, "HostName", "Labels", "StartTime", "EndTime", "Comment", "UpdateTime")
+
+	return err
+}
+
+func (*silenceModel) Delete(id int64) error {
+	_, err := Ormer().Delete(&Silence{Id: id})
+
+	return err
+}
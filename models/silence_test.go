@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSilenceMatches(t *testing.T) {
+	labels := map[string]string{"node-role": "gpu", "zone": "a"}
+	tests := []struct {
+		name     string
+		hostName string
+		labels   map[string]string
+		want     bool
+	}{
+		{"every node", "", nil, true},
+		{"host name", "node-1", nil, true},
+		{"other host name", "node-2", nil, false},
+		{"labels", "", map[string]string{"node-role": "gpu"}, true},
+		{"other label value", "", map[string]string{"node-role": "cpu"}, false},
+		{"any label value", "", map[string]string{"zone": "*"}, true},
+		{"missing label", "", map[string]string{"pool": "*"}, false},
+		{"host name and labels", "node-1", map[string]string{"zone": "a"}, true},
+		{"host name and other labels", "node-1", map[string]string{"zone": "b"}, false},
+	}
+	for _, test := range tests {
+		silence := &Silence{HostName: test.hostName}
+		silence.SetLabels(test.labels)
+		if got := silence.Matches("node-1", labels); got != test.want {
+			t.Errorf("%s: Matches() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSilenceActiveAt(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		at := now.Add(d)
+		return &at
+	}
+	tests := []struct {
+		name       string
+		start, end *time.Time
+		want       bool
+	}{
+		{"open", nil, nil, true},
+		{"started", at(-time.Hour), at(time.Hour), true},
+		{"not started", at(time.Minute), at(time.Hour), false},
+		{"starting now", at(0), at(time.Hour), true},
+		{"ended", at(-time.Hour), at(-time.Minute), false},
+		{"ending now", at(-time.Hour), at(0), false},
+	}
+	for _, test := range tests {
+		silence := &Silence{StartTime: test.start, EndTime: test.end}
+		if got := silence.ActiveAt(now); got != test.want {
+			t.Errorf("%s: ActiveAt() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
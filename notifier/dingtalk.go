@@ -0,0 +1,110 @@
+package notifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dingTalk posts markdown messages to a DingTalk robot, signed when a secret is configured
+type dingTalk struct {
+	name   string
+	url    string
+	secret string
+}
+
+type Markdown struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+type At struct {
+	AtMobiles []string `json:"atMobiles"`
+	IsAtAll   bool     `json:"isAtAll"`
+}
+
+func newDingTalk(name string, config Config) (Notifier, error) {
+	if config.Get("url") == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	return &dingTalk{
+		name:   name,
+		url:    config.Get("url"),
+		secret: config.Get("secret"),
+	}, nil
+}
+
+func (d *dingTalk) Name() string {
+	return d.name
+}
+
+func (d *dingTalk) Send(msg *Message) error {
+	text := msg.Text
+	// mobiles are only highlighted when they appear in the text
+	for _, user := range msg.Users {
+		text += " @" + user
+	}
+	data, err := json.Marshal(
+		struct {
+			Msgtype  string   `json:"msgtype"`
+			Markdown Markdown `json:"markdown"`
+			At       At       `json:"at"`
+		}{
+			Msgtype: "markdown",
+			Markdown: Markdown{
+				Title: msg.Title,
+				Text:  text,
+			},
+			At: At{
+				AtMobiles: msg.Users,
+				IsAtAll:   false,
+			},
+		})
+	if err != nil {
+		return err
+	}
+
+	body, err := post(d.signedUrl(time.Now()), "application/json", data)
+	if err != nil {
+		return err
+	}
+	return checkErrCode(body)
+}
+
+// signedUrl appends timestamp and sign, see https://ding-doc.dingtalk.com/doc#/serverapi2/qf2nxq
+func (d *dingTalk) signedUrl(now time.Time) string {
+	if d.secret == "" {
+		return d.url
+	}
+	timestamp := strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10)
+	mac := hmac.New(sha256.New, []byte(d.secret))
+	mac.Write([]byte(timestamp + "\n" + d.secret))
+	sign := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	separator := "?"
+	if strings.Contains(d.url, "?") {
+		separator = "&"
+	}
+	return d.url + separator + "timestamp=" + timestamp + "&sign=" + sign
+}
+
+// checkErrCode checks the errcode of the DingTalk and WeCom answers
+func checkErrCode(body []byte) error {
+	result := struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("errcode %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"node-controller/common"
+	"strings"
+)
+
+// email sends the message through an SMTP server
+type email struct {
+	name     string
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func newEmail(name string, config Config) (Notifier, error) {
+	host := config.Get("host")
+	to := common.SplitList(config.Get("to"))
+	if host == "" || config.Get("from") == "" || len(to) == 0 {
+		return nil, fmt.Errorf("host, from and to are required")
+	}
+	port := config.Get("port")
+	if port == "" {
+		port = "25"
+	}
+	return &email{
+		name:     name,
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		username: config.Get("username"),
+		password: config.Get("password"),
+		from:     config.Get("from"),
+		to:       to,
+	}, nil
+}
+
+func (e *email) Name() string {
+	return e.name
+}
+
+func (e *email) Send(msg *Message) error {
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+
+	body := msg.Text
+	if len(msg.Users) > 0 {
+		body += "\n\n@" + strings.Join(msg.Users, " @")
+	}
+	data := "From: " + e.from + "\r\n" +
+		"To: " + strings.Join(e.to, ",") + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Title) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + strings.Replace(body, "\n", "\r\n", -1)
+
+	return smtp.SendMail(e.addr, auth, e.from, e.to, []byte(data))
+}
@@ -0,0 +1,74 @@
+package notifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// lark posts text messages to a Lark (飞书) custom bot, signed when a secret is configured
+type lark struct {
+	name   string
+	url    string
+	secret string
+}
+
+func newLark(name string, config Config) (Notifier, error) {
+	if config.Get("url") == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	return &lark{
+		name:   name,
+		url:    config.Get("url"),
+		secret: config.Get("secret"),
+	}, nil
+}
+
+func (l *lark) Name() string {
+	return l.name
+}
+
+func (l *lark) Send(msg *Message) error {
+	text := msg.Title + "\n" + msg.Text
+	for _, user := range msg.Users {
+		text += ` <at user_id="` + user + `"></at>`
+	}
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content": map[string]string{
+			"text": text,
+		},
+	}
+	if l.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = timestamp
+		payload["sign"] = l.sign(timestamp)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	body, err := post(l.url, "application/json", data)
+	if err != nil {
+		return err
+	}
+	result := struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}{}
+	if err := json.Unmarshal(body, &result); err == nil && result.Code != 0 {
+		return fmt.Errorf("code %d: %s", result.Code, result.Msg)
+	}
+	return nil
+}
+
+// sign uses timestamp and secret as the key of an empty message
+func (l *lark) sign(timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+l.secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
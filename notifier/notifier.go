@@ -0,0 +1,267 @@
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/astaxie/beego"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"io/ioutil"
+	"net/http"
+	"node-controller/common"
+	"node-controller/util/logs"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notifier types, the "type" key of a notifier section in app.conf
+const (
+	TypeDingTalk = "dingtalk"
+	TypeWeCom    = "wecom"
+	TypeLark     = "lark"
+	TypeWebhook  = "webhook"
+	TypeEmail    = "email"
+	TypeSlack    = "slack"
+)
+
+// DefaultName is the notifier built from AlertUrl when no Notifiers are configured
+const DefaultName = "default"
+
+var (
+	sendTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_controller_notifier_sends_total",
+		Help: "Messages sent by each notifier, by result.",
+	}, []string{"notifier", "result"})
+	sendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "node_controller_notifier_send_duration_seconds",
+		Help: "How long sending a message by each notifier takes.",
+	}, []string{"notifier"})
+)
+
+// Message is an alert or recovery rendered for delivery
+type Message struct {
+	Id    int64
+	Title string
+	// Text is the markdown body of the message
+	Text  string
+	Start string
+	// Users are the mobiles / user ids to mention
+	Users   []string
+	Recover bool
+}
+
+// Notifier delivers messages to one alert channel
+type Notifier interface {
+	Name() string
+	Send(msg *Message) error
+}
+
+// Config is the section of a notifier in app.conf, keys are lower case
+type Config map[string]string
+
+func (c Config) Get(key string) string {
+	return c[strings.ToLower(key)]
+}
+
+type factory func(name string, config Config) (Notifier, error)
+
+var factories = map[string]factory{
+	TypeDingTalk: newDingTalk,
+	TypeWeCom:    newWeCom,
+	TypeLark:     newLark,
+	TypeWebhook:  newWebhook,
+	TypeEmail:    newEmail,
+	TypeSlack:    newSlack,
+}
+
+var (
+	lock      sync.Mutex
+	notifiers map[string]Notifier
+)
+
+// Notifiers returns the notifiers configured by the comma separated Notifiers key,
+// each name refers to a section of app.conf whose "type" selects the implementation:
+//
+//	Notifiers = ops,mail
+//	[ops]
+//	type = dingtalk
+//	url = https://oapi.dingtalk.com/robot/send?access_token=xxx
+//	secret = SECxxx
+//
+// Without Notifiers the legacy AlertUrl is used as a DingTalk robot.
+func Notifiers() map[string]Notifier {
+	lock.Lock()
+	defer lock.Unlock()
+	if notifiers == nil {
+		notifiers = load()
+	}
+	return notifiers
+}
+
+// Get returns the configured notifier called name
+func Get(name string) (Notifier, bool) {
+	n, ok := Notifiers()[name]
+	return n, ok
+}
+
+func load() map[string]Notifier {
+	result := make(map[string]Notifier)
+	names := common.SplitList(beego.AppConfig.String("Notifiers"))
+	if len(names) == 0 {
+		if url := beego.AppConfig.String("AlertUrl"); url != "" {
+			n, _ := newDingTalk(DefaultName, Config{"url": url})
+			result[DefaultName] = n
+		}
+		return result
+	}
+
+	for _, name := range names {
+		section, err := beego.AppConfig.GetSection(name)
+		if err != nil {
+			logs.Error("notifier %s is not configured: %s", name, err.Error())
+			continue
+		}
+		config := Config(section)
+		build, ok := factories[config.Get("type")]
+		if !ok {
+			logs.Error("notifier %s has unknown type %q", name, config.Get("type"))
+			continue
+		}
+		n, err := build(name, config)
+		if err != nil {
+			logs.Error("notifier %s is invalid: %s", name, err.Error())
+			continue
+		}
+		result[name] = n
+	}
+	return result
+}
+
+// Send2Hook renders content, t is "alter" or "recover", and delivers every item
+// to the notifiers chosen by the alert routes. It returns the ids of the records of the
+// items delivered by at least one notifier, the items held back by the routes are not.
+func Send2Hook(content []common.Ready2Send, t string) (delivered []int64) {
+	delivered = make([]int64, 0, len(content))
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 16384)
+			buf = buf[:runtime.Stack(buf, false)]
+			logs.Error("Panic in Send2Hook:%v\n%s", e, buf)
+		}
+	}()
+
+	routes := Routes()
+	for i := range content {
+		deliveries := routes.Deliveries(&content[i], time.Now())
+		if len(deliveries) == 0 {
+			logs.Info("alert %d of %s held back by the alert routes", content[i].Id, content[i].Title)
+			continue
+		}
+		if deliver(&content[i], t, deliveries) {
+			if len(content[i].Ids) > 0 {
+				delivered = append(delivered, content[i].Ids...)
+			} else {
+				delivered = append(delivered, content[i].Id)
+			}
+		}
+		if t != "recover" {
+			time.Sleep(1 * time.Second)
+		}
+	}
+	return delivered
+}
+
+// Send2Receivers delivers every item of content to the notifiers named receivers,
+// bypassing the alert routes. It is used to escalate alerts.
+func Send2Receivers(content []common.Ready2Send, t string, receivers []string) {
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 16384)
+			buf = buf[:runtime.Stack(buf, false)]
+			logs.Error("Panic in Send2Receivers:%v\n%s", e, buf)
+		}
+	}()
+
+	for i := range content {
+		deliveries := make([]Delivery, 0, len(receivers))
+		for _, receiver := range receivers {
+			n, ok := Get(receiver)
+			if !ok {
+				logs.Error("unknown notifier %s", receiver)
+				continue
+			}
+			deliveries = append(deliveries, Delivery{Notifier: n, Users: common.SplitList(content[i].User)})
+		}
+		deliver(&content[i], t, deliveries)
+	}
+}
+
+// deliver sends item to deliveries, it returns whether one of them succeeded
+func deliver(item *common.Ready2Send, t string, deliveries []Delivery) bool {
+	sent := false
+	for _, delivery := range deliveries {
+		msg := render(item, t)
+		msg.Users = delivery.Users
+		start := time.Now()
+		err := delivery.Notifier.Send(msg)
+		sendDuration.WithLabelValues(delivery.Notifier.Name()).Observe(time.Since(start).Seconds())
+		if err != nil {
+			sendTotal.WithLabelValues(delivery.Notifier.Name(), "failure").Inc()
+			logs.Error("notifier %s failed to send %q: %s", delivery.Notifier.Name(), msg.Title, err.Error())
+			continue
+		}
+		sendTotal.WithLabelValues(delivery.Notifier.Name(), "success").Inc()
+		sent = true
+	}
+	return sent
+}
+
+func render(i *common.Ready2Send, t string) *Message {
+	msg := &Message{
+		Id:      i.Id,
+		Title:   i.Title,
+		Text:    i.Alerts,
+		Start:   i.Start,
+		Users:   common.SplitList(i.User),
+		Recover: t == "recover",
+	}
+	if !msg.Recover {
+		msg.Text = "- [告警名称] " + i.Title + "\n" +
+			"- [K8s事件]" + i.Alerts + "\n" +
+			"- [操作确认]" + "(" + ConfirmUrl(i.Id, i.Start) + ")"
+	}
+	return msg
+}
+
+// ConfirmUrl is the page acknowledging the alert id
+func ConfirmUrl(id int64, start string) string {
+	return beego.AppConfig.String("WebUrl") + "/alerts_confirm/" + "?start=" + start + "&id=" + strconv.FormatInt(id, 10)
+}
+
+// post sends body to url and returns the response body, non 2xx answers are errors
+func post(url string, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, common.ErrHttpRequest
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return respBody, fmt.Errorf("http status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
@@ -0,0 +1,303 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/astaxie/beego"
+	"io/ioutil"
+	"node-controller/common"
+	"node-controller/util/logs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RouteConfig is the content of AlertRouteFile. Routes are tried in order, the first
+// matching and active route decides the receivers unless it sets Continue.
+// Alerts matching no route go to Default, or to every notifier when Default has no receivers.
+//
+//	{
+//	  "routes": [{
+//	    "name": "gpu-pool",
+//	    "match": {"labels": {"node-role": "gpu"}, "severities": ["critical"]},
+//	    "receivers": ["gpu-team"],
+//	    "users": ["13800000000"],
+//	    "schedule": {
+//	      "days": ["weekday"],
+//	      "timezone": "Asia/Shanghai",
+//	      "quietHours": [{"start": "22:00", "end": "08:00", "severities": ["warning", "info"]}]
+//	    }
+//	  }],
+//	  "default": {"receivers": ["ops"]}
+//	}
+type RouteConfig struct {
+	Routes  []Route `json:"routes"`
+	Default Route   `json:"default"`
+}
+
+type Route struct {
+	Name      string   `json:"name"`
+	Match     Matcher  `json:"match"`
+	Receivers []string `json:"receivers"`
+	// Users are mentioned in the messages sent by this route
+	Users    []string  `json:"users"`
+	Schedule *Schedule `json:"schedule,omitempty"`
+	Continue bool      `json:"continue"`
+}
+
+// Matcher selects alerts, empty fields match everything.
+// A label value "*" only requires the label to be present.
+type Matcher struct {
+	Labels     map[string]string `json:"labels"`
+	Types      []string          `json:"types"`
+	Severities []string          `json:"severities"`
+	HostNames  []string          `json:"hostNames"`
+}
+
+// Schedule limits when a route is used.
+// Days lists the active days by name (Mon, Tuesday...) or "weekday" / "weekend", empty is every day.
+// During QuietHours the route matches but its messages are held back.
+type Schedule struct {
+	Days       []string     `json:"days"`
+	Timezone   string       `json:"timezone"`
+	QuietHours []QuietHours `json:"quietHours"`
+}
+
+// QuietHours is a daily window from Start to End (HH:MM), it may wrap midnight.
+// Only the listed severities are muted, empty mutes all of them.
+type QuietHours struct {
+	Start      string   `json:"start"`
+	End        string   `json:"end"`
+	Severities []string `json:"severities"`
+}
+
+// Delivery is a notifier chosen for an alert, with the users to mention
+type Delivery struct {
+	Notifier Notifier
+	Users    []string
+}
+
+var (
+	routeLock   sync.Mutex
+	routeConfig *RouteConfig
+	routeMtime  time.Time
+)
+
+// Routes returns the routing configuration, the file is read again when it changes.
+func Routes() *RouteConfig {
+	routeLock.Lock()
+	defer routeLock.Unlock()
+
+	file := beego.AppConfig.DefaultString("AlertRouteFile", "conf/routes.json")
+	info, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) || routeConfig == nil {
+			routeConfig = &RouteConfig{}
+			routeMtime = time.Time{}
+		}
+		return routeConfig
+	}
+	if routeConfig != nil && info.ModTime().Equal(routeMtime) {
+		return routeConfig
+	}
+
+	config, err := loadRoutes(file)
+	if err != nil {
+		logs.Error("failed to load alert routes %s: %s", file, err.Error())
+		if routeConfig == nil {
+			routeConfig = &RouteConfig{}
+		}
+		return routeConfig
+	}
+	routeConfig = config
+	routeMtime = info.ModTime()
+	return routeConfig
+}
+
+func loadRoutes(file string) (*RouteConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := &RouteConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	for _, route := range append(config.Routes, config.Default) {
+		if route.Schedule == nil {
+			continue
+		}
+		if _, err := route.Schedule.location(); err != nil {
+			return nil, fmt.Errorf("route %s: %s", route.Name, err.Error())
+		}
+		for _, quiet := range route.Schedule.QuietHours {
+			if _, err := parseClock(quiet.Start); err != nil {
+				return nil, fmt.Errorf("route %s: %s", route.Name, err.Error())
+			}
+			if _, err := parseClock(quiet.End); err != nil {
+				return nil, fmt.Errorf("route %s: %s", route.Name, err.Error())
+			}
+		}
+	}
+	return config, nil
+}
+
+// Deliveries returns where alert has to be sent at now.
+// A receiver chosen by several routes is sent once, with the users of all of them.
+func (c *RouteConfig) Deliveries(alert *common.Ready2Send, now time.Time) []Delivery {
+	routes := make([]Route, 0)
+	matched := false
+	for _, route := range c.Routes {
+		if !route.Match.matches(alert) || !route.Schedule.activeOn(now) {
+			continue
+		}
+		matched = true
+		if !route.Schedule.quiet(alert.Severity, now) {
+			routes = append(routes, route)
+		}
+		if !route.Continue {
+			break
+		}
+	}
+	if !matched {
+		if c.Default.Schedule.quiet(alert.Severity, now) {
+			return nil
+		}
+		routes = append(routes, c.Default)
+	}
+
+	deliveries := make([]Delivery, 0)
+	index := make(map[string]int)
+	add := func(n Notifier, users []string) {
+		if i, ok := index[n.Name()]; ok {
+			deliveries[i].Users = appendUnique(deliveries[i].Users, users...)
+			return
+		}
+		index[n.Name()] = len(deliveries)
+		deliveries = append(deliveries, Delivery{Notifier: n, Users: appendUnique(nil, users...)})
+	}
+	for _, route := range routes {
+		users := appendUnique(common.SplitList(alert.User), route.Users...)
+		if len(route.Receivers) == 0 {
+			for _, n := range Notifiers() {
+				add(n, users)
+			}
+			continue
+		}
+		for _, receiver := range route.Receivers {
+			n, ok := Get(receiver)
+			if !ok {
+				logs.Error("route %s refers to unknown notifier %s", route.Name, receiver)
+				continue
+			}
+			add(n, users)
+		}
+	}
+	return deliveries
+}
+
+func (m Matcher) matches(alert *common.Ready2Send) bool {
+	if len(m.Types) > 0 && !common.Contains(m.Types, alert.Type) {
+		return false
+	}
+	if len(m.Severities) > 0 && !common.Contains(m.Severities, alert.Severity) {
+		return false
+	}
+	if len(m.HostNames) > 0 && !common.Contains(m.HostNames, alert.HostName) {
+		return false
+	}
+	for key, value := range m.Labels {
+		actual, ok := alert.Labels[key]
+		if !ok || (value != "*" && value != actual) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Schedule) location() (*time.Location, error) {
+	if s == nil || s.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(s.Timezone)
+}
+
+func (s *Schedule) localTime(now time.Time) time.Time {
+	location, err := s.location()
+	if err != nil {
+		return now
+	}
+	return now.In(location)
+}
+
+// activeOn reports whether the route is used on the day of now
+func (s *Schedule) activeOn(now time.Time) bool {
+	if s == nil || len(s.Days) == 0 {
+		return true
+	}
+	weekday := s.localTime(now).Weekday()
+	weekend := weekday == time.Saturday || weekday == time.Sunday
+	for _, day := range s.Days {
+		switch strings.ToLower(day) {
+		case "weekday", "weekdays":
+			if !weekend {
+				return true
+			}
+		case "weekend", "weekends":
+			if weekend {
+				return true
+			}
+		default:
+			if strings.HasPrefix(strings.ToLower(weekday.String()), strings.ToLower(day)) && len(day) >= 3 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// quiet reports whether alerts of severity are held back at now
+func (s *Schedule) quiet(severity string, now time.Time) bool {
+	if s == nil {
+		return false
+	}
+	local := s.localTime(now)
+	minute := local.Hour()*60 + local.Minute()
+	for _, quiet := range s.QuietHours {
+		if len(quiet.Severities) > 0 && !common.Contains(quiet.Severities, severity) {
+			continue
+		}
+		start, err1 := parseClock(quiet.Start)
+		end, err2 := parseClock(quiet.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if start <= end && minute >= start && minute < end {
+			return true
+		}
+		// window wrapping midnight
+		if start > end && (minute >= start || minute < end) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock returns the minutes since midnight of HH:MM
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !common.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
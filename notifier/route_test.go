@@ -0,0 +1,102 @@
+package notifier
+
+import (
+	"node-controller/common"
+	"testing"
+	"time"
+)
+
+func TestMatcherMatches(t *testing.T) {
+	alert := &common.Ready2Send{
+		HostName: "node-1",
+		Type:     "NodeNotReady",
+		Severity: "critical",
+		Labels:   map[string]string{"node-role": "gpu", "zone": "a"},
+	}
+	tests := []struct {
+		name    string
+		matcher Matcher
+		want    bool
+	}{
+		{"empty matches everything", Matcher{}, true},
+		{"type", Matcher{Types: []string{"NodeLost", "NodeNotReady"}}, true},
+		{"other type", Matcher{Types: []string{"NodeLost"}}, false},
+		{"severity", Matcher{Severities: []string{"critical"}}, true},
+		{"other severity", Matcher{Severities: []string{"warning", "info"}}, false},
+		{"host name", Matcher{HostNames: []string{"node-1"}}, true},
+		{"other host name", Matcher{HostNames: []string{"node-2"}}, false},
+		{"labels", Matcher{Labels: map[string]string{"node-role": "gpu", "zone": "a"}}, true},
+		{"other label value", Matcher{Labels: map[string]string{"node-role": "cpu"}}, false},
+		{"any label value", Matcher{Labels: map[string]string{"zone": "*"}}, true},
+		{"missing label", Matcher{Labels: map[string]string{"pool": "*"}}, false},
+		{"all fields", Matcher{Types: []string{"NodeNotReady"}, Severities: []string{"critical"}, Labels: map[string]string{"zone": "a"}}, true},
+		{"one field fails", Matcher{Types: []string{"NodeNotReady"}, Severities: []string{"warning"}}, false},
+	}
+	for _, test := range tests {
+		if got := test.matcher.matches(alert); got != test.want {
+			t.Errorf("%s: matches() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestScheduleQuiet(t *testing.T) {
+	at := func(clock string) time.Time {
+		now, _ := time.Parse("2006-01-02 15:04", "2026-10-14 "+clock)
+		return now
+	}
+	night := QuietHours{Start: "22:00", End: "08:00"}
+	lunch := QuietHours{Start: "12:00", End: "13:30", Severities: []string{"warning", "info"}}
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		severity string
+		now      time.Time
+		want     bool
+	}{
+		{"no schedule", nil, "critical", at("23:00"), false},
+		{"no quiet hours", &Schedule{Timezone: "UTC"}, "critical", at("23:00"), false},
+		{"before the window", &Schedule{Timezone: "UTC", QuietHours: []QuietHours{lunch}}, "warning", at("11:59"), false},
+		{"start of the window", &Schedule{Timezone: "UTC", QuietHours: []QuietHours{lunch}}, "warning", at("12:00"), true},
+		{"end of the window", &Schedule{Timezone: "UTC", QuietHours: []QuietHours{lunch}}, "warning", at("13:30"), false},
+		{"severity not muted", &Schedule{Timezone: "UTC", QuietHours: []QuietHours{lunch}}, "critical", at("12:30"), false},
+		{"wrapping midnight, evening", &Schedule{Timezone: "UTC", QuietHours: []QuietHours{night}}, "critical", at("23:00"), true},
+		{"wrapping midnight, morning", &Schedule{Timezone: "UTC", QuietHours: []QuietHours{night}}, "critical", at("07:59"), true},
+		{"wrapping midnight, day", &Schedule{Timezone: "UTC", QuietHours: []QuietHours{night}}, "critical", at("08:00"), false},
+		{"second window", &Schedule{Timezone: "UTC", QuietHours: []QuietHours{night, lunch}}, "info", at("12:15"), true},
+		{"invalid window ignored", &Schedule{Timezone: "UTC", QuietHours: []QuietHours{{Start: "25:00", End: "08:00"}}}, "critical", at("02:00"), false},
+	}
+	for _, test := range tests {
+		if got := test.schedule.quiet(test.severity, test.now); got != test.want {
+			t.Errorf("%s: quiet() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestScheduleActiveOn(t *testing.T) {
+	// 2026-10-14 is a Wednesday
+	wednesday := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	saturday := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		now      time.Time
+		want     bool
+	}{
+		{"no schedule", nil, wednesday, true},
+		{"every day", &Schedule{Timezone: "UTC"}, saturday, true},
+		{"weekday", &Schedule{Timezone: "UTC", Days: []string{"weekday"}}, wednesday, true},
+		{"not a weekday", &Schedule{Timezone: "UTC", Days: []string{"weekday"}}, saturday, false},
+		{"weekend", &Schedule{Timezone: "UTC", Days: []string{"Weekend"}}, saturday, true},
+		{"day name", &Schedule{Timezone: "UTC", Days: []string{"Wednesday"}}, wednesday, true},
+		{"short day name", &Schedule{Timezone: "UTC", Days: []string{"wed"}}, wednesday, true},
+		{"too short day name", &Schedule{Timezone: "UTC", Days: []string{"we"}}, wednesday, false},
+		{"other day", &Schedule{Timezone: "UTC", Days: []string{"Mon", "Tue"}}, wednesday, false},
+	}
+	for _, test := range tests {
+		if got := test.schedule.activeOn(test.now); got != test.want {
+			t.Errorf("%s: activeOn() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
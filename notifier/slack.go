@@ -0,0 +1,53 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// slack posts to a Slack compatible incoming webhook (Slack, Mattermost, Rocket.Chat)
+type slack struct {
+	name     string
+	url      string
+	channel  string
+	username string
+}
+
+func newSlack(name string, config Config) (Notifier, error) {
+	if config.Get("url") == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	return &slack{
+		name:     name,
+		url:      config.Get("url"),
+		channel:  config.Get("channel"),
+		username: config.Get("username"),
+	}, nil
+}
+
+func (s *slack) Name() string {
+	return s.name
+}
+
+func (s *slack) Send(msg *Message) error {
+	text := "*" + msg.Title + "*\n" + msg.Text
+	for _, user := range msg.Users {
+		text += " <@" + user + ">"
+	}
+	payload := map[string]string{
+		"text": text,
+	}
+	if s.channel != "" {
+		payload["channel"] = s.channel
+	}
+	if s.username != "" {
+		payload["username"] = s.username
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = post(s.url, "application/json", data)
+	return err
+}
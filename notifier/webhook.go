@@ -0,0 +1,72 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+)
+
+// defaultWebhookTemplate posts the message as JSON
+const defaultWebhookTemplate = `{"id":{{.Id}},"title":{{json .Title}},"text":{{json .Text}},"start":{{json .Start}},"users":{{json .Users}},"recover":{{.Recover}}}`
+
+// webhook posts the message rendered by a Go template, the body defaults to the message as JSON.
+// The template is given inline by "template" or as a file by "templateFile".
+type webhook struct {
+	name        string
+	url         string
+	contentType string
+	template    *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func newWebhook(name string, config Config) (Notifier, error) {
+	if config.Get("url") == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	text := config.Get("template")
+	if file := config.Get("templateFile"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	if text == "" {
+		text = defaultWebhookTemplate
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	contentType := config.Get("contentType")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return &webhook{
+		name:        name,
+		url:         config.Get("url"),
+		contentType: contentType,
+		template:    tmpl,
+	}, nil
+}
+
+func (w *webhook) Name() string {
+	return w.name
+}
+
+func (w *webhook) Send(msg *Message) error {
+	var body bytes.Buffer
+	if err := w.template.Execute(&body, msg); err != nil {
+		return err
+	}
+	_, err := post(w.url, w.contentType, body.Bytes())
+	return err
+}
@@ -0,0 +1,45 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// weCom posts markdown messages to a WeCom (企业微信) group robot
+type weCom struct {
+	name string
+	url  string
+}
+
+func newWeCom(name string, config Config) (Notifier, error) {
+	if config.Get("url") == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	return &weCom{name: name, url: config.Get("url")}, nil
+}
+
+func (w *weCom) Name() string {
+	return w.name
+}
+
+func (w *weCom) Send(msg *Message) error {
+	content := "### " + msg.Title + "\n" + msg.Text
+	for _, user := range msg.Users {
+		content += " <@" + user + ">"
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": content,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	body, err := post(w.url, "application/json", data)
+	if err != nil {
+		return err
+	}
+	return checkErrCode(body)
+}
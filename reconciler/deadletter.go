@@ -0,0 +1,92 @@
+package reconciler
+
+import (
+	"fmt"
+	"github.com/astaxie/beego"
+	"net/http"
+	erroresult "node-controller/models/response/errors"
+	"node-controller/util/logs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a key dropped after exhausting its retries
+type DeadLetter struct {
+	Id        int64     `json:"id"`
+	Queue     string    `json:"queue"`
+	Key       string    `json:"key"`
+	Error     string    `json:"error"`
+	Retries   int       `json:"retries"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	requeue func()
+}
+
+// deadLetters keeps the last dropped items, the oldest ones go first once size is reached
+type deadLetters struct {
+	lock   sync.Mutex
+	lastId int64
+	items  []*DeadLetter
+	size   int
+}
+
+var DeadLetters = &deadLetters{size: beego.AppConfig.DefaultInt("DeadLetterSize", 1000)}
+
+func (d *deadLetters) add(letter *DeadLetter) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.lastId++
+	letter.Id = d.lastId
+	if d.size > 0 && len(d.items) >= d.size {
+		d.items = d.items[len(d.items)-d.size+1:]
+	}
+	d.items = append(d.items, letter)
+}
+
+// List returns the dead letters of queue, of every queue when it is empty, newest first
+func (d *deadLetters) List(queue string) []DeadLetter {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	letters := make([]DeadLetter, 0, len(d.items))
+	for _, letter := range d.items {
+		if queue == "" || letter.Queue == queue {
+			letters = append(letters, *letter)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].Id > letters[j].Id })
+	return letters
+}
+
+// take removes the dead letter id
+func (d *deadLetters) take(id int64) (*DeadLetter, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for i, letter := range d.items {
+		if letter.Id == id {
+			d.items = append(d.items[:i], d.items[i+1:]...)
+			return letter, nil
+		}
+	}
+	return nil, &erroresult.ErrorResult{
+		Code:    http.StatusNotFound,
+		SubCode: http.StatusNotFound,
+		Msg:     fmt.Sprintf("dead letter %d not found", id),
+	}
+}
+
+// Retry queues the key of the dead letter id again with its retries reset
+func (d *deadLetters) Retry(id int64) (*DeadLetter, error) {
+	letter, err := d.take(id)
+	if err != nil {
+		return nil, err
+	}
+	logs.Info("retrying %s '%s' of dead letter %d", letter.Queue, letter.Key, letter.Id)
+	letter.requeue()
+	return letter, nil
+}
+
+// Delete drops the dead letter id
+func (d *deadLetters) Delete(id int64) (*DeadLetter, error) {
+	return d.take(id)
+}
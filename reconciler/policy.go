@@ -0,0 +1,47 @@
+package reconciler
+
+import (
+	"github.com/astaxie/beego"
+	"k8s.io/client-go/util/workqueue"
+	"time"
+)
+
+// policy is how a controller handles its workqueue, read from the keys <prefix>Workers,
+// <prefix>MaxRetries, <prefix>RetryBaseDelay and <prefix>RetryMaxDelay in seconds
+type policy struct {
+	workers    int
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+func loadPolicy(prefix string) *policy {
+	p := &policy{
+		workers:    beego.AppConfig.DefaultInt(prefix+"Workers", 1),
+		maxRetries: beego.AppConfig.DefaultInt(prefix+"MaxRetries", 5),
+		baseDelay:  time.Duration(beego.AppConfig.DefaultFloat(prefix+"RetryBaseDelay", 1) * float64(time.Second)),
+		maxDelay:   time.Duration(beego.AppConfig.DefaultFloat(prefix+"RetryMaxDelay", 300) * float64(time.Second)),
+	}
+	if p.workers < 1 {
+		p.workers = 1
+	}
+	if p.maxRetries < 0 {
+		p.maxRetries = 0
+	}
+	if p.baseDelay <= 0 {
+		p.baseDelay = time.Second
+	}
+	if p.maxDelay < p.baseDelay {
+		p.maxDelay = p.baseDelay
+	}
+	return p
+}
+
+// rateLimiter retries a key after baseDelay, doubled on each failure up to maxDelay
+func (p *policy) rateLimiter() workqueue.RateLimiter {
+	return workqueue.NewItemExponentialFailureRateLimiter(p.baseDelay, p.maxDelay)
+}
+
+func (p *policy) newQueue(name string) workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(p.rateLimiter(), name)
+}
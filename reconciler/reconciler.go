@@ -0,0 +1,348 @@
+// Package reconciler runs the controllers watching a resource: the events of an informer
+// queue the key of their object and workers reconcile each key until it succeeds, retried
+// with backoff and dropped into the dead letters after too many failures.
+//
+// A controller for a new resource is its Reconcile func:
+//
+//	c := reconciler.New(reconciler.Config{
+//		Name:         "leaselistener",
+//		ConfigPrefix: "LeaseListener",
+//		Informer:     conf.LeaseInformer.Informer(),
+//		Reconciler: reconciler.ReconcilerFunc(func(ctx context.Context, key string) error {
+//			namespace, name, err := cache.SplitMetaNamespaceKey(key)
+//			...
+//		}),
+//	})
+//	go c.Run(stop)
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"node-controller/leader"
+	// the workqueues export their metrics once the provider is set
+	_ "node-controller/metrics"
+	"node-controller/util/logs"
+	"sync"
+	"time"
+)
+
+var (
+	reconcileTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_controller_reconcile_total",
+		Help: "Total number of reconciles by controller and result: success, retry or dropped.",
+	}, []string{"controller", "result"})
+	reconcileDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "node_controller_reconcile_duration_seconds",
+		Help: "How long in seconds reconciling a key takes.",
+	}, []string{"controller"})
+)
+
+// Reconciler brings the object of a key to its wanted state. The object is looked up in
+// the listers, it is gone once deleted. Reconcile is called again with backoff while it
+// fails, and may be called for a key whose object did not change.
+type Reconciler interface {
+	Reconcile(ctx context.Context, key string) error
+}
+
+// ReconcilerFunc is a func as Reconciler
+type ReconcilerFunc func(ctx context.Context, key string) error
+
+func (f ReconcilerFunc) Reconcile(ctx context.Context, key string) error {
+	return f(ctx, key)
+}
+
+// Lister finds the objects by key, the store of an informer is one
+type Lister interface {
+	ListKeys() []string
+	GetByKey(key string) (item interface{}, exists bool, err error)
+}
+
+// Hooks run for each event of the informer on every replica, before the key is queued
+type Hooks struct {
+	OnAdd func(obj interface{})
+	// OnUpdate is not called on the resyncs of the informer, the object did not change
+	OnUpdate func(oldObj, newObj interface{})
+	// OnDelete gets the last state of the object, out of its tombstone
+	OnDelete func(obj interface{})
+}
+
+type Config struct {
+	// Name of the workqueue, in the logs, metrics and dead letters
+	Name string
+	// ConfigPrefix of the keys of the workers and retries, see loadPolicy
+	ConfigPrefix string
+	// Informer queues the key of each object added, updated or deleted
+	Informer cache.SharedInformer
+	// Lister finds the keys to queue again when this replica starts leading, the store of
+	// Informer when nil
+	Lister     Lister
+	Reconciler Reconciler
+	Hooks      Hooks
+	// WaitFor are the other caches read by Reconciler, the workers start once they have synced
+	WaitFor []cache.InformerSynced
+	// KeepLast keeps the object of each key as last reconciled, and the last state of the
+	// deleted ones, see Last
+	KeepLast bool
+}
+
+// Controller queues the keys of the objects of an informer and reconciles them
+type Controller struct {
+	name       string
+	lister     Lister
+	reconciler Reconciler
+	hooks      Hooks
+	synced     []cache.InformerSynced
+	policy     *policy
+	queue      workqueue.RateLimitingInterface
+	workers    sync.WaitGroup
+
+	keepLast bool
+	lastLock sync.Mutex
+	last     map[string]interface{}
+}
+
+func New(config Config) *Controller {
+	p := loadPolicy(config.ConfigPrefix)
+	lister := config.Lister
+	if lister == nil {
+		lister = config.Informer.GetStore()
+	}
+	c := &Controller{
+		name:       config.Name,
+		lister:     lister,
+		reconciler: config.Reconciler,
+		hooks:      config.Hooks,
+		synced:     append([]cache.InformerSynced{config.Informer.HasSynced}, config.WaitFor...),
+		policy:     p,
+		queue:      p.newQueue(config.Name),
+		keepLast:   config.KeepLast,
+		last:       map[string]interface{}{},
+	}
+
+	config.Informer.AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.addFunc,
+			UpdateFunc: c.updateFunc,
+			DeleteFunc: c.deleteFunc,
+		})
+	// the events are dropped until this replica leads
+	leader.OnStartedLeading(c.Resync)
+
+	return c
+}
+
+func (c *Controller) addFunc(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	if c.hooks.OnAdd != nil {
+		c.hooks.OnAdd(obj)
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) updateFunc(oldObj, newObj interface{}) {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	if oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(newObj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	if c.hooks.OnUpdate != nil {
+		c.hooks.OnUpdate(oldObj, newObj)
+	}
+	c.queue.Add(key)
+}
+
+func (c *Controller) deleteFunc(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if c.keepLast {
+		c.setLast(key, obj, true)
+	}
+	if c.hooks.OnDelete != nil {
+		c.hooks.OnDelete(obj)
+	}
+	c.queue.Add(key)
+}
+
+// Enqueue queues key to be reconciled
+func (c *Controller) Enqueue(key string) {
+	c.queue.Add(key)
+}
+
+// EnqueueAfter queues key to be reconciled once after d, even if it is queued before
+func (c *Controller) EnqueueAfter(key string, d time.Duration) {
+	c.queue.AddAfter(key, d)
+}
+
+// EnqueueObject queues the key of obj
+func (c *Controller) EnqueueObject(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// Resync queues the key of every object of the lister
+func (c *Controller) Resync() {
+	for _, key := range c.lister.ListKeys() {
+		c.queue.Add(key)
+	}
+}
+
+// Last returns the object of key as last reconciled, or its last state once deleted. It is
+// nil when unknown: before the first reconcile on the leader, or without KeepLast.
+func (c *Controller) Last(key string) interface{} {
+	c.lastLock.Lock()
+	defer c.lastLock.Unlock()
+	return c.last[key]
+}
+
+func (c *Controller) setLast(key string, obj interface{}, exists bool) {
+	c.lastLock.Lock()
+	defer c.lastLock.Unlock()
+	if exists {
+		c.last[key] = obj
+	} else {
+		delete(c.last, key)
+	}
+}
+
+// Run starts the workers once the caches have synced, their context is cancelled when
+// stop is closed
+func (c *Controller) Run(stop <-chan struct{}) error {
+	//同步缓存
+	if ok := cache.WaitForCacheSync(stop, c.synced...); !ok {
+		logs.Error("%s 同步缓存失败", c.name)
+		return fmt.Errorf("failed to wait for caches of %s to sync", c.name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for i := 0; i < c.policy.workers; i++ {
+		c.workers.Add(1)
+		go func() {
+			defer c.workers.Done()
+			for c.processNextWorkItem(ctx) {
+			}
+		}()
+	}
+	logs.Info("%s started %d workers", c.name, c.policy.workers)
+	return nil
+}
+
+// ShutDown returns once the keys queued are reconciled
+func (c *Controller) ShutDown() {
+	c.queue.ShutDown()
+	c.workers.Wait()
+}
+
+// processNextWorkItem reconciles the next key, it returns false once the queue is shut
+// down and drained
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	item, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(item)
+
+	key, ok := item.(string)
+	if !ok {
+		c.queue.Forget(item)
+		runtime.HandleError(fmt.Errorf("expected string in workqueue %s but got %#v", c.name, item))
+		return true
+	}
+	// followers only keep their caches, the leader handles everything again when elected
+	if !leader.IsLeader() {
+		c.queue.Forget(item)
+		if c.keepLast {
+			c.setLast(key, nil, false)
+		}
+		return true
+	}
+
+	obj, exists, err := c.lister.GetByKey(key)
+	if err == nil {
+		err = c.reconcile(ctx, key)
+	}
+	if err == nil && c.keepLast {
+		c.setLast(key, obj, exists)
+	}
+	c.handleErr(key, err)
+	return true
+}
+
+// reconcile calls the Reconciler, a panic is an error
+func (c *Controller) reconcile(ctx context.Context, key string) (err error) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		reconcileDuration.WithLabelValues(c.name).Observe(time.Since(start).Seconds())
+	}()
+	err = c.reconciler.Reconcile(ctx, key)
+	logs.Debug("%s reconciled '%s' in %s", c.name, key, time.Since(start))
+	return err
+}
+
+// handleErr forgets key once reconciled. On err key is queued again with backoff until it
+// has been retried maxRetries times, then it is dropped into the dead letters.
+func (c *Controller) handleErr(key string, err error) {
+	if err == nil {
+		reconcileTotal.WithLabelValues(c.name, "success").Inc()
+		c.queue.Forget(key)
+		return
+	}
+	retries := c.queue.NumRequeues(key)
+	if retries < c.policy.maxRetries {
+		reconcileTotal.WithLabelValues(c.name, "retry").Inc()
+		logs.Warning("error syncing %s '%s', retry %d/%d: %s", c.name, key, retries+1, c.policy.maxRetries, err.Error())
+		c.queue.AddRateLimited(key)
+		return
+	}
+	reconcileTotal.WithLabelValues(c.name, "dropped").Inc()
+	c.queue.Forget(key)
+	runtime.HandleError(fmt.Errorf("dropping %s '%s' after %d retries: %s", c.name, key, retries, err.Error()))
+	DeadLetters.add(&DeadLetter{
+		Queue:     c.name,
+		Key:       key,
+		Error:     err.Error(),
+		Retries:   retries,
+		CreatedAt: time.Now(),
+		requeue:   func() { c.queue.Add(key) },
+	})
+}
@@ -0,0 +1,364 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"github.com/astaxie/beego"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"node-controller/leader"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]string
+		want   policy
+	}{
+		{"defaults", nil, policy{workers: 1, maxRetries: 5, baseDelay: time.Second, maxDelay: 300 * time.Second}},
+		{
+			"configured",
+			map[string]string{"Workers": "4", "MaxRetries": "10", "RetryBaseDelay": "0.5", "RetryMaxDelay": "60"},
+			policy{workers: 4, maxRetries: 10, baseDelay: 500 * time.Millisecond, maxDelay: time.Minute},
+		},
+		{
+			"out of range",
+			map[string]string{"Workers": "0", "MaxRetries": "-1", "RetryBaseDelay": "0", "RetryMaxDelay": "0.1"},
+			policy{workers: 1, maxRetries: 0, baseDelay: time.Second, maxDelay: time.Second},
+		},
+	}
+	for _, test := range tests {
+		prefix := "TestLoadPolicy" + test.name
+		for key, value := range test.config {
+			if err := beego.AppConfig.Set(prefix+key, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := loadPolicy(prefix); *got != test.want {
+			t.Errorf("%s: loadPolicy() = %+v, want %+v", test.name, *got, test.want)
+		}
+	}
+}
+
+func TestPolicyBackoff(t *testing.T) {
+	p := &policy{baseDelay: time.Second, maxDelay: 5 * time.Second}
+	limiter := p.rateLimiter()
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range want {
+		if got := limiter.When("key"); got != delay {
+			t.Errorf("retry %d: delay = %s, want %s", i+1, got, delay)
+		}
+	}
+	limiter.Forget("key")
+	if got := limiter.When("key"); got != time.Second {
+		t.Errorf("delay after forget = %s, want %s", got, time.Second)
+	}
+}
+
+// newTestController is a controller without informer, its keys are retried after 1ms
+func newTestController(name string, maxRetries int) *Controller {
+	p := &policy{workers: 1, maxRetries: maxRetries, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+	return &Controller{
+		name:   name,
+		policy: p,
+		queue:  p.newQueue(name),
+		last:   map[string]interface{}{},
+	}
+}
+
+func TestHandleErr(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name       string
+		maxRetries int
+		errs       []error
+		// wantRequeues is how many times the key has been retried since its last success
+		wantRequeues int
+		wantDropped  bool
+	}{
+		{"success", 2, []error{nil}, 0, false},
+		{"retried", 2, []error{failed}, 1, false},
+		{"retried up to max", 2, []error{failed, failed}, 2, false},
+		{"dropped after max", 2, []error{failed, failed, failed}, 0, true},
+		{"success forgets the retries", 2, []error{failed, failed, nil}, 0, false},
+		{"dropped without retries", 0, []error{failed}, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestController("TestHandleErr "+test.name, test.maxRetries)
+			defer c.queue.ShutDown()
+			for _, err := range test.errs {
+				c.handleErr("default/key", err)
+			}
+			if got := c.queue.NumRequeues("default/key"); got != test.wantRequeues {
+				t.Errorf("requeues = %d, want %d", got, test.wantRequeues)
+			}
+
+			letters := DeadLetters.List(c.name)
+			if !test.wantDropped {
+				if len(letters) != 0 {
+					t.Errorf("dead letters = %+v, want none", letters)
+				}
+				return
+			}
+			if len(letters) != 1 {
+				t.Fatalf("dead letters = %+v, want one", letters)
+			}
+			letter := letters[0]
+			if letter.Key != "default/key" || letter.Error != failed.Error() || letter.Retries != test.maxRetries {
+				t.Errorf("dead letter = %+v, want key default/key after %d retries", letter, test.maxRetries)
+			}
+
+			// a retried dead letter is queued again and leaves the dead letters
+			c.queue = c.policy.newQueue(c.name)
+			if _, err := DeadLetters.Retry(letter.Id); err != nil {
+				t.Fatalf("Retry() = %v", err)
+			}
+			if c.queue.Len() != 1 {
+				t.Errorf("queue length = %d after retry, want 1", c.queue.Len())
+			}
+			if letters := DeadLetters.List(c.name); len(letters) != 0 {
+				t.Errorf("dead letters = %+v after retry, want none", letters)
+			}
+			if _, err := DeadLetters.Retry(letter.Id); err == nil {
+				t.Errorf("second Retry() succeeded, want not found")
+			}
+		})
+	}
+}
+
+func TestReconcileRecoversPanics(t *testing.T) {
+	tests := []struct {
+		name       string
+		reconciler ReconcilerFunc
+		wantErr    string
+	}{
+		{"success", func(ctx context.Context, key string) error { return nil }, ""},
+		{"error", func(ctx context.Context, key string) error { return errors.New("failed") }, "failed"},
+		{"panic", func(ctx context.Context, key string) error { panic("boom") }, "panic: boom"},
+	}
+	for _, test := range tests {
+		c := newTestController("TestReconcileRecoversPanics", 0)
+		c.reconciler = test.reconciler
+		err := c.reconcile(context.Background(), "default/key")
+		if (err == nil && test.wantErr != "") || (err != nil && err.Error() != test.wantErr) {
+			t.Errorf("%s: reconcile() = %v, want %q", test.name, err, test.wantErr)
+		}
+		c.queue.ShutDown()
+	}
+}
+
+// reconciled is a key reconciled and the object Last returned for it meanwhile
+type reconciled struct {
+	key  string
+	last interface{}
+}
+
+// runTestController runs a controller named name over the config maps of a fake
+// clientset holding objects, its keys are retried after 1ms. Each reconcile is sent to the
+// returned channel and fails with the next error of errs.
+func runTestController(t *testing.T, name string, stop chan struct{}, hooks Hooks, errs []error, objects ...runtime.Object) (*Controller, kubernetes.Interface, chan reconciled) {
+	for key, value := range map[string]string{"RetryBaseDelay": "0.001", "RetryMaxDelay": "0.001"} {
+		if err := beego.AppConfig.Set(name+key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := fake.NewSimpleClientset(objects...)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	results := make(chan reconciled, 100)
+	var errsLock sync.Mutex
+	var c *Controller
+	c = New(Config{
+		Name:         name,
+		ConfigPrefix: name,
+		Informer:     factory.Core().V1().ConfigMaps().Informer(),
+		Reconciler: ReconcilerFunc(func(ctx context.Context, key string) error {
+			results <- reconciled{key: key, last: c.Last(key)}
+			errsLock.Lock()
+			defer errsLock.Unlock()
+			if len(errs) == 0 {
+				return nil
+			}
+			err := errs[0]
+			errs = errs[1:]
+			return err
+		}),
+		Hooks:    hooks,
+		KeepLast: true,
+	})
+	factory.Start(stop)
+	if err := c.Run(stop); err != nil {
+		t.Fatal(err)
+	}
+	return c, client, results
+}
+
+func newConfigMap(name string, resourceVersion string) *v1.ConfigMap {
+	return &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, ResourceVersion: resourceVersion}}
+}
+
+func nextReconcile(t *testing.T, results chan reconciled) reconciled {
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(time.Second):
+		t.Fatal("key not reconciled")
+	}
+	return reconciled{}
+}
+
+func noReconcile(t *testing.T, results chan reconciled) {
+	select {
+	case result := <-results:
+		t.Errorf("%s reconciled, want none", result.key)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// resourceVersion is the resource version of the config map obj, "" for nil
+func resourceVersion(obj interface{}) string {
+	if obj == nil {
+		return ""
+	}
+	return obj.(*v1.ConfigMap).ResourceVersion
+}
+
+var leading sync.Once
+
+// lead makes this replica the leader, the controllers queue all their keys again
+func lead(t *testing.T) {
+	leading.Do(func() {
+		if err := leader.Run(fake.NewSimpleClientset(), make(chan struct{})); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// TestFollower runs first, before this replica leads
+func TestFollower(t *testing.T) {
+	if leader.IsLeader() {
+		t.Skip("replica leading already")
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	c, client, results := runTestController(t, "TestFollower", stop, Hooks{}, nil, newConfigMap("a", "1"))
+
+	// the keys are dropped without reconcile and nothing is kept
+	c.setLast("default/a", newConfigMap("a", "0"), true)
+	c.Enqueue("default/a")
+	noReconcile(t, results)
+	if c.queue.Len() != 0 || c.Last("default/a") != nil {
+		t.Errorf("queue length %d, last %v, want the key dropped", c.queue.Len(), c.Last("default/a"))
+	}
+	if _, err := client.CoreV1().ConfigMaps("default").Create(newConfigMap("b", "1")); err != nil {
+		t.Fatal(err)
+	}
+	noReconcile(t, results)
+
+	// every key is reconciled once this replica leads
+	lead(t)
+	keys := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		keys[nextReconcile(t, results).key] = true
+	}
+	if !keys["default/a"] || !keys["default/b"] {
+		t.Errorf("reconciled %v once leading, want default/a and default/b", keys)
+	}
+}
+
+func TestKeepLast(t *testing.T) {
+	lead(t)
+	stop := make(chan struct{})
+	defer close(stop)
+	failed := errors.New("failed")
+	c, client, results := runTestController(t, "TestKeepLast", stop, Hooks{}, []error{nil, nil, failed})
+	configMaps := client.CoreV1().ConfigMaps("default")
+
+	steps := []struct {
+		name string
+		do   func() error
+		// wantSeen are the resource versions Last returns while reconciling, wantLast once done
+		wantSeen []string
+		wantLast string
+	}{
+		{"added", func() error { _, err := configMaps.Create(newConfigMap("a", "1")); return err }, []string{""}, "1"},
+		{"updated", func() error { _, err := configMaps.Update(newConfigMap("a", "2")); return err }, []string{"1"}, "2"},
+		{"retried", func() error { _, err := configMaps.Update(newConfigMap("a", "3")); return err }, []string{"2", "2"}, "3"},
+		// the deleted state is kept for the reconcile of the deletion only
+		{"deleted", func() error { return configMaps.Delete("a", nil) }, []string{"3"}, ""},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatal(err)
+		}
+		seen := make([]string, 0)
+		for range step.wantSeen {
+			result := nextReconcile(t, results)
+			seen = append(seen, resourceVersion(result.last))
+		}
+		if !reflect.DeepEqual(seen, step.wantSeen) {
+			t.Errorf("%s: last while reconciling = %v, want %v", step.name, seen, step.wantSeen)
+		}
+		var last string
+		err := wait.Poll(time.Millisecond, time.Second, func() (bool, error) {
+			last = resourceVersion(c.Last("default/a"))
+			return last == step.wantLast && c.queue.Len() == 0, nil
+		})
+		if err != nil {
+			t.Errorf("%s: last = %q, want %q", step.name, last, step.wantLast)
+		}
+	}
+	noReconcile(t, results)
+}
+
+func TestHooks(t *testing.T) {
+	lead(t)
+	stop := make(chan struct{})
+	defer close(stop)
+	var lock sync.Mutex
+	calls := make([]string, 0)
+	call := func(hook string, objs ...interface{}) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, obj := range objs {
+			hook += " " + resourceVersion(obj)
+		}
+		calls = append(calls, hook)
+	}
+	c, _, results := runTestController(t, "TestHooks", stop, Hooks{
+		OnAdd:    func(obj interface{}) { call("add", obj) },
+		OnUpdate: func(oldObj, newObj interface{}) { call("update", oldObj, newObj) },
+		OnDelete: func(obj interface{}) { call("delete", obj) },
+	}, nil)
+
+	c.addFunc(newConfigMap("a", "1"))
+	// a resync of the informer
+	c.updateFunc(newConfigMap("a", "1"), newConfigMap("a", "1"))
+	c.updateFunc(newConfigMap("a", "1"), newConfigMap("a", "2"))
+	c.deleteFunc(cache.DeletedFinalStateUnknown{Key: "default/a", Obj: newConfigMap("a", "3")})
+	c.deleteFunc(newConfigMap("b", "4"))
+
+	want := []string{"add 1", "update 1 2", "delete 3", "delete 4"}
+	lock.Lock()
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("hooks called %v, want %v", calls, want)
+	}
+	lock.Unlock()
+	keys := map[string]bool{}
+	for len(keys) < 2 {
+		keys[nextReconcile(t, results).key] = true
+	}
+	if !keys["default/a"] || !keys["default/b"] {
+		t.Errorf("reconciled %v, want default/a and default/b", keys)
+	}
+}
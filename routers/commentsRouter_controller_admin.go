@@ -0,0 +1,37 @@
+package routers
+
+import (
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context/param"
+)
+
+func init() {
+
+	beego.GlobalControllerRouter["node-controller/controller/admin:DeadLetterController"] = append(beego.GlobalControllerRouter["node-controller/controller/admin:DeadLetterController"],
+		beego.ControllerComments{
+			Method:           "List",
+			Router:           `/`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/admin:DeadLetterController"] = append(beego.GlobalControllerRouter["node-controller/controller/admin:DeadLetterController"],
+		beego.ControllerComments{
+			Method:           "Retry",
+			Router:           `/:id/retry`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/admin:DeadLetterController"] = append(beego.GlobalControllerRouter["node-controller/controller/admin:DeadLetterController"],
+		beego.ControllerComments{
+			Method:           "Delete",
+			Router:           `/:id`,
+			AllowHTTPMethods: []string{"delete"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+}
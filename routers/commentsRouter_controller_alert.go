@@ -0,0 +1,91 @@
+package routers
+
+import (
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context/param"
+)
+
+func init() {
+
+	beego.GlobalControllerRouter["node-controller/controller/alert:AlertController"] = append(beego.GlobalControllerRouter["node-controller/controller/alert:AlertController"],
+		beego.ControllerComments{
+			Method:           "List",
+			Router:           `/`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/alert:AlertController"] = append(beego.GlobalControllerRouter["node-controller/controller/alert:AlertController"],
+		beego.ControllerComments{
+			Method:           "Get",
+			Router:           `/:id`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/alert:AlertController"] = append(beego.GlobalControllerRouter["node-controller/controller/alert:AlertController"],
+		beego.ControllerComments{
+			Method:           "Ack",
+			Router:           `/:id/ack`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/alert:AlertController"] = append(beego.GlobalControllerRouter["node-controller/controller/alert:AlertController"],
+		beego.ControllerComments{
+			Method:           "Resolve",
+			Router:           `/:id/resolve`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"] = append(beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"],
+		beego.ControllerComments{
+			Method:           "Create",
+			Router:           `/`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"] = append(beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"],
+		beego.ControllerComments{
+			Method:           "Delete",
+			Router:           `/:id`,
+			AllowHTTPMethods: []string{"delete"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"] = append(beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"],
+		beego.ControllerComments{
+			Method:           "Get",
+			Router:           `/:id`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"] = append(beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"],
+		beego.ControllerComments{
+			Method:           "List",
+			Router:           `/`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"] = append(beego.GlobalControllerRouter["node-controller/controller/alert:SilenceController"],
+		beego.ControllerComments{
+			Method:           "Update",
+			Router:           `/:id`,
+			AllowHTTPMethods: []string{"put"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+}
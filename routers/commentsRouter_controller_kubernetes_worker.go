@@ -16,4 +16,67 @@ func init() {
 			Filters:          nil,
 			Params:           nil})
 
+	beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"] = append(beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"],
+		beego.ControllerComments{
+			Method:           "Cordon",
+			Router:           `/:name/cordon`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"] = append(beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"],
+		beego.ControllerComments{
+			Method:           "Drain",
+			Router:           `/:name/drain`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"] = append(beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"],
+		beego.ControllerComments{
+			Method:           "Operation",
+			Router:           `/operations/:id`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"] = append(beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"],
+		beego.ControllerComments{
+			Method:           "Uncordon",
+			Router:           `/:name/uncordon`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"] = append(beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"],
+		beego.ControllerComments{
+			Method:           "Labels",
+			Router:           `/:name/labels`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"] = append(beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"],
+		beego.ControllerComments{
+			Method:           "Taints",
+			Router:           `/:name/taints`,
+			AllowHTTPMethods: []string{"post"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"] = append(beego.GlobalControllerRouter["node-controller/controller/kubernetes/worker:WorkerController"],
+		beego.ControllerComments{
+			Method:           "Get",
+			Router:           `/:name`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
 }
@@ -0,0 +1,28 @@
+package routers
+
+import (
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/context/param"
+)
+
+func init() {
+
+	beego.GlobalControllerRouter["node-controller/controller/stream:StreamController"] = append(beego.GlobalControllerRouter["node-controller/controller/stream:StreamController"],
+		beego.ControllerComments{
+			Method:           "Events",
+			Router:           `/sse`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter["node-controller/controller/stream:StreamController"] = append(beego.GlobalControllerRouter["node-controller/controller/stream:StreamController"],
+		beego.ControllerComments{
+			Method:           "WebSocket",
+			Router:           `/ws`,
+			AllowHTTPMethods: []string{"get"},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+}
@@ -1,34 +1,87 @@
 package routers
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/astaxie/beego"
 	"github.com/astaxie/beego/context"
 	"github.com/astaxie/beego/plugins/cors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"node-controller/common"
+	"node-controller/controller/admin"
+	"node-controller/controller/alert"
 	"node-controller/controller/kubernetes/worker"
+	"node-controller/controller/stream"
+	"node-controller/health"
 	"node-controller/util/hack"
+	"sort"
 )
 
 func init() {
 	beego.InsertFilter("*", beego.BeforeRouter, cors.Allow(&cors.Options{
 		//AllowAllOrigins: true,
-		AllowOrigins:     []string{"http://10.*.*.*:*", "http://localhost:*", "http://127.0.0.1:*", "http://172.*.*.*:*", "http://192.*.*.*:*"},
+		AllowOrigins:     common.AllowOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"*", "content-time"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
 
-	beego.Get("/healthz", func(ctx *context.Context) {
+	// the process is up, /healthz is kept for the existing probes
+	live := func(ctx *context.Context) {
 		ctx.Output.SetStatus(http.StatusOK)
 		ctx.Output.Body(hack.Slice("ok"))
+	}
+	beego.Get("/healthz", live)
+	beego.Get("/livez", live)
+
+	// the informer caches have synced and the database answers
+	beego.Get("/readyz", func(ctx *context.Context) {
+		failures := health.Ready()
+		if len(failures) == 0 {
+			ctx.Output.SetStatus(http.StatusOK)
+			ctx.Output.Body(hack.Slice("ok"))
+			return
+		}
+		names := make([]string, 0, len(failures))
+		for name := range failures {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var body bytes.Buffer
+		for _, name := range names {
+			fmt.Fprintf(&body, "%s: %s\n", name, failures[name])
+		}
+		ctx.Output.SetStatus(http.StatusServiceUnavailable)
+		ctx.Output.Body(body.Bytes())
 	})
 
+	beego.Handler("/metrics", promhttp.Handler())
+
 	nsWithK8sWorker := beego.NewNamespace("/api/v1/k8s",
 		beego.NSNamespace("/worker",
 			beego.NSInclude(&worker.WorkerController{}),
 		),
 	)
 
-	beego.AddNamespace(nsWithK8sWorker)
+	nsWithAlerts := beego.NewNamespace("/api/v1/alerts",
+		beego.NSInclude(&alert.AlertController{}),
+	)
+
+	nsWithSilences := beego.NewNamespace("/api/v1/silences",
+		beego.NSInclude(&alert.SilenceController{}),
+	)
+
+	nsWithEvents := beego.NewNamespace("/api/v1/events",
+		beego.NSInclude(&stream.StreamController{}),
+	)
+
+	nsWithAdmin := beego.NewNamespace("/api/v1/admin",
+		beego.NSNamespace("/deadletters",
+			beego.NSInclude(&admin.DeadLetterController{}),
+		),
+	)
+
+	beego.AddNamespace(nsWithK8sWorker, nsWithAlerts, nsWithSilences, nsWithEvents, nsWithAdmin)
 }